@@ -21,38 +21,678 @@ const (
 	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
 )
 
+type BytecodeMode int32
+
+const (
+	BytecodeMode_BYTECODE_MODE_NONE BytecodeMode = 0
+	// Stripped bytecode is returned alongside the source.
+	BytecodeMode_BYTECODE_MODE_ALONGSIDE BytecodeMode = 1
+	// Stripped bytecode is returned instead of the source.
+	BytecodeMode_BYTECODE_MODE_ONLY BytecodeMode = 2
+)
+
+// Enum value maps for BytecodeMode.
+var (
+	BytecodeMode_name = map[int32]string{
+		0: "BYTECODE_MODE_NONE",
+		1: "BYTECODE_MODE_ALONGSIDE",
+		2: "BYTECODE_MODE_ONLY",
+	}
+	BytecodeMode_value = map[string]int32{
+		"BYTECODE_MODE_NONE":      0,
+		"BYTECODE_MODE_ALONGSIDE": 1,
+		"BYTECODE_MODE_ONLY":      2,
+	}
+)
+
+func (x BytecodeMode) Enum() *BytecodeMode {
+	p := new(BytecodeMode)
+	*p = x
+	return p
+}
+
+func (x BytecodeMode) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (BytecodeMode) Descriptor() protoreflect.EnumDescriptor {
+	return file_rockamalg_proto_enumTypes[0].Descriptor()
+}
+
+func (BytecodeMode) Type() protoreflect.EnumType {
+	return &file_rockamalg_proto_enumTypes[0]
+}
+
+func (x BytecodeMode) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use BytecodeMode.Descriptor instead.
+func (BytecodeMode) EnumDescriptor() ([]byte, []int) {
+	return file_rockamalg_proto_rawDescGZIP(), []int{0}
+}
+
+type GraphFormat int32
+
+const (
+	GraphFormat_GRAPH_FORMAT_DOT  GraphFormat = 0
+	GraphFormat_GRAPH_FORMAT_JSON GraphFormat = 1
+)
+
+// Enum value maps for GraphFormat.
+var (
+	GraphFormat_name = map[int32]string{
+		0: "GRAPH_FORMAT_DOT",
+		1: "GRAPH_FORMAT_JSON",
+	}
+	GraphFormat_value = map[string]int32{
+		"GRAPH_FORMAT_DOT":  0,
+		"GRAPH_FORMAT_JSON": 1,
+	}
+)
+
+func (x GraphFormat) Enum() *GraphFormat {
+	p := new(GraphFormat)
+	*p = x
+	return p
+}
+
+func (x GraphFormat) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (GraphFormat) Descriptor() protoreflect.EnumDescriptor {
+	return file_rockamalg_proto_enumTypes[1].Descriptor()
+}
+
+func (GraphFormat) Type() protoreflect.EnumType {
+	return &file_rockamalg_proto_enumTypes[1]
+}
+
+func (x GraphFormat) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use GraphFormat.Descriptor instead.
+func (GraphFormat) EnumDescriptor() ([]byte, []int) {
+	return file_rockamalg_proto_rawDescGZIP(), []int{1}
+}
+
 type AmalgRequest struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
 	unknownFields protoimpl.UnknownFields
 
-	LuaFile              []byte   `protobuf:"bytes,1,opt,name=lua_file,json=luaFile,proto3" json:"lua_file,omitempty"`
-	LuaDir               []byte   `protobuf:"bytes,2,opt,name=lua_dir,json=luaDir,proto3" json:"lua_dir,omitempty"`
-	Dependencies         []string `protobuf:"bytes,3,rep,name=dependencies,proto3" json:"dependencies,omitempty"`
-	Rockspec             []byte   `protobuf:"bytes,4,opt,name=rockspec,proto3" json:"rockspec,omitempty"`
-	Isolate              bool     `protobuf:"varint,5,opt,name=isolate,proto3" json:"isolate,omitempty"`
-	DisableDebug         bool     `protobuf:"varint,6,opt,name=disable_debug,json=disableDebug,proto3" json:"disable_debug,omitempty"`
-	AllowDevDependencies bool     `protobuf:"varint,7,opt,name=allow_dev_dependencies,json=allowDevDependencies,proto3" json:"allow_dev_dependencies,omitempty"`
-	Vendor               []byte   `protobuf:"bytes,8,opt,name=vendor,proto3" json:"vendor,omitempty"`
+	LuaFile              []byte   `protobuf:"bytes,1,opt,name=lua_file,json=luaFile,proto3" json:"lua_file,omitempty"`
+	LuaDir               []byte   `protobuf:"bytes,2,opt,name=lua_dir,json=luaDir,proto3" json:"lua_dir,omitempty"`
+	Dependencies         []string `protobuf:"bytes,3,rep,name=dependencies,proto3" json:"dependencies,omitempty"`
+	Rockspec             []byte   `protobuf:"bytes,4,opt,name=rockspec,proto3" json:"rockspec,omitempty"`
+	Isolate              bool     `protobuf:"varint,5,opt,name=isolate,proto3" json:"isolate,omitempty"`
+	DisableDebug         bool     `protobuf:"varint,6,opt,name=disable_debug,json=disableDebug,proto3" json:"disable_debug,omitempty"`
+	AllowDevDependencies bool     `protobuf:"varint,7,opt,name=allow_dev_dependencies,json=allowDevDependencies,proto3" json:"allow_dev_dependencies,omitempty"`
+	Vendor               []byte   `protobuf:"bytes,8,opt,name=vendor,proto3" json:"vendor,omitempty"`
+	Strict               bool     `protobuf:"varint,9,opt,name=strict,proto3" json:"strict,omitempty"`
+	AllowUnresolved      []string `protobuf:"bytes,10,rep,name=allow_unresolved,json=allowUnresolved,proto3" json:"allow_unresolved,omitempty"`
+	LuaVersion           string   `protobuf:"bytes,11,opt,name=lua_version,json=luaVersion,proto3" json:"lua_version,omitempty"`
+	AllowNativeModules   bool     `protobuf:"varint,12,opt,name=allow_native_modules,json=allowNativeModules,proto3" json:"allow_native_modules,omitempty"`
+	// search_path are package.path-style templates, e.g. "src/?.lua;src/?/init.lua".
+	SearchPath string `protobuf:"bytes,13,opt,name=search_path,json=searchPath,proto3" json:"search_path,omitempty"`
+	// backend is "native" (default) or "amalg.lua".
+	Backend      string       `protobuf:"bytes,14,opt,name=backend,proto3" json:"backend,omitempty"`
+	Minify       bool         `protobuf:"varint,15,opt,name=minify,proto3" json:"minify,omitempty"`
+	MinifyLocals bool         `protobuf:"varint,16,opt,name=minify_locals,json=minifyLocals,proto3" json:"minify_locals,omitempty"`
+	Bytecode     BytecodeMode `protobuf:"varint,17,opt,name=bytecode,proto3,enum=rockamalg.rpc.BytecodeMode" json:"bytecode,omitempty"`
+	// source_map requests JSON source map of the result.
+	SourceMap bool `protobuf:"varint,18,opt,name=source_map,json=sourceMap,proto3" json:"source_map,omitempty"`
+	// lockfile is rockamalg.lock returned by a previous amalgamation.
+	Lockfile []byte `protobuf:"bytes,19,opt,name=lockfile,proto3" json:"lockfile,omitempty"`
+	// locked installs rocks of the lockfile and fails if dependencies require other rocks.
+	Locked bool `protobuf:"varint,20,opt,name=locked,proto3" json:"locked,omitempty"`
+	// build_info adds the header comment and rockamalg.buildinfo module to the result.
+	BuildInfo bool `protobuf:"varint,21,opt,name=build_info,json=buildInfo,proto3" json:"build_info,omitempty"`
+	// build_version is the version of the result shown in the build info, it enables build info.
+	BuildVersion string `protobuf:"bytes,22,opt,name=build_version,json=buildVersion,proto3" json:"build_version,omitempty"`
+	// offline builds from the vendor only without luarocks install, it fails
+	// if the vendor does not satisfy dependencies.
+	Offline bool `protobuf:"varint,23,opt,name=offline,proto3" json:"offline,omitempty"`
+	// prune_vendor returns the vendor with rocks which modules are included into the result only.
+	PruneVendor bool `protobuf:"varint,24,opt,name=prune_vendor,json=pruneVendor,proto3" json:"prune_vendor,omitempty"`
+	// allow_legacy_vendor extracts the vendor without manifest built by previous versions,
+	// otherwise such vendor is rejected.
+	AllowLegacyVendor bool `protobuf:"varint,25,opt,name=allow_legacy_vendor,json=allowLegacyVendor,proto3" json:"allow_legacy_vendor,omitempty"`
+}
+
+func (x *AmalgRequest) Reset() {
+	*x = AmalgRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_rockamalg_proto_msgTypes[0]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *AmalgRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AmalgRequest) ProtoMessage() {}
+
+func (x *AmalgRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_rockamalg_proto_msgTypes[0]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AmalgRequest.ProtoReflect.Descriptor instead.
+func (*AmalgRequest) Descriptor() ([]byte, []int) {
+	return file_rockamalg_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *AmalgRequest) GetLuaFile() []byte {
+	if x != nil {
+		return x.LuaFile
+	}
+	return nil
+}
+
+func (x *AmalgRequest) GetLuaDir() []byte {
+	if x != nil {
+		return x.LuaDir
+	}
+	return nil
+}
+
+func (x *AmalgRequest) GetDependencies() []string {
+	if x != nil {
+		return x.Dependencies
+	}
+	return nil
+}
+
+func (x *AmalgRequest) GetRockspec() []byte {
+	if x != nil {
+		return x.Rockspec
+	}
+	return nil
+}
+
+func (x *AmalgRequest) GetIsolate() bool {
+	if x != nil {
+		return x.Isolate
+	}
+	return false
+}
+
+func (x *AmalgRequest) GetDisableDebug() bool {
+	if x != nil {
+		return x.DisableDebug
+	}
+	return false
+}
+
+func (x *AmalgRequest) GetAllowDevDependencies() bool {
+	if x != nil {
+		return x.AllowDevDependencies
+	}
+	return false
+}
+
+func (x *AmalgRequest) GetVendor() []byte {
+	if x != nil {
+		return x.Vendor
+	}
+	return nil
+}
+
+func (x *AmalgRequest) GetStrict() bool {
+	if x != nil {
+		return x.Strict
+	}
+	return false
+}
+
+func (x *AmalgRequest) GetAllowUnresolved() []string {
+	if x != nil {
+		return x.AllowUnresolved
+	}
+	return nil
+}
+
+func (x *AmalgRequest) GetLuaVersion() string {
+	if x != nil {
+		return x.LuaVersion
+	}
+	return ""
+}
+
+func (x *AmalgRequest) GetAllowNativeModules() bool {
+	if x != nil {
+		return x.AllowNativeModules
+	}
+	return false
+}
+
+func (x *AmalgRequest) GetSearchPath() string {
+	if x != nil {
+		return x.SearchPath
+	}
+	return ""
+}
+
+func (x *AmalgRequest) GetBackend() string {
+	if x != nil {
+		return x.Backend
+	}
+	return ""
+}
+
+func (x *AmalgRequest) GetMinify() bool {
+	if x != nil {
+		return x.Minify
+	}
+	return false
+}
+
+func (x *AmalgRequest) GetMinifyLocals() bool {
+	if x != nil {
+		return x.MinifyLocals
+	}
+	return false
+}
+
+func (x *AmalgRequest) GetBytecode() BytecodeMode {
+	if x != nil {
+		return x.Bytecode
+	}
+	return BytecodeMode_BYTECODE_MODE_NONE
+}
+
+func (x *AmalgRequest) GetSourceMap() bool {
+	if x != nil {
+		return x.SourceMap
+	}
+	return false
+}
+
+func (x *AmalgRequest) GetLockfile() []byte {
+	if x != nil {
+		return x.Lockfile
+	}
+	return nil
+}
+
+func (x *AmalgRequest) GetLocked() bool {
+	if x != nil {
+		return x.Locked
+	}
+	return false
+}
+
+func (x *AmalgRequest) GetBuildInfo() bool {
+	if x != nil {
+		return x.BuildInfo
+	}
+	return false
+}
+
+func (x *AmalgRequest) GetBuildVersion() string {
+	if x != nil {
+		return x.BuildVersion
+	}
+	return ""
+}
+
+func (x *AmalgRequest) GetOffline() bool {
+	if x != nil {
+		return x.Offline
+	}
+	return false
+}
+
+func (x *AmalgRequest) GetPruneVendor() bool {
+	if x != nil {
+		return x.PruneVendor
+	}
+	return false
+}
+
+func (x *AmalgRequest) GetAllowLegacyVendor() bool {
+	if x != nil {
+		return x.AllowLegacyVendor
+	}
+	return false
+}
+
+type AmalgResponse struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Lua             []byte          `protobuf:"bytes,1,opt,name=lua,proto3" json:"lua,omitempty"`
+	Vendor          []byte          `protobuf:"bytes,2,opt,name=vendor,proto3" json:"vendor,omitempty"`
+	DynamicRequires []string        `protobuf:"bytes,3,rep,name=dynamic_requires,json=dynamicRequires,proto3" json:"dynamic_requires,omitempty"`
+	NativeModules   []*NativeModule `protobuf:"bytes,4,rep,name=native_modules,json=nativeModules,proto3" json:"native_modules,omitempty"`
+	Bytecode        []byte          `protobuf:"bytes,5,opt,name=bytecode,proto3" json:"bytecode,omitempty"`
+	SourceMap       []byte          `protobuf:"bytes,6,opt,name=source_map,json=sourceMap,proto3" json:"source_map,omitempty"`
+	// Hex encoded SHA-256 of lua and bytecode, outputs are reproducible for identical inputs.
+	LuaSha256      string `protobuf:"bytes,7,opt,name=lua_sha256,json=luaSha256,proto3" json:"lua_sha256,omitempty"`
+	BytecodeSha256 string `protobuf:"bytes,8,opt,name=bytecode_sha256,json=bytecodeSha256,proto3" json:"bytecode_sha256,omitempty"`
+	// lockfile records exact versions of installed rocks if dependencies are set.
+	Lockfile []byte `protobuf:"bytes,9,opt,name=lockfile,proto3" json:"lockfile,omitempty"`
+	// pruned_rocks are rocks dropped from the vendor if prune_vendor is set.
+	PrunedRocks []*PrunedRock `protobuf:"bytes,10,rep,name=pruned_rocks,json=prunedRocks,proto3" json:"pruned_rocks,omitempty"`
+}
+
+func (x *AmalgResponse) Reset() {
+	*x = AmalgResponse{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_rockamalg_proto_msgTypes[1]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *AmalgResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AmalgResponse) ProtoMessage() {}
+
+func (x *AmalgResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_rockamalg_proto_msgTypes[1]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AmalgResponse.ProtoReflect.Descriptor instead.
+func (*AmalgResponse) Descriptor() ([]byte, []int) {
+	return file_rockamalg_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *AmalgResponse) GetLua() []byte {
+	if x != nil {
+		return x.Lua
+	}
+	return nil
+}
+
+func (x *AmalgResponse) GetVendor() []byte {
+	if x != nil {
+		return x.Vendor
+	}
+	return nil
+}
+
+func (x *AmalgResponse) GetDynamicRequires() []string {
+	if x != nil {
+		return x.DynamicRequires
+	}
+	return nil
+}
+
+func (x *AmalgResponse) GetNativeModules() []*NativeModule {
+	if x != nil {
+		return x.NativeModules
+	}
+	return nil
+}
+
+func (x *AmalgResponse) GetBytecode() []byte {
+	if x != nil {
+		return x.Bytecode
+	}
+	return nil
+}
+
+func (x *AmalgResponse) GetSourceMap() []byte {
+	if x != nil {
+		return x.SourceMap
+	}
+	return nil
+}
+
+func (x *AmalgResponse) GetLuaSha256() string {
+	if x != nil {
+		return x.LuaSha256
+	}
+	return ""
+}
+
+func (x *AmalgResponse) GetBytecodeSha256() string {
+	if x != nil {
+		return x.BytecodeSha256
+	}
+	return ""
+}
+
+func (x *AmalgResponse) GetLockfile() []byte {
+	if x != nil {
+		return x.Lockfile
+	}
+	return nil
+}
+
+func (x *AmalgResponse) GetPrunedRocks() []*PrunedRock {
+	if x != nil {
+		return x.PrunedRocks
+	}
+	return nil
+}
+
+type PrunedRock struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Rock    string `protobuf:"bytes,1,opt,name=rock,proto3" json:"rock,omitempty"`
+	Version string `protobuf:"bytes,2,opt,name=version,proto3" json:"version,omitempty"`
+}
+
+func (x *PrunedRock) Reset() {
+	*x = PrunedRock{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_rockamalg_proto_msgTypes[2]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *PrunedRock) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PrunedRock) ProtoMessage() {}
+
+func (x *PrunedRock) ProtoReflect() protoreflect.Message {
+	mi := &file_rockamalg_proto_msgTypes[2]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PrunedRock.ProtoReflect.Descriptor instead.
+func (*PrunedRock) Descriptor() ([]byte, []int) {
+	return file_rockamalg_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *PrunedRock) GetRock() string {
+	if x != nil {
+		return x.Rock
+	}
+	return ""
+}
+
+func (x *PrunedRock) GetVersion() string {
+	if x != nil {
+		return x.Version
+	}
+	return ""
+}
+
+type NativeModule struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Module  string `protobuf:"bytes,1,opt,name=module,proto3" json:"module,omitempty"`
+	Rock    string `protobuf:"bytes,2,opt,name=rock,proto3" json:"rock,omitempty"`
+	Version string `protobuf:"bytes,3,opt,name=version,proto3" json:"version,omitempty"`
+}
+
+func (x *NativeModule) Reset() {
+	*x = NativeModule{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_rockamalg_proto_msgTypes[3]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *NativeModule) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*NativeModule) ProtoMessage() {}
+
+func (x *NativeModule) ProtoReflect() protoreflect.Message {
+	mi := &file_rockamalg_proto_msgTypes[3]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use NativeModule.ProtoReflect.Descriptor instead.
+func (*NativeModule) Descriptor() ([]byte, []int) {
+	return file_rockamalg_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *NativeModule) GetModule() string {
+	if x != nil {
+		return x.Module
+	}
+	return ""
+}
+
+func (x *NativeModule) GetRock() string {
+	if x != nil {
+		return x.Rock
+	}
+	return ""
+}
+
+func (x *NativeModule) GetVersion() string {
+	if x != nil {
+		return x.Version
+	}
+	return ""
+}
+
+// NativeModulesError is attached to FailedPrecondition status of Amalg,
+// if rocks install native modules and they are not allowed.
+type NativeModulesError struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Modules []*NativeModule `protobuf:"bytes,1,rep,name=modules,proto3" json:"modules,omitempty"`
+}
+
+func (x *NativeModulesError) Reset() {
+	*x = NativeModulesError{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_rockamalg_proto_msgTypes[4]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *NativeModulesError) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*NativeModulesError) ProtoMessage() {}
+
+func (x *NativeModulesError) ProtoReflect() protoreflect.Message {
+	mi := &file_rockamalg_proto_msgTypes[4]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use NativeModulesError.ProtoReflect.Descriptor instead.
+func (*NativeModulesError) Descriptor() ([]byte, []int) {
+	return file_rockamalg_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *NativeModulesError) GetModules() []*NativeModule {
+	if x != nil {
+		return x.Modules
+	}
+	return nil
+}
+
+type GraphRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	LuaFile              []byte      `protobuf:"bytes,1,opt,name=lua_file,json=luaFile,proto3" json:"lua_file,omitempty"`
+	LuaDir               []byte      `protobuf:"bytes,2,opt,name=lua_dir,json=luaDir,proto3" json:"lua_dir,omitempty"`
+	Dependencies         []string    `protobuf:"bytes,3,rep,name=dependencies,proto3" json:"dependencies,omitempty"`
+	Rockspec             []byte      `protobuf:"bytes,4,opt,name=rockspec,proto3" json:"rockspec,omitempty"`
+	AllowDevDependencies bool        `protobuf:"varint,5,opt,name=allow_dev_dependencies,json=allowDevDependencies,proto3" json:"allow_dev_dependencies,omitempty"`
+	Vendor               []byte      `protobuf:"bytes,6,opt,name=vendor,proto3" json:"vendor,omitempty"`
+	LuaVersion           string      `protobuf:"bytes,7,opt,name=lua_version,json=luaVersion,proto3" json:"lua_version,omitempty"`
+	Format               GraphFormat `protobuf:"varint,8,opt,name=format,proto3,enum=rockamalg.rpc.GraphFormat" json:"format,omitempty"`
+	SearchPath           string      `protobuf:"bytes,9,opt,name=search_path,json=searchPath,proto3" json:"search_path,omitempty"`
+	// allow_legacy_vendor is the same as in AmalgRequest.
+	AllowLegacyVendor bool `protobuf:"varint,10,opt,name=allow_legacy_vendor,json=allowLegacyVendor,proto3" json:"allow_legacy_vendor,omitempty"`
 }
 
-func (x *AmalgRequest) Reset() {
-	*x = AmalgRequest{}
+func (x *GraphRequest) Reset() {
+	*x = GraphRequest{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_rockamalg_proto_msgTypes[0]
+		mi := &file_rockamalg_proto_msgTypes[5]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
 }
 
-func (x *AmalgRequest) String() string {
+func (x *GraphRequest) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*AmalgRequest) ProtoMessage() {}
+func (*GraphRequest) ProtoMessage() {}
 
-func (x *AmalgRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_rockamalg_proto_msgTypes[0]
+func (x *GraphRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_rockamalg_proto_msgTypes[5]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -63,93 +703,155 @@ func (x *AmalgRequest) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use AmalgRequest.ProtoReflect.Descriptor instead.
-func (*AmalgRequest) Descriptor() ([]byte, []int) {
-	return file_rockamalg_proto_rawDescGZIP(), []int{0}
+// Deprecated: Use GraphRequest.ProtoReflect.Descriptor instead.
+func (*GraphRequest) Descriptor() ([]byte, []int) {
+	return file_rockamalg_proto_rawDescGZIP(), []int{5}
 }
 
-func (x *AmalgRequest) GetLuaFile() []byte {
+func (x *GraphRequest) GetLuaFile() []byte {
 	if x != nil {
 		return x.LuaFile
 	}
 	return nil
 }
 
-func (x *AmalgRequest) GetLuaDir() []byte {
+func (x *GraphRequest) GetLuaDir() []byte {
 	if x != nil {
 		return x.LuaDir
 	}
 	return nil
 }
 
-func (x *AmalgRequest) GetDependencies() []string {
+func (x *GraphRequest) GetDependencies() []string {
 	if x != nil {
 		return x.Dependencies
 	}
 	return nil
 }
 
-func (x *AmalgRequest) GetRockspec() []byte {
+func (x *GraphRequest) GetRockspec() []byte {
 	if x != nil {
 		return x.Rockspec
 	}
 	return nil
 }
 
-func (x *AmalgRequest) GetIsolate() bool {
+func (x *GraphRequest) GetAllowDevDependencies() bool {
 	if x != nil {
-		return x.Isolate
+		return x.AllowDevDependencies
 	}
 	return false
 }
 
-func (x *AmalgRequest) GetDisableDebug() bool {
+func (x *GraphRequest) GetVendor() []byte {
 	if x != nil {
-		return x.DisableDebug
+		return x.Vendor
 	}
-	return false
+	return nil
 }
 
-func (x *AmalgRequest) GetAllowDevDependencies() bool {
+func (x *GraphRequest) GetLuaVersion() string {
 	if x != nil {
-		return x.AllowDevDependencies
+		return x.LuaVersion
+	}
+	return ""
+}
+
+func (x *GraphRequest) GetFormat() GraphFormat {
+	if x != nil {
+		return x.Format
+	}
+	return GraphFormat_GRAPH_FORMAT_DOT
+}
+
+func (x *GraphRequest) GetSearchPath() string {
+	if x != nil {
+		return x.SearchPath
+	}
+	return ""
+}
+
+func (x *GraphRequest) GetAllowLegacyVendor() bool {
+	if x != nil {
+		return x.AllowLegacyVendor
 	}
 	return false
 }
 
-func (x *AmalgRequest) GetVendor() []byte {
+type GraphResponse struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Graph []byte `protobuf:"bytes,1,opt,name=graph,proto3" json:"graph,omitempty"`
+}
+
+func (x *GraphResponse) Reset() {
+	*x = GraphResponse{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_rockamalg_proto_msgTypes[6]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *GraphResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GraphResponse) ProtoMessage() {}
+
+func (x *GraphResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_rockamalg_proto_msgTypes[6]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GraphResponse.ProtoReflect.Descriptor instead.
+func (*GraphResponse) Descriptor() ([]byte, []int) {
+	return file_rockamalg_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *GraphResponse) GetGraph() []byte {
 	if x != nil {
-		return x.Vendor
+		return x.Graph
 	}
 	return nil
 }
 
-type AmalgResponse struct {
+// AmalgBatchRequest amalgamates several targets. Dependencies are installed once
+// for targets with the same dependencies, vendor and lockfile.
+type AmalgBatchRequest struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
 	unknownFields protoimpl.UnknownFields
 
-	Lua    []byte `protobuf:"bytes,1,opt,name=lua,proto3" json:"lua,omitempty"`
-	Vendor []byte `protobuf:"bytes,2,opt,name=vendor,proto3" json:"vendor,omitempty"`
+	Targets []*AmalgRequest `protobuf:"bytes,1,rep,name=targets,proto3" json:"targets,omitempty"`
 }
 
-func (x *AmalgResponse) Reset() {
-	*x = AmalgResponse{}
+func (x *AmalgBatchRequest) Reset() {
+	*x = AmalgBatchRequest{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_rockamalg_proto_msgTypes[1]
+		mi := &file_rockamalg_proto_msgTypes[7]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
 }
 
-func (x *AmalgResponse) String() string {
+func (x *AmalgBatchRequest) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*AmalgResponse) ProtoMessage() {}
+func (*AmalgBatchRequest) ProtoMessage() {}
 
-func (x *AmalgResponse) ProtoReflect() protoreflect.Message {
-	mi := &file_rockamalg_proto_msgTypes[1]
+func (x *AmalgBatchRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_rockamalg_proto_msgTypes[7]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -160,32 +862,138 @@ func (x *AmalgResponse) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use AmalgResponse.ProtoReflect.Descriptor instead.
-func (*AmalgResponse) Descriptor() ([]byte, []int) {
-	return file_rockamalg_proto_rawDescGZIP(), []int{1}
+// Deprecated: Use AmalgBatchRequest.ProtoReflect.Descriptor instead.
+func (*AmalgBatchRequest) Descriptor() ([]byte, []int) {
+	return file_rockamalg_proto_rawDescGZIP(), []int{7}
 }
 
-func (x *AmalgResponse) GetLua() []byte {
+func (x *AmalgBatchRequest) GetTargets() []*AmalgRequest {
 	if x != nil {
-		return x.Lua
+		return x.Targets
 	}
 	return nil
 }
 
-func (x *AmalgResponse) GetVendor() []byte {
+type AmalgBatchResponse struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// results are in the same order as targets.
+	Results []*AmalgBatchResult `protobuf:"bytes,1,rep,name=results,proto3" json:"results,omitempty"`
+}
+
+func (x *AmalgBatchResponse) Reset() {
+	*x = AmalgBatchResponse{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_rockamalg_proto_msgTypes[8]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *AmalgBatchResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AmalgBatchResponse) ProtoMessage() {}
+
+func (x *AmalgBatchResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_rockamalg_proto_msgTypes[8]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AmalgBatchResponse.ProtoReflect.Descriptor instead.
+func (*AmalgBatchResponse) Descriptor() ([]byte, []int) {
+	return file_rockamalg_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *AmalgBatchResponse) GetResults() []*AmalgBatchResult {
 	if x != nil {
-		return x.Vendor
+		return x.Results
+	}
+	return nil
+}
+
+// AmalgBatchResult holds either the response or the error of the target.
+type AmalgBatchResult struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Response *AmalgResponse `protobuf:"bytes,1,opt,name=response,proto3" json:"response,omitempty"`
+	// error_code is the gRPC status code of the failed target.
+	ErrorCode uint32 `protobuf:"varint,2,opt,name=error_code,json=errorCode,proto3" json:"error_code,omitempty"`
+	Error     string `protobuf:"bytes,3,opt,name=error,proto3" json:"error,omitempty"`
+}
+
+func (x *AmalgBatchResult) Reset() {
+	*x = AmalgBatchResult{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_rockamalg_proto_msgTypes[9]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *AmalgBatchResult) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AmalgBatchResult) ProtoMessage() {}
+
+func (x *AmalgBatchResult) ProtoReflect() protoreflect.Message {
+	mi := &file_rockamalg_proto_msgTypes[9]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AmalgBatchResult.ProtoReflect.Descriptor instead.
+func (*AmalgBatchResult) Descriptor() ([]byte, []int) {
+	return file_rockamalg_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *AmalgBatchResult) GetResponse() *AmalgResponse {
+	if x != nil {
+		return x.Response
 	}
 	return nil
 }
 
+func (x *AmalgBatchResult) GetErrorCode() uint32 {
+	if x != nil {
+		return x.ErrorCode
+	}
+	return 0
+}
+
+func (x *AmalgBatchResult) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
 var File_rockamalg_proto protoreflect.FileDescriptor
 
 var file_rockamalg_proto_rawDesc = []byte{
 	0x0a, 0x0f, 0x72, 0x6f, 0x63, 0x6b, 0x61, 0x6d, 0x61, 0x6c, 0x67, 0x2e, 0x70, 0x72, 0x6f, 0x74,
 	0x6f, 0x12, 0x0d, 0x72, 0x6f, 0x63, 0x6b, 0x61, 0x6d, 0x61, 0x6c, 0x67, 0x2e, 0x72, 0x70, 0x63,
 	0x1a, 0x1b, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2f, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75,
-	0x66, 0x2f, 0x65, 0x6d, 0x70, 0x74, 0x79, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x22, 0x8f, 0x02,
+	0x66, 0x2f, 0x65, 0x6d, 0x70, 0x74, 0x79, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x22, 0xda, 0x06,
 	0x0a, 0x0c, 0x41, 0x6d, 0x61, 0x6c, 0x67, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x19,
 	0x0a, 0x08, 0x6c, 0x75, 0x61, 0x5f, 0x66, 0x69, 0x6c, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0c,
 	0x52, 0x07, 0x6c, 0x75, 0x61, 0x46, 0x69, 0x6c, 0x65, 0x12, 0x17, 0x0a, 0x07, 0x6c, 0x75, 0x61,
@@ -202,22 +1010,156 @@ var file_rockamalg_proto_rawDesc = []byte{
 	0x65, 0x70, 0x65, 0x6e, 0x64, 0x65, 0x6e, 0x63, 0x69, 0x65, 0x73, 0x18, 0x07, 0x20, 0x01, 0x28,
 	0x08, 0x52, 0x14, 0x61, 0x6c, 0x6c, 0x6f, 0x77, 0x44, 0x65, 0x76, 0x44, 0x65, 0x70, 0x65, 0x6e,
 	0x64, 0x65, 0x6e, 0x63, 0x69, 0x65, 0x73, 0x12, 0x16, 0x0a, 0x06, 0x76, 0x65, 0x6e, 0x64, 0x6f,
-	0x72, 0x18, 0x08, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x06, 0x76, 0x65, 0x6e, 0x64, 0x6f, 0x72, 0x22,
-	0x39, 0x0a, 0x0d, 0x41, 0x6d, 0x61, 0x6c, 0x67, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65,
-	0x12, 0x10, 0x0a, 0x03, 0x6c, 0x75, 0x61, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x03, 0x6c,
-	0x75, 0x61, 0x12, 0x16, 0x0a, 0x06, 0x76, 0x65, 0x6e, 0x64, 0x6f, 0x72, 0x18, 0x02, 0x20, 0x01,
-	0x28, 0x0c, 0x52, 0x06, 0x76, 0x65, 0x6e, 0x64, 0x6f, 0x72, 0x32, 0x8b, 0x01, 0x0a, 0x09, 0x52,
-	0x6f, 0x63, 0x6b, 0x61, 0x6d, 0x61, 0x6c, 0x67, 0x12, 0x38, 0x0a, 0x04, 0x50, 0x69, 0x6e, 0x67,
-	0x12, 0x16, 0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62,
-	0x75, 0x66, 0x2e, 0x45, 0x6d, 0x70, 0x74, 0x79, 0x1a, 0x16, 0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c,
-	0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e, 0x45, 0x6d, 0x70, 0x74, 0x79,
-	0x22, 0x00, 0x12, 0x44, 0x0a, 0x05, 0x41, 0x6d, 0x61, 0x6c, 0x67, 0x12, 0x1b, 0x2e, 0x72, 0x6f,
-	0x63, 0x6b, 0x61, 0x6d, 0x61, 0x6c, 0x67, 0x2e, 0x72, 0x70, 0x63, 0x2e, 0x41, 0x6d, 0x61, 0x6c,
-	0x67, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x1c, 0x2e, 0x72, 0x6f, 0x63, 0x6b, 0x61,
-	0x6d, 0x61, 0x6c, 0x67, 0x2e, 0x72, 0x70, 0x63, 0x2e, 0x41, 0x6d, 0x61, 0x6c, 0x67, 0x52, 0x65,
-	0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x22, 0x00, 0x42, 0x10, 0x5a, 0x0e, 0x2e, 0x3b, 0x72, 0x6f,
-	0x63, 0x6b, 0x61, 0x6d, 0x61, 0x6c, 0x67, 0x72, 0x70, 0x63, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74,
-	0x6f, 0x33,
+	0x72, 0x18, 0x08, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x06, 0x76, 0x65, 0x6e, 0x64, 0x6f, 0x72, 0x12,
+	0x16, 0x0a, 0x06, 0x73, 0x74, 0x72, 0x69, 0x63, 0x74, 0x18, 0x09, 0x20, 0x01, 0x28, 0x08, 0x52,
+	0x06, 0x73, 0x74, 0x72, 0x69, 0x63, 0x74, 0x12, 0x29, 0x0a, 0x10, 0x61, 0x6c, 0x6c, 0x6f, 0x77,
+	0x5f, 0x75, 0x6e, 0x72, 0x65, 0x73, 0x6f, 0x6c, 0x76, 0x65, 0x64, 0x18, 0x0a, 0x20, 0x03, 0x28,
+	0x09, 0x52, 0x0f, 0x61, 0x6c, 0x6c, 0x6f, 0x77, 0x55, 0x6e, 0x72, 0x65, 0x73, 0x6f, 0x6c, 0x76,
+	0x65, 0x64, 0x12, 0x1f, 0x0a, 0x0b, 0x6c, 0x75, 0x61, 0x5f, 0x76, 0x65, 0x72, 0x73, 0x69, 0x6f,
+	0x6e, 0x18, 0x0b, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0a, 0x6c, 0x75, 0x61, 0x56, 0x65, 0x72, 0x73,
+	0x69, 0x6f, 0x6e, 0x12, 0x30, 0x0a, 0x14, 0x61, 0x6c, 0x6c, 0x6f, 0x77, 0x5f, 0x6e, 0x61, 0x74,
+	0x69, 0x76, 0x65, 0x5f, 0x6d, 0x6f, 0x64, 0x75, 0x6c, 0x65, 0x73, 0x18, 0x0c, 0x20, 0x01, 0x28,
+	0x08, 0x52, 0x12, 0x61, 0x6c, 0x6c, 0x6f, 0x77, 0x4e, 0x61, 0x74, 0x69, 0x76, 0x65, 0x4d, 0x6f,
+	0x64, 0x75, 0x6c, 0x65, 0x73, 0x12, 0x1f, 0x0a, 0x0b, 0x73, 0x65, 0x61, 0x72, 0x63, 0x68, 0x5f,
+	0x70, 0x61, 0x74, 0x68, 0x18, 0x0d, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0a, 0x73, 0x65, 0x61, 0x72,
+	0x63, 0x68, 0x50, 0x61, 0x74, 0x68, 0x12, 0x18, 0x0a, 0x07, 0x62, 0x61, 0x63, 0x6b, 0x65, 0x6e,
+	0x64, 0x18, 0x0e, 0x20, 0x01, 0x28, 0x09, 0x52, 0x07, 0x62, 0x61, 0x63, 0x6b, 0x65, 0x6e, 0x64,
+	0x12, 0x16, 0x0a, 0x06, 0x6d, 0x69, 0x6e, 0x69, 0x66, 0x79, 0x18, 0x0f, 0x20, 0x01, 0x28, 0x08,
+	0x52, 0x06, 0x6d, 0x69, 0x6e, 0x69, 0x66, 0x79, 0x12, 0x23, 0x0a, 0x0d, 0x6d, 0x69, 0x6e, 0x69,
+	0x66, 0x79, 0x5f, 0x6c, 0x6f, 0x63, 0x61, 0x6c, 0x73, 0x18, 0x10, 0x20, 0x01, 0x28, 0x08, 0x52,
+	0x0c, 0x6d, 0x69, 0x6e, 0x69, 0x66, 0x79, 0x4c, 0x6f, 0x63, 0x61, 0x6c, 0x73, 0x12, 0x37, 0x0a,
+	0x08, 0x62, 0x79, 0x74, 0x65, 0x63, 0x6f, 0x64, 0x65, 0x18, 0x11, 0x20, 0x01, 0x28, 0x0e, 0x32,
+	0x1b, 0x2e, 0x72, 0x6f, 0x63, 0x6b, 0x61, 0x6d, 0x61, 0x6c, 0x67, 0x2e, 0x72, 0x70, 0x63, 0x2e,
+	0x42, 0x79, 0x74, 0x65, 0x63, 0x6f, 0x64, 0x65, 0x4d, 0x6f, 0x64, 0x65, 0x52, 0x08, 0x62, 0x79,
+	0x74, 0x65, 0x63, 0x6f, 0x64, 0x65, 0x12, 0x1d, 0x0a, 0x0a, 0x73, 0x6f, 0x75, 0x72, 0x63, 0x65,
+	0x5f, 0x6d, 0x61, 0x70, 0x18, 0x12, 0x20, 0x01, 0x28, 0x08, 0x52, 0x09, 0x73, 0x6f, 0x75, 0x72,
+	0x63, 0x65, 0x4d, 0x61, 0x70, 0x12, 0x1a, 0x0a, 0x08, 0x6c, 0x6f, 0x63, 0x6b, 0x66, 0x69, 0x6c,
+	0x65, 0x18, 0x13, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x08, 0x6c, 0x6f, 0x63, 0x6b, 0x66, 0x69, 0x6c,
+	0x65, 0x12, 0x16, 0x0a, 0x06, 0x6c, 0x6f, 0x63, 0x6b, 0x65, 0x64, 0x18, 0x14, 0x20, 0x01, 0x28,
+	0x08, 0x52, 0x06, 0x6c, 0x6f, 0x63, 0x6b, 0x65, 0x64, 0x12, 0x1d, 0x0a, 0x0a, 0x62, 0x75, 0x69,
+	0x6c, 0x64, 0x5f, 0x69, 0x6e, 0x66, 0x6f, 0x18, 0x15, 0x20, 0x01, 0x28, 0x08, 0x52, 0x09, 0x62,
+	0x75, 0x69, 0x6c, 0x64, 0x49, 0x6e, 0x66, 0x6f, 0x12, 0x23, 0x0a, 0x0d, 0x62, 0x75, 0x69, 0x6c,
+	0x64, 0x5f, 0x76, 0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e, 0x18, 0x16, 0x20, 0x01, 0x28, 0x09, 0x52,
+	0x0c, 0x62, 0x75, 0x69, 0x6c, 0x64, 0x56, 0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e, 0x12, 0x18, 0x0a,
+	0x07, 0x6f, 0x66, 0x66, 0x6c, 0x69, 0x6e, 0x65, 0x18, 0x17, 0x20, 0x01, 0x28, 0x08, 0x52, 0x07,
+	0x6f, 0x66, 0x66, 0x6c, 0x69, 0x6e, 0x65, 0x12, 0x21, 0x0a, 0x0c, 0x70, 0x72, 0x75, 0x6e, 0x65,
+	0x5f, 0x76, 0x65, 0x6e, 0x64, 0x6f, 0x72, 0x18, 0x18, 0x20, 0x01, 0x28, 0x08, 0x52, 0x0b, 0x70,
+	0x72, 0x75, 0x6e, 0x65, 0x56, 0x65, 0x6e, 0x64, 0x6f, 0x72, 0x12, 0x2e, 0x0a, 0x13, 0x61, 0x6c,
+	0x6c, 0x6f, 0x77, 0x5f, 0x6c, 0x65, 0x67, 0x61, 0x63, 0x79, 0x5f, 0x76, 0x65, 0x6e, 0x64, 0x6f,
+	0x72, 0x18, 0x19, 0x20, 0x01, 0x28, 0x08, 0x52, 0x11, 0x61, 0x6c, 0x6c, 0x6f, 0x77, 0x4c, 0x65,
+	0x67, 0x61, 0x63, 0x79, 0x56, 0x65, 0x6e, 0x64, 0x6f, 0x72, 0x22, 0x85, 0x03, 0x0a, 0x0d, 0x41,
+	0x6d, 0x61, 0x6c, 0x67, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x10, 0x0a, 0x03,
+	0x6c, 0x75, 0x61, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x03, 0x6c, 0x75, 0x61, 0x12, 0x16,
+	0x0a, 0x06, 0x76, 0x65, 0x6e, 0x64, 0x6f, 0x72, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x06,
+	0x76, 0x65, 0x6e, 0x64, 0x6f, 0x72, 0x12, 0x29, 0x0a, 0x10, 0x64, 0x79, 0x6e, 0x61, 0x6d, 0x69,
+	0x63, 0x5f, 0x72, 0x65, 0x71, 0x75, 0x69, 0x72, 0x65, 0x73, 0x18, 0x03, 0x20, 0x03, 0x28, 0x09,
+	0x52, 0x0f, 0x64, 0x79, 0x6e, 0x61, 0x6d, 0x69, 0x63, 0x52, 0x65, 0x71, 0x75, 0x69, 0x72, 0x65,
+	0x73, 0x12, 0x42, 0x0a, 0x0e, 0x6e, 0x61, 0x74, 0x69, 0x76, 0x65, 0x5f, 0x6d, 0x6f, 0x64, 0x75,
+	0x6c, 0x65, 0x73, 0x18, 0x04, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x1b, 0x2e, 0x72, 0x6f, 0x63, 0x6b,
+	0x61, 0x6d, 0x61, 0x6c, 0x67, 0x2e, 0x72, 0x70, 0x63, 0x2e, 0x4e, 0x61, 0x74, 0x69, 0x76, 0x65,
+	0x4d, 0x6f, 0x64, 0x75, 0x6c, 0x65, 0x52, 0x0d, 0x6e, 0x61, 0x74, 0x69, 0x76, 0x65, 0x4d, 0x6f,
+	0x64, 0x75, 0x6c, 0x65, 0x73, 0x12, 0x1a, 0x0a, 0x08, 0x62, 0x79, 0x74, 0x65, 0x63, 0x6f, 0x64,
+	0x65, 0x18, 0x05, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x08, 0x62, 0x79, 0x74, 0x65, 0x63, 0x6f, 0x64,
+	0x65, 0x12, 0x1d, 0x0a, 0x0a, 0x73, 0x6f, 0x75, 0x72, 0x63, 0x65, 0x5f, 0x6d, 0x61, 0x70, 0x18,
+	0x06, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x09, 0x73, 0x6f, 0x75, 0x72, 0x63, 0x65, 0x4d, 0x61, 0x70,
+	0x12, 0x1d, 0x0a, 0x0a, 0x6c, 0x75, 0x61, 0x5f, 0x73, 0x68, 0x61, 0x32, 0x35, 0x36, 0x18, 0x07,
+	0x20, 0x01, 0x28, 0x09, 0x52, 0x09, 0x6c, 0x75, 0x61, 0x53, 0x68, 0x61, 0x32, 0x35, 0x36, 0x12,
+	0x27, 0x0a, 0x0f, 0x62, 0x79, 0x74, 0x65, 0x63, 0x6f, 0x64, 0x65, 0x5f, 0x73, 0x68, 0x61, 0x32,
+	0x35, 0x36, 0x18, 0x08, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0e, 0x62, 0x79, 0x74, 0x65, 0x63, 0x6f,
+	0x64, 0x65, 0x53, 0x68, 0x61, 0x32, 0x35, 0x36, 0x12, 0x1a, 0x0a, 0x08, 0x6c, 0x6f, 0x63, 0x6b,
+	0x66, 0x69, 0x6c, 0x65, 0x18, 0x09, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x08, 0x6c, 0x6f, 0x63, 0x6b,
+	0x66, 0x69, 0x6c, 0x65, 0x12, 0x3c, 0x0a, 0x0c, 0x70, 0x72, 0x75, 0x6e, 0x65, 0x64, 0x5f, 0x72,
+	0x6f, 0x63, 0x6b, 0x73, 0x18, 0x0a, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x19, 0x2e, 0x72, 0x6f, 0x63,
+	0x6b, 0x61, 0x6d, 0x61, 0x6c, 0x67, 0x2e, 0x72, 0x70, 0x63, 0x2e, 0x50, 0x72, 0x75, 0x6e, 0x65,
+	0x64, 0x52, 0x6f, 0x63, 0x6b, 0x52, 0x0b, 0x70, 0x72, 0x75, 0x6e, 0x65, 0x64, 0x52, 0x6f, 0x63,
+	0x6b, 0x73, 0x22, 0x3a, 0x0a, 0x0a, 0x50, 0x72, 0x75, 0x6e, 0x65, 0x64, 0x52, 0x6f, 0x63, 0x6b,
+	0x12, 0x12, 0x0a, 0x04, 0x72, 0x6f, 0x63, 0x6b, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04,
+	0x72, 0x6f, 0x63, 0x6b, 0x12, 0x18, 0x0a, 0x07, 0x76, 0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e, 0x18,
+	0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x07, 0x76, 0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e, 0x22, 0x54,
+	0x0a, 0x0c, 0x4e, 0x61, 0x74, 0x69, 0x76, 0x65, 0x4d, 0x6f, 0x64, 0x75, 0x6c, 0x65, 0x12, 0x16,
+	0x0a, 0x06, 0x6d, 0x6f, 0x64, 0x75, 0x6c, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06,
+	0x6d, 0x6f, 0x64, 0x75, 0x6c, 0x65, 0x12, 0x12, 0x0a, 0x04, 0x72, 0x6f, 0x63, 0x6b, 0x18, 0x02,
+	0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x72, 0x6f, 0x63, 0x6b, 0x12, 0x18, 0x0a, 0x07, 0x76, 0x65,
+	0x72, 0x73, 0x69, 0x6f, 0x6e, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x07, 0x76, 0x65, 0x72,
+	0x73, 0x69, 0x6f, 0x6e, 0x22, 0x4b, 0x0a, 0x12, 0x4e, 0x61, 0x74, 0x69, 0x76, 0x65, 0x4d, 0x6f,
+	0x64, 0x75, 0x6c, 0x65, 0x73, 0x45, 0x72, 0x72, 0x6f, 0x72, 0x12, 0x35, 0x0a, 0x07, 0x6d, 0x6f,
+	0x64, 0x75, 0x6c, 0x65, 0x73, 0x18, 0x01, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x1b, 0x2e, 0x72, 0x6f,
+	0x63, 0x6b, 0x61, 0x6d, 0x61, 0x6c, 0x67, 0x2e, 0x72, 0x70, 0x63, 0x2e, 0x4e, 0x61, 0x74, 0x69,
+	0x76, 0x65, 0x4d, 0x6f, 0x64, 0x75, 0x6c, 0x65, 0x52, 0x07, 0x6d, 0x6f, 0x64, 0x75, 0x6c, 0x65,
+	0x73, 0x22, 0xf6, 0x02, 0x0a, 0x0c, 0x47, 0x72, 0x61, 0x70, 0x68, 0x52, 0x65, 0x71, 0x75, 0x65,
+	0x73, 0x74, 0x12, 0x19, 0x0a, 0x08, 0x6c, 0x75, 0x61, 0x5f, 0x66, 0x69, 0x6c, 0x65, 0x18, 0x01,
+	0x20, 0x01, 0x28, 0x0c, 0x52, 0x07, 0x6c, 0x75, 0x61, 0x46, 0x69, 0x6c, 0x65, 0x12, 0x17, 0x0a,
+	0x07, 0x6c, 0x75, 0x61, 0x5f, 0x64, 0x69, 0x72, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x06,
+	0x6c, 0x75, 0x61, 0x44, 0x69, 0x72, 0x12, 0x22, 0x0a, 0x0c, 0x64, 0x65, 0x70, 0x65, 0x6e, 0x64,
+	0x65, 0x6e, 0x63, 0x69, 0x65, 0x73, 0x18, 0x03, 0x20, 0x03, 0x28, 0x09, 0x52, 0x0c, 0x64, 0x65,
+	0x70, 0x65, 0x6e, 0x64, 0x65, 0x6e, 0x63, 0x69, 0x65, 0x73, 0x12, 0x1a, 0x0a, 0x08, 0x72, 0x6f,
+	0x63, 0x6b, 0x73, 0x70, 0x65, 0x63, 0x18, 0x04, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x08, 0x72, 0x6f,
+	0x63, 0x6b, 0x73, 0x70, 0x65, 0x63, 0x12, 0x34, 0x0a, 0x16, 0x61, 0x6c, 0x6c, 0x6f, 0x77, 0x5f,
+	0x64, 0x65, 0x76, 0x5f, 0x64, 0x65, 0x70, 0x65, 0x6e, 0x64, 0x65, 0x6e, 0x63, 0x69, 0x65, 0x73,
+	0x18, 0x05, 0x20, 0x01, 0x28, 0x08, 0x52, 0x14, 0x61, 0x6c, 0x6c, 0x6f, 0x77, 0x44, 0x65, 0x76,
+	0x44, 0x65, 0x70, 0x65, 0x6e, 0x64, 0x65, 0x6e, 0x63, 0x69, 0x65, 0x73, 0x12, 0x16, 0x0a, 0x06,
+	0x76, 0x65, 0x6e, 0x64, 0x6f, 0x72, 0x18, 0x06, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x06, 0x76, 0x65,
+	0x6e, 0x64, 0x6f, 0x72, 0x12, 0x1f, 0x0a, 0x0b, 0x6c, 0x75, 0x61, 0x5f, 0x76, 0x65, 0x72, 0x73,
+	0x69, 0x6f, 0x6e, 0x18, 0x07, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0a, 0x6c, 0x75, 0x61, 0x56, 0x65,
+	0x72, 0x73, 0x69, 0x6f, 0x6e, 0x12, 0x32, 0x0a, 0x06, 0x66, 0x6f, 0x72, 0x6d, 0x61, 0x74, 0x18,
+	0x08, 0x20, 0x01, 0x28, 0x0e, 0x32, 0x1a, 0x2e, 0x72, 0x6f, 0x63, 0x6b, 0x61, 0x6d, 0x61, 0x6c,
+	0x67, 0x2e, 0x72, 0x70, 0x63, 0x2e, 0x47, 0x72, 0x61, 0x70, 0x68, 0x46, 0x6f, 0x72, 0x6d, 0x61,
+	0x74, 0x52, 0x06, 0x66, 0x6f, 0x72, 0x6d, 0x61, 0x74, 0x12, 0x1f, 0x0a, 0x0b, 0x73, 0x65, 0x61,
+	0x72, 0x63, 0x68, 0x5f, 0x70, 0x61, 0x74, 0x68, 0x18, 0x09, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0a,
+	0x73, 0x65, 0x61, 0x72, 0x63, 0x68, 0x50, 0x61, 0x74, 0x68, 0x12, 0x2e, 0x0a, 0x13, 0x61, 0x6c,
+	0x6c, 0x6f, 0x77, 0x5f, 0x6c, 0x65, 0x67, 0x61, 0x63, 0x79, 0x5f, 0x76, 0x65, 0x6e, 0x64, 0x6f,
+	0x72, 0x18, 0x0a, 0x20, 0x01, 0x28, 0x08, 0x52, 0x11, 0x61, 0x6c, 0x6c, 0x6f, 0x77, 0x4c, 0x65,
+	0x67, 0x61, 0x63, 0x79, 0x56, 0x65, 0x6e, 0x64, 0x6f, 0x72, 0x22, 0x25, 0x0a, 0x0d, 0x47, 0x72,
+	0x61, 0x70, 0x68, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x14, 0x0a, 0x05, 0x67,
+	0x72, 0x61, 0x70, 0x68, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x05, 0x67, 0x72, 0x61, 0x70,
+	0x68, 0x22, 0x4a, 0x0a, 0x11, 0x41, 0x6d, 0x61, 0x6c, 0x67, 0x42, 0x61, 0x74, 0x63, 0x68, 0x52,
+	0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x35, 0x0a, 0x07, 0x74, 0x61, 0x72, 0x67, 0x65, 0x74,
+	0x73, 0x18, 0x01, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x1b, 0x2e, 0x72, 0x6f, 0x63, 0x6b, 0x61, 0x6d,
+	0x61, 0x6c, 0x67, 0x2e, 0x72, 0x70, 0x63, 0x2e, 0x41, 0x6d, 0x61, 0x6c, 0x67, 0x52, 0x65, 0x71,
+	0x75, 0x65, 0x73, 0x74, 0x52, 0x07, 0x74, 0x61, 0x72, 0x67, 0x65, 0x74, 0x73, 0x22, 0x4f, 0x0a,
+	0x12, 0x41, 0x6d, 0x61, 0x6c, 0x67, 0x42, 0x61, 0x74, 0x63, 0x68, 0x52, 0x65, 0x73, 0x70, 0x6f,
+	0x6e, 0x73, 0x65, 0x12, 0x39, 0x0a, 0x07, 0x72, 0x65, 0x73, 0x75, 0x6c, 0x74, 0x73, 0x18, 0x01,
+	0x20, 0x03, 0x28, 0x0b, 0x32, 0x1f, 0x2e, 0x72, 0x6f, 0x63, 0x6b, 0x61, 0x6d, 0x61, 0x6c, 0x67,
+	0x2e, 0x72, 0x70, 0x63, 0x2e, 0x41, 0x6d, 0x61, 0x6c, 0x67, 0x42, 0x61, 0x74, 0x63, 0x68, 0x52,
+	0x65, 0x73, 0x75, 0x6c, 0x74, 0x52, 0x07, 0x72, 0x65, 0x73, 0x75, 0x6c, 0x74, 0x73, 0x22, 0x81,
+	0x01, 0x0a, 0x10, 0x41, 0x6d, 0x61, 0x6c, 0x67, 0x42, 0x61, 0x74, 0x63, 0x68, 0x52, 0x65, 0x73,
+	0x75, 0x6c, 0x74, 0x12, 0x38, 0x0a, 0x08, 0x72, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x18,
+	0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x1c, 0x2e, 0x72, 0x6f, 0x63, 0x6b, 0x61, 0x6d, 0x61, 0x6c,
+	0x67, 0x2e, 0x72, 0x70, 0x63, 0x2e, 0x41, 0x6d, 0x61, 0x6c, 0x67, 0x52, 0x65, 0x73, 0x70, 0x6f,
+	0x6e, 0x73, 0x65, 0x52, 0x08, 0x72, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x1d, 0x0a,
+	0x0a, 0x65, 0x72, 0x72, 0x6f, 0x72, 0x5f, 0x63, 0x6f, 0x64, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28,
+	0x0d, 0x52, 0x09, 0x65, 0x72, 0x72, 0x6f, 0x72, 0x43, 0x6f, 0x64, 0x65, 0x12, 0x14, 0x0a, 0x05,
+	0x65, 0x72, 0x72, 0x6f, 0x72, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x05, 0x65, 0x72, 0x72,
+	0x6f, 0x72, 0x2a, 0x5b, 0x0a, 0x0c, 0x42, 0x79, 0x74, 0x65, 0x63, 0x6f, 0x64, 0x65, 0x4d, 0x6f,
+	0x64, 0x65, 0x12, 0x16, 0x0a, 0x12, 0x42, 0x59, 0x54, 0x45, 0x43, 0x4f, 0x44, 0x45, 0x5f, 0x4d,
+	0x4f, 0x44, 0x45, 0x5f, 0x4e, 0x4f, 0x4e, 0x45, 0x10, 0x00, 0x12, 0x1b, 0x0a, 0x17, 0x42, 0x59,
+	0x54, 0x45, 0x43, 0x4f, 0x44, 0x45, 0x5f, 0x4d, 0x4f, 0x44, 0x45, 0x5f, 0x41, 0x4c, 0x4f, 0x4e,
+	0x47, 0x53, 0x49, 0x44, 0x45, 0x10, 0x01, 0x12, 0x16, 0x0a, 0x12, 0x42, 0x59, 0x54, 0x45, 0x43,
+	0x4f, 0x44, 0x45, 0x5f, 0x4d, 0x4f, 0x44, 0x45, 0x5f, 0x4f, 0x4e, 0x4c, 0x59, 0x10, 0x02, 0x2a,
+	0x3a, 0x0a, 0x0b, 0x47, 0x72, 0x61, 0x70, 0x68, 0x46, 0x6f, 0x72, 0x6d, 0x61, 0x74, 0x12, 0x14,
+	0x0a, 0x10, 0x47, 0x52, 0x41, 0x50, 0x48, 0x5f, 0x46, 0x4f, 0x52, 0x4d, 0x41, 0x54, 0x5f, 0x44,
+	0x4f, 0x54, 0x10, 0x00, 0x12, 0x15, 0x0a, 0x11, 0x47, 0x52, 0x41, 0x50, 0x48, 0x5f, 0x46, 0x4f,
+	0x52, 0x4d, 0x41, 0x54, 0x5f, 0x4a, 0x53, 0x4f, 0x4e, 0x10, 0x01, 0x32, 0xa6, 0x02, 0x0a, 0x09,
+	0x52, 0x6f, 0x63, 0x6b, 0x61, 0x6d, 0x61, 0x6c, 0x67, 0x12, 0x38, 0x0a, 0x04, 0x50, 0x69, 0x6e,
+	0x67, 0x12, 0x16, 0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f,
+	0x62, 0x75, 0x66, 0x2e, 0x45, 0x6d, 0x70, 0x74, 0x79, 0x1a, 0x16, 0x2e, 0x67, 0x6f, 0x6f, 0x67,
+	0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e, 0x45, 0x6d, 0x70, 0x74,
+	0x79, 0x22, 0x00, 0x12, 0x44, 0x0a, 0x05, 0x41, 0x6d, 0x61, 0x6c, 0x67, 0x12, 0x1b, 0x2e, 0x72,
+	0x6f, 0x63, 0x6b, 0x61, 0x6d, 0x61, 0x6c, 0x67, 0x2e, 0x72, 0x70, 0x63, 0x2e, 0x41, 0x6d, 0x61,
+	0x6c, 0x67, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x1c, 0x2e, 0x72, 0x6f, 0x63, 0x6b,
+	0x61, 0x6d, 0x61, 0x6c, 0x67, 0x2e, 0x72, 0x70, 0x63, 0x2e, 0x41, 0x6d, 0x61, 0x6c, 0x67, 0x52,
+	0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x22, 0x00, 0x12, 0x44, 0x0a, 0x05, 0x47, 0x72, 0x61,
+	0x70, 0x68, 0x12, 0x1b, 0x2e, 0x72, 0x6f, 0x63, 0x6b, 0x61, 0x6d, 0x61, 0x6c, 0x67, 0x2e, 0x72,
+	0x70, 0x63, 0x2e, 0x47, 0x72, 0x61, 0x70, 0x68, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a,
+	0x1c, 0x2e, 0x72, 0x6f, 0x63, 0x6b, 0x61, 0x6d, 0x61, 0x6c, 0x67, 0x2e, 0x72, 0x70, 0x63, 0x2e,
+	0x47, 0x72, 0x61, 0x70, 0x68, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x22, 0x00, 0x12,
+	0x53, 0x0a, 0x0a, 0x41, 0x6d, 0x61, 0x6c, 0x67, 0x42, 0x61, 0x74, 0x63, 0x68, 0x12, 0x20, 0x2e,
+	0x72, 0x6f, 0x63, 0x6b, 0x61, 0x6d, 0x61, 0x6c, 0x67, 0x2e, 0x72, 0x70, 0x63, 0x2e, 0x41, 0x6d,
+	0x61, 0x6c, 0x67, 0x42, 0x61, 0x74, 0x63, 0x68, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a,
+	0x21, 0x2e, 0x72, 0x6f, 0x63, 0x6b, 0x61, 0x6d, 0x61, 0x6c, 0x67, 0x2e, 0x72, 0x70, 0x63, 0x2e,
+	0x41, 0x6d, 0x61, 0x6c, 0x67, 0x42, 0x61, 0x74, 0x63, 0x68, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e,
+	0x73, 0x65, 0x22, 0x00, 0x42, 0x10, 0x5a, 0x0e, 0x2e, 0x3b, 0x72, 0x6f, 0x63, 0x6b, 0x61, 0x6d,
+	0x61, 0x6c, 0x67, 0x72, 0x70, 0x63, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
 }
 
 var (
@@ -232,22 +1174,45 @@ func file_rockamalg_proto_rawDescGZIP() []byte {
 	return file_rockamalg_proto_rawDescData
 }
 
-var file_rockamalg_proto_msgTypes = make([]protoimpl.MessageInfo, 2)
+var file_rockamalg_proto_enumTypes = make([]protoimpl.EnumInfo, 2)
+var file_rockamalg_proto_msgTypes = make([]protoimpl.MessageInfo, 10)
 var file_rockamalg_proto_goTypes = []interface{}{
-	(*AmalgRequest)(nil),  // 0: rockamalg.rpc.AmalgRequest
-	(*AmalgResponse)(nil), // 1: rockamalg.rpc.AmalgResponse
-	(*emptypb.Empty)(nil), // 2: google.protobuf.Empty
+	(BytecodeMode)(0),          // 0: rockamalg.rpc.BytecodeMode
+	(GraphFormat)(0),           // 1: rockamalg.rpc.GraphFormat
+	(*AmalgRequest)(nil),       // 2: rockamalg.rpc.AmalgRequest
+	(*AmalgResponse)(nil),      // 3: rockamalg.rpc.AmalgResponse
+	(*PrunedRock)(nil),         // 4: rockamalg.rpc.PrunedRock
+	(*NativeModule)(nil),       // 5: rockamalg.rpc.NativeModule
+	(*NativeModulesError)(nil), // 6: rockamalg.rpc.NativeModulesError
+	(*GraphRequest)(nil),       // 7: rockamalg.rpc.GraphRequest
+	(*GraphResponse)(nil),      // 8: rockamalg.rpc.GraphResponse
+	(*AmalgBatchRequest)(nil),  // 9: rockamalg.rpc.AmalgBatchRequest
+	(*AmalgBatchResponse)(nil), // 10: rockamalg.rpc.AmalgBatchResponse
+	(*AmalgBatchResult)(nil),   // 11: rockamalg.rpc.AmalgBatchResult
+	(*emptypb.Empty)(nil),      // 12: google.protobuf.Empty
 }
 var file_rockamalg_proto_depIdxs = []int32{
-	2, // 0: rockamalg.rpc.Rockamalg.Ping:input_type -> google.protobuf.Empty
-	0, // 1: rockamalg.rpc.Rockamalg.Amalg:input_type -> rockamalg.rpc.AmalgRequest
-	2, // 2: rockamalg.rpc.Rockamalg.Ping:output_type -> google.protobuf.Empty
-	1, // 3: rockamalg.rpc.Rockamalg.Amalg:output_type -> rockamalg.rpc.AmalgResponse
-	2, // [2:4] is the sub-list for method output_type
-	0, // [0:2] is the sub-list for method input_type
-	0, // [0:0] is the sub-list for extension type_name
-	0, // [0:0] is the sub-list for extension extendee
-	0, // [0:0] is the sub-list for field type_name
+	0,  // 0: rockamalg.rpc.AmalgRequest.bytecode:type_name -> rockamalg.rpc.BytecodeMode
+	5,  // 1: rockamalg.rpc.AmalgResponse.native_modules:type_name -> rockamalg.rpc.NativeModule
+	4,  // 2: rockamalg.rpc.AmalgResponse.pruned_rocks:type_name -> rockamalg.rpc.PrunedRock
+	5,  // 3: rockamalg.rpc.NativeModulesError.modules:type_name -> rockamalg.rpc.NativeModule
+	1,  // 4: rockamalg.rpc.GraphRequest.format:type_name -> rockamalg.rpc.GraphFormat
+	2,  // 5: rockamalg.rpc.AmalgBatchRequest.targets:type_name -> rockamalg.rpc.AmalgRequest
+	11, // 6: rockamalg.rpc.AmalgBatchResponse.results:type_name -> rockamalg.rpc.AmalgBatchResult
+	3,  // 7: rockamalg.rpc.AmalgBatchResult.response:type_name -> rockamalg.rpc.AmalgResponse
+	12, // 8: rockamalg.rpc.Rockamalg.Ping:input_type -> google.protobuf.Empty
+	2,  // 9: rockamalg.rpc.Rockamalg.Amalg:input_type -> rockamalg.rpc.AmalgRequest
+	7,  // 10: rockamalg.rpc.Rockamalg.Graph:input_type -> rockamalg.rpc.GraphRequest
+	9,  // 11: rockamalg.rpc.Rockamalg.AmalgBatch:input_type -> rockamalg.rpc.AmalgBatchRequest
+	12, // 12: rockamalg.rpc.Rockamalg.Ping:output_type -> google.protobuf.Empty
+	3,  // 13: rockamalg.rpc.Rockamalg.Amalg:output_type -> rockamalg.rpc.AmalgResponse
+	8,  // 14: rockamalg.rpc.Rockamalg.Graph:output_type -> rockamalg.rpc.GraphResponse
+	10, // 15: rockamalg.rpc.Rockamalg.AmalgBatch:output_type -> rockamalg.rpc.AmalgBatchResponse
+	12, // [12:16] is the sub-list for method output_type
+	8,  // [8:12] is the sub-list for method input_type
+	8,  // [8:8] is the sub-list for extension type_name
+	8,  // [8:8] is the sub-list for extension extendee
+	0,  // [0:8] is the sub-list for field type_name
 }
 
 func init() { file_rockamalg_proto_init() }
@@ -280,19 +1245,116 @@ func file_rockamalg_proto_init() {
 				return nil
 			}
 		}
+		file_rockamalg_proto_msgTypes[2].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*PrunedRock); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_rockamalg_proto_msgTypes[3].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*NativeModule); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_rockamalg_proto_msgTypes[4].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*NativeModulesError); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_rockamalg_proto_msgTypes[5].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*GraphRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_rockamalg_proto_msgTypes[6].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*GraphResponse); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_rockamalg_proto_msgTypes[7].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*AmalgBatchRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_rockamalg_proto_msgTypes[8].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*AmalgBatchResponse); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_rockamalg_proto_msgTypes[9].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*AmalgBatchResult); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
 	}
 	type x struct{}
 	out := protoimpl.TypeBuilder{
 		File: protoimpl.DescBuilder{
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: file_rockamalg_proto_rawDesc,
-			NumEnums:      0,
-			NumMessages:   2,
+			NumEnums:      2,
+			NumMessages:   10,
 			NumExtensions: 0,
 			NumServices:   1,
 		},
 		GoTypes:           file_rockamalg_proto_goTypes,
 		DependencyIndexes: file_rockamalg_proto_depIdxs,
+		EnumInfos:         file_rockamalg_proto_enumTypes,
 		MessageInfos:      file_rockamalg_proto_msgTypes,
 	}.Build()
 	File_rockamalg_proto = out.File
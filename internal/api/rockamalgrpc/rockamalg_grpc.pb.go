@@ -25,6 +25,8 @@ const _ = grpc.SupportPackageIsVersion7
 type RockamalgClient interface {
 	Ping(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*emptypb.Empty, error)
 	Amalg(ctx context.Context, in *AmalgRequest, opts ...grpc.CallOption) (*AmalgResponse, error)
+	Graph(ctx context.Context, in *GraphRequest, opts ...grpc.CallOption) (*GraphResponse, error)
+	AmalgBatch(ctx context.Context, in *AmalgBatchRequest, opts ...grpc.CallOption) (*AmalgBatchResponse, error)
 }
 
 type rockamalgClient struct {
@@ -53,12 +55,32 @@ func (c *rockamalgClient) Amalg(ctx context.Context, in *AmalgRequest, opts ...g
 	return out, nil
 }
 
+func (c *rockamalgClient) Graph(ctx context.Context, in *GraphRequest, opts ...grpc.CallOption) (*GraphResponse, error) {
+	out := new(GraphResponse)
+	err := c.cc.Invoke(ctx, "/rockamalg.rpc.Rockamalg/Graph", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *rockamalgClient) AmalgBatch(ctx context.Context, in *AmalgBatchRequest, opts ...grpc.CallOption) (*AmalgBatchResponse, error) {
+	out := new(AmalgBatchResponse)
+	err := c.cc.Invoke(ctx, "/rockamalg.rpc.Rockamalg/AmalgBatch", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // RockamalgServer is the server API for Rockamalg service.
 // All implementations must embed UnimplementedRockamalgServer
 // for forward compatibility
 type RockamalgServer interface {
 	Ping(context.Context, *emptypb.Empty) (*emptypb.Empty, error)
 	Amalg(context.Context, *AmalgRequest) (*AmalgResponse, error)
+	Graph(context.Context, *GraphRequest) (*GraphResponse, error)
+	AmalgBatch(context.Context, *AmalgBatchRequest) (*AmalgBatchResponse, error)
 	mustEmbedUnimplementedRockamalgServer()
 }
 
@@ -72,6 +94,12 @@ func (UnimplementedRockamalgServer) Ping(context.Context, *emptypb.Empty) (*empt
 func (UnimplementedRockamalgServer) Amalg(context.Context, *AmalgRequest) (*AmalgResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method Amalg not implemented")
 }
+func (UnimplementedRockamalgServer) Graph(context.Context, *GraphRequest) (*GraphResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Graph not implemented")
+}
+func (UnimplementedRockamalgServer) AmalgBatch(context.Context, *AmalgBatchRequest) (*AmalgBatchResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method AmalgBatch not implemented")
+}
 func (UnimplementedRockamalgServer) mustEmbedUnimplementedRockamalgServer() {}
 
 // UnsafeRockamalgServer may be embedded to opt out of forward compatibility for this service.
@@ -121,6 +149,42 @@ func _Rockamalg_Amalg_Handler(srv interface{}, ctx context.Context, dec func(int
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Rockamalg_Graph_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GraphRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RockamalgServer).Graph(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/rockamalg.rpc.Rockamalg/Graph",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RockamalgServer).Graph(ctx, req.(*GraphRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Rockamalg_AmalgBatch_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AmalgBatchRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RockamalgServer).AmalgBatch(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/rockamalg.rpc.Rockamalg/AmalgBatch",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RockamalgServer).AmalgBatch(ctx, req.(*AmalgBatchRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // Rockamalg_ServiceDesc is the grpc.ServiceDesc for Rockamalg service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -136,6 +200,14 @@ var Rockamalg_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "Amalg",
 			Handler:    _Rockamalg_Amalg_Handler,
 		},
+		{
+			MethodName: "Graph",
+			Handler:    _Rockamalg_Graph_Handler,
+		},
+		{
+			MethodName: "AmalgBatch",
+			Handler:    _Rockamalg_AmalgBatch_Handler,
+		},
 	},
 	Streams:  []grpc.StreamDesc{},
 	Metadata: "rockamalg.proto",
@@ -0,0 +1,71 @@
+package archive
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// CopyDir copies regular files of the directory keeping only the executable bit like archives do.
+func CopyDir(srcPath, dstPath string) error {
+	fsys := os.DirFS(srcPath)
+	return fs.WalkDir(fsys, ".", func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return fmt.Errorf("stat: %w", err)
+		}
+
+		dst := filepath.Join(dstPath, filepath.FromSlash(path))
+		if err := os.MkdirAll(filepath.Dir(dst), os.ModePerm); err != nil {
+			return fmt.Errorf("create dir: %w", err)
+		}
+
+		src, err := fsys.Open(path)
+		if err != nil {
+			return fmt.Errorf("open: %w", err)
+		}
+		defer src.Close()
+
+		dstFile, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, normalizedPerm(info.Mode()))
+		if err != nil {
+			return fmt.Errorf("create file: %w", err)
+		}
+		defer dstFile.Close()
+
+		if _, err := io.Copy(dstFile, src); err != nil {
+			return fmt.Errorf("copy: %w", err)
+		}
+		return dstFile.Close()
+	})
+}
+
+// DirToFilesMap reads regular files of the directory by slash separated paths.
+func DirToFilesMap(path string) (map[string][]byte, error) {
+	files := make(map[string][]byte)
+	fsys := os.DirFS(path)
+	err := fs.WalkDir(fsys, ".", func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+
+		data, err := fs.ReadFile(fsys, path)
+		if err != nil {
+			return fmt.Errorf("read: %w", err)
+		}
+		files[path] = data
+		return nil
+	})
+	return files, err
+}
@@ -0,0 +1,147 @@
+package archive
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// TarGzDirToFile archives files of the directory the same way as zip archives:
+// in the lexical order without timestamps and owners.
+func TarGzDirToFile(path, tarGzFilePath string) error {
+	file, err := os.Create(tarGzFilePath)
+	if err != nil {
+		return fmt.Errorf("creates archive file: %w", err)
+	}
+	defer file.Close()
+
+	gw := gzip.NewWriter(file)
+	tw := tar.NewWriter(gw)
+
+	fsys := os.DirFS(path)
+	err = fs.WalkDir(fsys, ".", func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return fmt.Errorf("stat: %w", err)
+		}
+
+		if err := tw.WriteHeader(&tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     path,
+			Size:     info.Size(),
+			Mode:     int64(normalizedPerm(info.Mode())),
+			ModTime:  archiveModified,
+			Format:   tar.FormatPAX,
+		}); err != nil {
+			return fmt.Errorf("write header: %w", err)
+		}
+
+		f, err := fsys.Open(path)
+		if err != nil {
+			return fmt.Errorf("open: %w", err)
+		}
+		defer f.Close()
+
+		if _, err := io.Copy(tw, f); err != nil {
+			return fmt.Errorf("copy: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		tw.Close()
+		gw.Close()
+		return err
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if err := gw.Close(); err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+func UntarGzFileToDir(tarGzFile, path string) error {
+	return readTarGzFile(tarGzFile, func(h *tar.Header, r io.Reader) error {
+		filePath, err := sanitizeArchivePath(path, h.Name)
+		if err != nil {
+			return err
+		}
+
+		if err := os.MkdirAll(filepath.Dir(filePath), os.ModePerm); err != nil {
+			return fmt.Errorf("create dir: %w", err)
+		}
+
+		dstFile, err := os.OpenFile(filePath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, h.FileInfo().Mode().Perm())
+		if err != nil {
+			return fmt.Errorf("create file: %w", err)
+		}
+		defer dstFile.Close()
+
+		//#nosec G110 -- this server for internal usage only and tests.
+		if _, err := io.Copy(dstFile, r); err != nil {
+			return fmt.Errorf("copy: %w", err)
+		}
+		return dstFile.Close()
+	})
+}
+
+func UntarGzFileToFilesMap(tarGzFile string) (map[string][]byte, error) {
+	files := make(map[string][]byte)
+	err := readTarGzFile(tarGzFile, func(h *tar.Header, r io.Reader) error {
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return fmt.Errorf("read archive file: %w", err)
+		}
+		files[h.Name] = data
+		return nil
+	})
+	return files, err
+}
+
+// readTarGzFile calls fn for regular files of the archive, other entries are skipped.
+func readTarGzFile(tarGzFile string, fn func(h *tar.Header, r io.Reader) error) error {
+	file, err := os.Open(tarGzFile)
+	if err != nil {
+		return fmt.Errorf("open archive file: %w", err)
+	}
+	defer file.Close()
+
+	gr, err := gzip.NewReader(file)
+	if err != nil {
+		return fmt.Errorf("create gzip reader: %w", err)
+	}
+	defer gr.Close()
+
+	tr := tar.NewReader(gr)
+	for {
+		h, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("read archive: %w", err)
+		}
+
+		if h.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		if err := fn(h, tr); err != nil {
+			return err
+		}
+	}
+}
@@ -10,6 +10,12 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
+)
+
+const (
+	filePerm     = 0o644
+	execFilePerm = 0o755
 )
 
 var errZipInvalidFilePath = errors.New("invalid file path in zip")
@@ -29,12 +35,26 @@ func ZipDirToFile(path, zipFilePath string) error {
 	return zipDir(path, file)
 }
 
+// archiveModified is the modification time of all archived files. Real times are not kept,
+// so archives of the same files are identical byte for byte.
+//
+//nolint:gochecknoglobals // constant time value
+var archiveModified = time.Date(1980, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// normalizedPerm keeps only the executable bit of the file mode, because other bits depend on umask.
+func normalizedPerm(mode fs.FileMode) fs.FileMode {
+	if mode&0o111 != 0 {
+		return execFilePerm
+	}
+	return filePerm
+}
+
+// zipDir archives files of the directory in the lexical order without timestamps and owners.
 func zipDir(path string, w io.Writer) error {
 	zw := zip.NewWriter(w)
-	defer zw.Close()
 
 	fsys := os.DirFS(path)
-	return fs.WalkDir(fsys, ".", func(path string, entry fs.DirEntry, err error) error {
+	err := fs.WalkDir(fsys, ".", func(path string, entry fs.DirEntry, err error) error {
 		if err != nil {
 			return err
 		}
@@ -48,7 +68,12 @@ func zipDir(path string, w io.Writer) error {
 		}
 		defer f.Close()
 
-		zf, err := zw.Create(path)
+		info, err := entry.Info()
+		if err != nil {
+			return fmt.Errorf("stat: %w", err)
+		}
+
+		zf, err := zw.CreateHeader(zipFileHeader(path, info.Mode()))
 		if err != nil {
 			return fmt.Errorf("create: %w", err)
 		}
@@ -58,6 +83,24 @@ func zipDir(path string, w io.Writer) error {
 		}
 		return nil
 	})
+	if err != nil {
+		zw.Close()
+		return err
+	}
+
+	return zw.Close()
+}
+
+// zipFileHeader is the header of the archived file with the fixed time and the normalized permissions.
+func zipFileHeader(path string, mode fs.FileMode) *zip.FileHeader {
+	h := &zip.FileHeader{
+		Name:     path,
+		Method:   zip.Deflate,
+		Modified: archiveModified,
+	}
+	h.SetMode(normalizedPerm(mode))
+
+	return h
 }
 
 func UnzipBytesToDir(data []byte, path string) error {
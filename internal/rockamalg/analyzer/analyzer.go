@@ -7,39 +7,138 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"runtime"
+	"sort"
 	"strings"
+	"sync"
 )
 
+// defaultSearchPath is used for the rocks tree and for the Lua directory by default.
+//
+//nolint:gochecknoglobals // read-only templates
+var defaultSearchPath = []string{"?.lua", "?/init.lua"}
+
+// Analyzer is safe for concurrent use. Requires of analyzed files are cached
+// by the file content and reused by subsequent analyses.
 type Analyzer struct {
-	resolver *resolver
-	parser   *parser
+	resolver     *resolver
+	parser       *parser
+	sourceParser *sourceParser
+	cache        *requiresCache
+	workers      int
 }
 
 func New() *Analyzer {
 	return &Analyzer{
-		resolver: newResolver(),
-		parser:   newParser(),
+		resolver:     newResolver(),
+		parser:       newParser(),
+		sourceParser: newSourceParser(),
+		cache:        newRequiresCache(),
+		workers:      runtime.GOMAXPROCS(0),
 	}
 }
 
-func (a *Analyzer) AnalyzeRequires(luaMain, luaDir, cacheTree string) ([]string, error) {
+// Result is a result of requires analysis.
+type Result struct {
+	// Requires are modules required by the main module directly or indirectly.
+	Requires []string
+	// DynamicRequires are requires with module names not known statically.
+	// Modules required this way are not included into Requires.
+	DynamicRequires []DynamicRequire
+	// Unresolved are modules found neither in the Lua directory nor in the rocks tree.
+	// Modules required only with pcall are not included, because they are optional.
+	Unresolved []string
+	// Modules are the main module and all modules required by it, including unresolved ones.
+	Modules []Module
+	// Dependencies are requires of modules by other modules.
+	Dependencies []Dependency
+}
+
+// ModuleKind tells where a module was found.
+type ModuleKind int
+
+const (
+	// ModuleLocal is a module from the Lua directory.
+	ModuleLocal ModuleKind = iota
+	// ModuleRock is a module from the rocks tree.
+	ModuleRock
+	// ModuleUnresolved is a module found nowhere.
+	ModuleUnresolved
+)
+
+// Module is a module met during analysis. File is shown the same way
+// as in DynamicRequire, Path is the real path of the file.
+// Both are empty for unresolved modules.
+// The main module is named after its file without the extension.
+type Module struct {
+	Name string
+	Kind ModuleKind
+	File string
+	Path string
+}
+
+// Dependency is a require of the module To by the module From.
+// Optional dependencies are required only with pcall.
+type Dependency struct {
+	From     string
+	To       string
+	Optional bool
+}
+
+// DynamicRequire is a location of require with module name not known statically.
+// File is relative to the Lua directory or prefixed with vendor for rocks modules.
+type DynamicRequire struct {
+	File string
+	Line int
+}
+
+func (d DynamicRequire) String() string {
+	return fmt.Sprintf("%s:%d: dynamic require", d.File, d.Line)
+}
+
+// AnalyzeRequires finds modules required by the main module written for the given Lua version.
+// Modules are searched in the rocks tree and then in the Lua directory with package.path-style
+// templates of searchPath, like "src/?.lua". If searchPath is empty, ?.lua and ?/init.lua are used.
+func (a *Analyzer) AnalyzeRequires(
+	luaMain, luaDir, cacheTree, luaVersion string, searchPath []string,
+) (Result, error) {
+	version, err := parseLuaVersion(luaVersion)
+	if err != nil {
+		return Result{}, err
+	}
+
+	if len(searchPath) == 0 {
+		searchPath = defaultSearchPath
+	}
+
 	an := analyzer{
-		cacheDir: filepath.Join(cacheTree, "share", "lua", "5.3"),
-		luaDir:   luaDir,
-		resolver: a.resolver,
-		parser:   a.parser,
-		analyzed: make(map[string]struct{}),
+		version:      version,
+		cacheTree:    cacheTree,
+		cacheDir:     filepath.Join(cacheTree, "share", "lua", version.String()),
+		luaDir:       luaDir,
+		searchPath:   searchPath,
+		resolver:     a.resolver,
+		parser:       a.parser,
+		sourceParser: a.sourceParser,
+		cache:        a.cache,
+		workers:      a.workers,
+		analyzed:     make(map[string]string),
+		missing:      make(map[string]struct{}),
+		unresolved:   make(map[string]struct{}),
 	}
 
-	requires, err := an.ExtractModuleRequires(filepath.Join(luaDir, luaMain))
+	mainPath := filepath.Join(luaDir, luaMain)
+	mainReqs, err := an.ExtractModuleRequires(mainPath)
 	if err != nil {
-		return requires, fmt.Errorf("extract requires from lua main: %w", err)
+		return Result{}, fmt.Errorf("extract requires from lua main: %w", err)
 	}
 
+	mainName := strings.TrimSuffix(luaMain, filepath.Ext(luaMain))
+	requires := an.collectRequires(mainName, mainPath, mainReqs)
 	for {
 		next, err := an.AnalyzeRequires(requires)
 		if err != nil {
-			return nil, fmt.Errorf("analyze requires: %w", err)
+			return Result{}, fmt.Errorf("analyze requires: %w", err)
 		}
 
 		if len(next) == 0 {
@@ -49,72 +148,254 @@ func (a *Analyzer) AnalyzeRequires(luaMain, luaDir, cacheTree string) ([]string,
 		requires = next
 	}
 
-	return an.Requires(), nil
+	sort.Slice(an.dynamic, func(i, j int) bool {
+		if an.dynamic[i].File != an.dynamic[j].File {
+			return an.dynamic[i].File < an.dynamic[j].File
+		}
+		return an.dynamic[i].Line < an.dynamic[j].Line
+	})
+
+	sort.Slice(an.dependencies, func(i, j int) bool {
+		if an.dependencies[i].From != an.dependencies[j].From {
+			return an.dependencies[i].From < an.dependencies[j].From
+		}
+		return an.dependencies[i].To < an.dependencies[j].To
+	})
+
+	return Result{
+		Requires:        an.Requires(),
+		DynamicRequires: an.dynamic,
+		Unresolved:      an.Unresolved(),
+		Modules:         an.Modules(mainName, mainPath),
+		Dependencies:    an.dependencies,
+	}, nil
 }
 
 type analyzer struct {
-	cacheDir string
-	luaDir   string
-	resolver *resolver
-	parser   *parser
-	analyzed map[string]struct{}
+	version      luaVersion
+	cacheTree    string
+	cacheDir     string
+	luaDir       string
+	searchPath   []string
+	resolver     *resolver
+	parser       *parser
+	sourceParser *sourceParser
+	cache        *requiresCache
+	workers      int
+	// analyzed holds source files of found modules
+	analyzed     map[string]string
+	missing      map[string]struct{}
+	unresolved   map[string]struct{}
+	dynamic      []DynamicRequire
+	dependencies []Dependency
 }
 
-func (a *analyzer) AnalyzeRequires(requires []string) ([]string, error) {
-	var next []string
+// AnalyzeRequires analyzes modules not met before concurrently and returns their requires.
+func (a *analyzer) AnalyzeRequires(requires []moduleRequire) ([]moduleRequire, error) {
+	var frontier []string
+	queued := make(map[string]struct{})
 	for _, req := range requires {
-		if _, ok := a.analyzed[req]; ok {
+		if _, ok := a.analyzed[req.name]; ok {
 			continue
 		}
+		if _, ok := a.missing[req.name]; ok {
+			continue
+		}
+		if _, ok := queued[req.name]; ok {
+			continue
+		}
+		queued[req.name] = struct{}{}
+		frontier = append(frontier, req.name)
+	}
 
-		sf, err := a.findSourceFile(req)
-		if err != nil {
-			return nil, fmt.Errorf("module=%s, find source file: %w", req, err)
+	var next []moduleRequire
+	for i, m := range a.analyzeModules(frontier) {
+		name := frontier[i]
+		if m.err != nil {
+			return nil, fmt.Errorf("module=%s, %w", name, m.err)
 		}
 
-		if sf == "" {
+		if m.path == "" {
+			a.missing[name] = struct{}{}
 			continue
 		}
 
-		nextReqs, err := a.ExtractModuleRequires(sf)
-		if err != nil {
-			return nil, fmt.Errorf("module=%s, extract requires: %w", req, err)
-		}
+		next = append(next, a.collectRequires(name, m.path, m.requires)...)
+		a.analyzed[name] = m.path
+	}
 
-		next = append(next, nextReqs...)
-		a.analyzed[req] = struct{}{}
+	for _, req := range requires {
+		if _, ok := a.missing[req.name]; ok && !req.optional {
+			a.unresolved[req.name] = struct{}{}
+		}
 	}
 
 	return next, nil
 }
 
-func (a *analyzer) ExtractModuleRequires(path string) ([]string, error) {
+type moduleAnalysis struct {
+	path     string
+	requires []moduleRequire
+	err      error
+}
+
+// analyzeModules finds and analyzes modules with a bounded pool of workers.
+// Results are in the same order as names to keep the analysis deterministic.
+func (a *analyzer) analyzeModules(names []string) []moduleAnalysis {
+	results := make([]moduleAnalysis, len(names))
+	indexes := make(chan int)
+
+	var wg sync.WaitGroup
+	for range min(a.workers, len(names)) {
+		wg.Go(func() {
+			for i := range indexes {
+				results[i] = a.analyzeModule(names[i])
+			}
+		})
+	}
+
+	for i := range names {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	return results
+}
+
+func (a *analyzer) analyzeModule(name string) moduleAnalysis {
+	sf, err := a.findSourceFile(name)
+	if err != nil {
+		return moduleAnalysis{err: fmt.Errorf("find source file: %w", err)}
+	}
+
+	if sf == "" {
+		return moduleAnalysis{}
+	}
+
+	requires, err := a.ExtractModuleRequires(sf)
+	if err != nil {
+		return moduleAnalysis{err: fmt.Errorf("extract requires: %w", err)}
+	}
+
+	return moduleAnalysis{path: sf, requires: requires}
+}
+
+// collectRequires returns static requires and keeps dependencies and dynamic requires of the module.
+func (a *analyzer) collectRequires(module, path string, requires []moduleRequire) []moduleRequire {
+	static := make([]moduleRequire, 0, len(requires))
+	for _, r := range requires {
+		if !r.dynamic {
+			static = append(static, r)
+			a.dependencies = append(a.dependencies, Dependency{From: module, To: r.name, Optional: r.optional})
+			continue
+		}
+
+		a.dynamic = append(a.dynamic, DynamicRequire{File: a.displayPath(path), Line: r.line})
+	}
+	return static
+}
+
+// displayPath returns the path of a module file as it is shown to users.
+func (a *analyzer) displayPath(path string) string {
+	if rel, err := filepath.Rel(a.luaDir, path); err == nil && !strings.HasPrefix(rel, "..") {
+		return rel
+	}
+	if rel, err := filepath.Rel(a.cacheTree, path); err == nil && !strings.HasPrefix(rel, "..") {
+		return filepath.Join("vendor", rel)
+	}
+	return path
+}
+
+// ExtractModuleRequires parses the module source to find its requires.
+// If the source could not be parsed, luac listing is used as a fallback.
+// Requires of the same source are taken from the cache.
+func (a *analyzer) ExtractModuleRequires(path string) ([]moduleRequire, error) {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("path=%s, read source: %w", path, err)
+	}
+
+	if requires, ok := a.cache.Get(src, a.version); ok {
+		return requires, nil
+	}
+
+	var requires []moduleRequire
+	if chunk, parseErr := a.sourceParser.ParseSource(src, a.version); parseErr == nil {
+		requires = a.resolver.ResolveSourceRequires(chunk, a.version)
+	} else if requires, err = a.extractListingRequires(path); err != nil {
+		return nil, fmt.Errorf("path=%s, parse source: %w", path, errors.Join(parseErr, err))
+	}
+
+	a.cache.Put(src, a.version, requires)
+
+	return requires, nil
+}
+
+func (a *analyzer) extractListingRequires(path string) ([]moduleRequire, error) {
 	buf, err := a.generateBytecodeListing(path)
 	if err != nil {
-		return nil, fmt.Errorf("path=%s, generate bytecode: %w", path, err)
+		return nil, fmt.Errorf("generate bytecode: %w", err)
 	}
 
-	listing, err := a.parser.ParseListing(buf)
+	listing, err := a.parser.ParseListing(buf, a.version)
 	if err != nil {
-		return nil, fmt.Errorf("path=%s, parse listing: %w", path, err)
+		return nil, fmt.Errorf("parse listing: %w", err)
 	}
 
-	return a.resolver.ResolveListingRequires(listing)
+	return a.resolver.ResolveListingRequires(listing, a.version)
 }
 
+// Requires returns names of all analyzed modules sorted, so results do not depend on the map order.
 func (a *analyzer) Requires() []string {
 	s := make([]string, 0, len(a.analyzed))
 	for v := range a.analyzed {
 		s = append(s, v)
 	}
+	sort.Strings(s)
 	return s
 }
 
-func (*analyzer) generateBytecodeListing(path string) (*bytes.Buffer, error) {
+// Modules returns the main module and all met modules sorted by name.
+func (a *analyzer) Modules(mainName, mainPath string) []Module {
+	modules := make([]Module, 0, len(a.analyzed)+len(a.missing)+1)
+	modules = append(modules, Module{
+		Name: mainName, Kind: ModuleLocal, File: a.displayPath(mainPath), Path: mainPath,
+	})
+
+	for name, path := range a.analyzed {
+		kind := ModuleLocal
+		if strings.HasPrefix(path, a.cacheDir) {
+			kind = ModuleRock
+		}
+		modules = append(modules, Module{Name: name, Kind: kind, File: a.displayPath(path), Path: path})
+	}
+
+	for name := range a.missing {
+		if _, ok := a.analyzed[name]; !ok {
+			modules = append(modules, Module{Name: name, Kind: ModuleUnresolved})
+		}
+	}
+
+	sort.Slice(modules, func(i, j int) bool { return modules[i].Name < modules[j].Name })
+
+	return modules
+}
+
+func (a *analyzer) Unresolved() []string {
+	s := make([]string, 0, len(a.unresolved))
+	for v := range a.unresolved {
+		s = append(s, v)
+	}
+	sort.Strings(s)
+	return s
+}
+
+func (a *analyzer) generateBytecodeListing(path string) (*bytes.Buffer, error) {
 	stdout := bytes.Buffer{}
 	stderr := bytes.Buffer{}
 
-	cmd := exec.Command("luac5.3", "-l", "-l", "-p", path)
+	cmd := exec.Command("luac"+a.version.String(), "-l", "-l", "-p", path)
 	cmd.Stdout = &stdout
 	cmd.Stderr = &stderr
 
@@ -127,25 +408,32 @@ func (*analyzer) generateBytecodeListing(path string) (*bytes.Buffer, error) {
 
 func (a *analyzer) findSourceFile(require string) (string, error) {
 	p := strings.ReplaceAll(require, ".", "/")
-	for _, sp := range []string{p + ".lua", filepath.Join(p, "init.lua")} {
-		p := filepath.Join(a.cacheDir, sp)
-		if exists, err := isExists(p); err != nil {
-			return "", err
-		} else if exists {
-			return p, nil
+
+	for _, t := range defaultSearchPath {
+		if sf, err := findTemplateFile(a.cacheDir, t, p); sf != "" || err != nil {
+			return sf, err
 		}
+	}
 
-		p = filepath.Join(a.luaDir, sp)
-		if exists, err := isExists(p); err != nil {
-			return "", err
-		} else if exists {
-			return p, nil
+	for _, t := range a.searchPath {
+		if sf, err := findTemplateFile(a.luaDir, t, p); sf != "" || err != nil {
+			return sf, err
 		}
 	}
 
 	return "", nil
 }
 
+func findTemplateFile(dir, template, name string) (string, error) {
+	p := filepath.Join(dir, strings.ReplaceAll(template, "?", name))
+	if exists, err := isExists(p); err != nil {
+		return "", err
+	} else if exists {
+		return p, nil
+	}
+	return "", nil
+}
+
 func isExists(path string) (bool, error) {
 	_, err := os.Stat(path)
 	if err == nil {
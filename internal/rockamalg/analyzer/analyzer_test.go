@@ -0,0 +1,105 @@
+package analyzer_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/enapter/rockamalg/internal/rockamalg/analyzer"
+)
+
+func TestAnalyzeRequires(t *testing.T) {
+	t.Parallel()
+
+	res, err := analyzer.New().AnalyzeRequires(
+		"main.lua", "testdata/requires/lua", "testdata/requires/tree", "5.3", nil)
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"app", "app.config", "app.helpers", "app.logger", "app.version", "rock", "rock.util",
+	}, res.Requires)
+	require.Equal(t, []analyzer.DynamicRequire{
+		{File: "app/helpers.lua", Line: 4},
+		{File: "vendor/share/lua/5.3/rock/util.lua", Line: 5},
+	}, res.DynamicRequires)
+	require.Equal(t, []string{"app.syslog", "os"}, res.Unresolved)
+	require.Equal(t, []analyzer.Dependency{
+		{From: "app.logger", To: "app.syslog"},
+		{From: "app.logger", To: "os"},
+		{From: "main", To: "app"},
+		{From: "main", To: "app.config"},
+		{From: "main", To: "app.helpers"},
+		{From: "main", To: "app.logger", Optional: true},
+		{From: "main", To: "app.version"},
+		{From: "main", To: "json", Optional: true},
+		{From: "main", To: "rock"},
+		{From: "rock", To: "rock.util"},
+	}, res.Dependencies)
+	require.Contains(t, res.Modules, analyzer.Module{
+		Name: "rock.util", Kind: analyzer.ModuleRock, File: "vendor/share/lua/5.3/rock/util.lua",
+		Path: "testdata/requires/tree/share/lua/5.3/rock/util.lua",
+	})
+	require.Contains(t, res.Modules, analyzer.Module{Name: "json", Kind: analyzer.ModuleUnresolved})
+}
+
+func TestAnalyzeRequiresLuaVersion(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		luaVersion string
+		luaMain    string
+		unresolved []string
+	}{
+		{luaVersion: "5.1", luaMain: "lua51.lua", unresolved: []string{"mod1"}},
+		{luaVersion: "5.4", luaMain: "lua54.lua", unresolved: []string{"mod1.0"}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.luaVersion, func(t *testing.T) {
+			t.Parallel()
+
+			res, err := analyzer.New().AnalyzeRequires(
+				tc.luaMain, "testdata/versions", "testdata/versions", tc.luaVersion, nil)
+			require.NoError(t, err)
+			require.Equal(t, tc.unresolved, res.Unresolved)
+		})
+	}
+}
+
+func TestAnalyzeRequiresShared(t *testing.T) {
+	t.Parallel()
+
+	an := analyzer.New()
+	expected, err := an.AnalyzeRequires(
+		"main.lua", "testdata/requires/lua", "testdata/requires/tree", "5.3", nil)
+	require.NoError(t, err)
+
+	for i := 0; i < 4; i++ {
+		t.Run(fmt.Sprintf("run %d", i), func(t *testing.T) {
+			t.Parallel()
+
+			res, err := an.AnalyzeRequires(
+				"main.lua", "testdata/requires/lua", "testdata/requires/tree", "5.3", nil)
+			require.NoError(t, err)
+			require.Equal(t, expected.Requires, res.Requires)
+			require.Equal(t, expected.DynamicRequires, res.DynamicRequires)
+			require.Equal(t, expected.Unresolved, res.Unresolved)
+			require.Equal(t, expected.Modules, res.Modules)
+			require.Equal(t, expected.Dependencies, res.Dependencies)
+		})
+	}
+}
+
+func TestAnalyzeRequiresSearchPath(t *testing.T) {
+	t.Parallel()
+
+	res, err := analyzer.New().AnalyzeRequires(
+		"main.lua", "testdata/searchpath", "testdata/requires/tree", "5.3", []string{"src/?.lua", "lib/?/init.lua"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"app", "app.config", "json", "rock", "rock.util"}, res.Requires)
+	require.Empty(t, res.Unresolved)
+	require.Contains(t, res.Modules, analyzer.Module{
+		Name: "json", Kind: analyzer.ModuleLocal, File: "lib/json/init.lua",
+		Path: "testdata/searchpath/lib/json/init.lua",
+	})
+}
@@ -0,0 +1,51 @@
+package analyzer
+
+import (
+	"crypto/sha256"
+	"sync"
+)
+
+// maxCachedSources limits memory used by the cache of a long running server.
+const maxCachedSources = 4096
+
+type requiresCacheKey struct {
+	hash    [sha256.Size]byte
+	version luaVersion
+}
+
+// requiresCache keeps requires of analyzed sources by the source content hash,
+// so the same files met in different analyses are not parsed again.
+type requiresCache struct {
+	mu      sync.Mutex
+	entries map[requiresCacheKey][]moduleRequire
+}
+
+func newRequiresCache() *requiresCache {
+	return &requiresCache{
+		entries: make(map[requiresCacheKey][]moduleRequire),
+	}
+}
+
+func (c *requiresCache) Get(src []byte, version luaVersion) ([]moduleRequire, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	requires, ok := c.entries[requiresCacheKey{hash: sha256.Sum256(src), version: version}]
+	return requires, ok
+}
+
+// Put stores requires of the source. When the cache is full an arbitrary entry is evicted.
+func (c *requiresCache) Put(src []byte, version luaVersion, requires []moduleRequire) {
+	key := requiresCacheKey{hash: sha256.Sum256(src), version: version}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.entries[key]; !ok && len(c.entries) >= maxCachedSources {
+		for k := range c.entries {
+			delete(c.entries, k)
+			break
+		}
+	}
+	c.entries[key] = requires
+}
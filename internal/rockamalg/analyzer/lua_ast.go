@@ -0,0 +1,308 @@
+package analyzer
+
+// The AST below covers the whole Lua 5.1-5.4 grammar, but keeps only the details
+// that are needed to analyze requires. Every name is bound to its local
+// variable during parsing, so that a global can be told apart from a local
+// with the same name without a separate resolution pass.
+
+type block struct {
+	stats []stat
+}
+
+type stat interface {
+	statNode()
+}
+
+type expr interface {
+	exprNode()
+}
+
+// localVar is a single local variable declaration.
+// Names referring to the variable share the same pointer.
+type localVar struct {
+	name string
+	line int
+	// assigned is set when the variable is a target of an assignment
+	// somewhere after the declaration.
+	assigned bool
+}
+
+type (
+	localStat struct {
+		vars  []*localVar
+		exprs []expr
+	}
+
+	assignStat struct {
+		targets []expr
+		exprs   []expr
+	}
+
+	callStat struct {
+		call expr
+	}
+
+	doStat struct {
+		body *block
+	}
+
+	whileStat struct {
+		cond expr
+		body *block
+	}
+
+	repeatStat struct {
+		body *block
+		cond expr
+	}
+
+	ifStat struct {
+		conds    []expr
+		blocks   []*block
+		elseBody *block
+	}
+
+	numericForStat struct {
+		v     *localVar
+		start expr
+		limit expr
+		step  expr
+		body  *block
+	}
+
+	genericForStat struct {
+		vars  []*localVar
+		exprs []expr
+		body  *block
+	}
+
+	functionStat struct {
+		target expr
+		fn     *functionExpr
+	}
+
+	localFunctionStat struct {
+		v  *localVar
+		fn *functionExpr
+	}
+
+	returnStat struct {
+		exprs []expr
+	}
+
+	breakStat struct{}
+
+	gotoStat struct {
+		label string
+	}
+
+	labelStat struct {
+		name string
+	}
+)
+
+func (*localStat) statNode()         {}
+func (*assignStat) statNode()        {}
+func (*callStat) statNode()          {}
+func (*doStat) statNode()            {}
+func (*whileStat) statNode()         {}
+func (*repeatStat) statNode()        {}
+func (*ifStat) statNode()            {}
+func (*numericForStat) statNode()    {}
+func (*genericForStat) statNode()    {}
+func (*functionStat) statNode()      {}
+func (*localFunctionStat) statNode() {}
+func (*returnStat) statNode()        {}
+func (*breakStat) statNode()         {}
+func (*gotoStat) statNode()          {}
+func (*labelStat) statNode()         {}
+
+type (
+	nilExpr    struct{}
+	trueExpr   struct{}
+	falseExpr  struct{}
+	varargExpr struct{}
+
+	numberExpr struct {
+		value string
+	}
+
+	stringExpr struct {
+		value string
+	}
+
+	// nameExpr is a variable reference. Local is nil for globals.
+	// Env is the local _ENV in scope, if any: a global name
+	// with a local _ENV is not a field of the global environment.
+	nameExpr struct {
+		name  string
+		local *localVar
+		env   *localVar
+		line  int
+	}
+
+	indexExpr struct {
+		obj expr
+		key expr
+	}
+
+	callExpr struct {
+		fn   expr
+		args []expr
+		line int
+	}
+
+	methodCallExpr struct {
+		obj    expr
+		method string
+		args   []expr
+		line   int
+	}
+
+	functionExpr struct {
+		params   []*localVar
+		isVararg bool
+		body     *block
+	}
+
+	tableExpr struct {
+		fields []tableField
+	}
+
+	binopExpr struct {
+		op  string
+		lhs expr
+		rhs expr
+	}
+
+	unopExpr struct {
+		op      string
+		operand expr
+	}
+
+	parenExpr struct {
+		inner expr
+	}
+)
+
+// tableField is a table constructor field. Key is nil for positional fields.
+type tableField struct {
+	key   expr
+	value expr
+}
+
+func (*nilExpr) exprNode()        {}
+func (*trueExpr) exprNode()       {}
+func (*falseExpr) exprNode()      {}
+func (*varargExpr) exprNode()     {}
+func (*numberExpr) exprNode()     {}
+func (*stringExpr) exprNode()     {}
+func (*nameExpr) exprNode()       {}
+func (*indexExpr) exprNode()      {}
+func (*callExpr) exprNode()       {}
+func (*methodCallExpr) exprNode() {}
+func (*functionExpr) exprNode()   {}
+func (*tableExpr) exprNode()      {}
+func (*binopExpr) exprNode()      {}
+func (*unopExpr) exprNode()       {}
+func (*parenExpr) exprNode()      {}
+
+// isGlobal reports whether e is a reference to the global variable with the given name.
+func isGlobal(e expr, name string) bool {
+	n, ok := e.(*nameExpr)
+	return ok && n.local == nil && n.env == nil && n.name == name
+}
+
+// inspectBlock traverses the block in depth-first order calling fn for each statement and expression.
+// Children of a node are skipped if fn returns false.
+func inspectBlock(b *block, fn func(node any) bool) {
+	if b == nil {
+		return
+	}
+	for _, st := range b.stats {
+		inspectStat(st, fn)
+	}
+}
+
+func inspectStat(st stat, fn func(node any) bool) {
+	if !fn(st) {
+		return
+	}
+
+	switch st := st.(type) {
+	case *localStat:
+		inspectExprs(st.exprs, fn)
+	case *assignStat:
+		inspectExprs(st.targets, fn)
+		inspectExprs(st.exprs, fn)
+	case *callStat:
+		inspectExpr(st.call, fn)
+	case *doStat:
+		inspectBlock(st.body, fn)
+	case *whileStat:
+		inspectExpr(st.cond, fn)
+		inspectBlock(st.body, fn)
+	case *repeatStat:
+		inspectBlock(st.body, fn)
+		inspectExpr(st.cond, fn)
+	case *ifStat:
+		for i := range st.conds {
+			inspectExpr(st.conds[i], fn)
+			inspectBlock(st.blocks[i], fn)
+		}
+		inspectBlock(st.elseBody, fn)
+	case *numericForStat:
+		inspectExprs([]expr{st.start, st.limit, st.step}, fn)
+		inspectBlock(st.body, fn)
+	case *genericForStat:
+		inspectExprs(st.exprs, fn)
+		inspectBlock(st.body, fn)
+	case *functionStat:
+		inspectExpr(st.target, fn)
+		inspectExpr(st.fn, fn)
+	case *localFunctionStat:
+		inspectExpr(st.fn, fn)
+	case *returnStat:
+		inspectExprs(st.exprs, fn)
+	case *breakStat, *gotoStat, *labelStat:
+	}
+}
+
+func inspectExprs(exprs []expr, fn func(node any) bool) {
+	for _, e := range exprs {
+		inspectExpr(e, fn)
+	}
+}
+
+func inspectExpr(e expr, fn func(node any) bool) {
+	if e == nil || !fn(e) {
+		return
+	}
+
+	switch e := e.(type) {
+	case *indexExpr:
+		inspectExpr(e.obj, fn)
+		inspectExpr(e.key, fn)
+	case *callExpr:
+		inspectExpr(e.fn, fn)
+		inspectExprs(e.args, fn)
+	case *methodCallExpr:
+		inspectExpr(e.obj, fn)
+		inspectExprs(e.args, fn)
+	case *functionExpr:
+		inspectBlock(e.body, fn)
+	case *tableExpr:
+		for _, f := range e.fields {
+			inspectExpr(f.key, fn)
+			inspectExpr(f.value, fn)
+		}
+	case *binopExpr:
+		inspectExpr(e.lhs, fn)
+		inspectExpr(e.rhs, fn)
+	case *unopExpr:
+		inspectExpr(e.operand, fn)
+	case *parenExpr:
+		inspectExpr(e.inner, fn)
+	case *nilExpr, *trueExpr, *falseExpr, *varargExpr, *numberExpr, *stringExpr, *nameExpr:
+	}
+}
@@ -0,0 +1,406 @@
+package analyzer
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenName
+	tokenString
+	tokenNumber
+	tokenKeyword
+	tokenSymbol
+)
+
+// token is a single lexical element of Lua source.
+// For strings value holds the decoded content, for other kinds it holds the raw text.
+// Pos and end are byte offsets of the token in the source.
+type token struct {
+	kind  tokenKind
+	value string
+	line  int
+	pos   int
+	end   int
+}
+
+func (t token) is(kind tokenKind, value string) bool {
+	return t.kind == kind && t.value == value
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case tokenEOF:
+		return "<eof>"
+	case tokenString:
+		return strconv.Quote(t.value)
+	case tokenName, tokenNumber, tokenKeyword, tokenSymbol:
+	}
+	return t.value
+}
+
+//nolint:gochecknoglobals // read-only lookup table
+var luaKeywords = map[string]struct{}{
+	"and": {}, "break": {}, "do": {}, "else": {}, "elseif": {}, "end": {},
+	"false": {}, "for": {}, "function": {}, "goto": {}, "if": {}, "in": {},
+	"local": {}, "nil": {}, "not": {}, "or": {}, "repeat": {}, "return": {},
+	"then": {}, "true": {}, "until": {}, "while": {},
+}
+
+// luaSymbols lists operators and punctuation, longest first so that
+// the lexer always takes the longest match.
+//
+//nolint:gochecknoglobals // read-only lookup table
+var luaSymbols = []string{
+	"...", "..", "==", "~=", "<=", ">=", "<<", ">>", "//", "::",
+	"+", "-", "*", "/", "%", "^", "#", "&", "~", "|", "<", ">", "=",
+	"(", ")", "{", "}", "[", "]", ";", ":", ",", ".",
+}
+
+// luaSymbolsSince holds the first version with the symbol, other symbols are in all versions.
+//
+//nolint:gochecknoglobals // read-only lookup table
+var luaSymbolsSince = map[string]luaVersion{
+	"::": lua52,
+	"<<": lua53, ">>": lua53, "//": lua53, "&": lua53, "~": lua53, "|": lua53,
+}
+
+var (
+	errUnfinishedString      = errors.New("unfinished string")
+	errUnfinishedLongString  = errors.New("unfinished long string")
+	errUnfinishedLongComment = errors.New("unfinished long comment")
+	errInvalidEscape         = errors.New("invalid escape sequence")
+	errMalformedNumber       = errors.New("malformed number")
+	errUnexpectedSymbol      = errors.New("unexpected symbol")
+)
+
+// lexer splits Lua source into tokens.
+type lexer struct {
+	src     string
+	pos     int
+	line    int
+	version luaVersion
+}
+
+func newLexer(src string, version luaVersion) *lexer {
+	l := &lexer{src: src, line: 1, version: version}
+	// Lua skips the first line of a chunk if it starts with '#'.
+	if strings.HasPrefix(src, "#") {
+		for l.pos < len(l.src) && !isNewline(l.src[l.pos]) {
+			l.pos++
+		}
+	}
+	return l
+}
+
+func (l *lexer) Next() (token, error) {
+	if err := l.skipSpacesAndComments(); err != nil {
+		return token{}, err
+	}
+
+	start, line := l.pos, l.line
+	if l.pos >= len(l.src) {
+		return token{kind: tokenEOF, line: line, pos: start, end: start}, nil
+	}
+
+	kind, value, err := l.scanToken()
+	if err != nil {
+		return token{}, l.buildError(line, err)
+	}
+
+	return token{kind: kind, value: value, line: line, pos: start, end: l.pos}, nil
+}
+
+func (l *lexer) scanToken() (tokenKind, string, error) {
+	c := l.src[l.pos]
+	switch {
+	case isNameStart(c):
+		name := l.scanName()
+		// goto is a keyword since Lua 5.2
+		if _, ok := luaKeywords[name]; ok && (name != "goto" || l.version >= lua52) {
+			return tokenKeyword, name, nil
+		}
+		return tokenName, name, nil
+	case isDigit(c) || (c == '.' && l.pos+1 < len(l.src) && isDigit(l.src[l.pos+1])):
+		num, err := l.scanNumber()
+		return tokenNumber, num, err
+	case c == '"' || c == '\'':
+		s, err := l.scanShortString(c)
+		return tokenString, s, err
+	case c == '[' && l.longBracketLevel() >= 0:
+		s, err := l.scanLongString(errUnfinishedLongString)
+		return tokenString, s, err
+	}
+
+	for _, sym := range luaSymbols {
+		if since, ok := luaSymbolsSince[sym]; ok && l.version < since {
+			continue
+		}
+		if strings.HasPrefix(l.src[l.pos:], sym) {
+			l.pos += len(sym)
+			return tokenSymbol, sym, nil
+		}
+	}
+
+	return tokenEOF, "", fmt.Errorf("%w near '%c'", errUnexpectedSymbol, c)
+}
+
+func (l *lexer) skipSpacesAndComments() error {
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+		switch {
+		case isNewline(c):
+			l.skipNewline()
+		case c == ' ' || c == '\t' || c == '\v' || c == '\f':
+			l.pos++
+		case strings.HasPrefix(l.src[l.pos:], "--"):
+			line := l.line
+			l.pos += 2
+			if l.pos < len(l.src) && l.src[l.pos] == '[' && l.longBracketLevel() >= 0 {
+				if _, err := l.scanLongString(errUnfinishedLongComment); err != nil {
+					return l.buildError(line, err)
+				}
+				continue
+			}
+			for l.pos < len(l.src) && !isNewline(l.src[l.pos]) {
+				l.pos++
+			}
+		default:
+			return nil
+		}
+	}
+	return nil
+}
+
+// skipNewline skips \n, \r, \n\r or \r\n and counts it as a single line break.
+func (l *lexer) skipNewline() {
+	c := l.src[l.pos]
+	l.pos++
+	if l.pos < len(l.src) && isNewline(l.src[l.pos]) && l.src[l.pos] != c {
+		l.pos++
+	}
+	l.line++
+}
+
+func (l *lexer) scanName() string {
+	start := l.pos
+	for l.pos < len(l.src) && (isNameStart(l.src[l.pos]) || isDigit(l.src[l.pos])) {
+		l.pos++
+	}
+	return l.src[start:l.pos]
+}
+
+func (l *lexer) scanNumber() (string, error) {
+	start := l.pos
+	expChars, isNumDigit := "Ee", isDigit
+	if strings.HasPrefix(l.src[l.pos:], "0x") || strings.HasPrefix(l.src[l.pos:], "0X") {
+		l.pos += 2
+		expChars, isNumDigit = "Pp", isHexDigit
+		if l.pos >= len(l.src) || (!isHexDigit(l.src[l.pos]) && l.src[l.pos] != '.') {
+			return l.src[start:l.pos], fmt.Errorf("%w near '%s'", errMalformedNumber, l.src[start:l.pos])
+		}
+	}
+
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+		switch {
+		case strings.IndexByte(expChars, c) >= 0:
+			l.pos++
+			if l.pos < len(l.src) && (l.src[l.pos] == '+' || l.src[l.pos] == '-') {
+				l.pos++
+			}
+		case isNumDigit(c) || c == '.':
+			l.pos++
+		default:
+			num := l.src[start:l.pos]
+			if isNameStart(c) || isDigit(c) {
+				return num, fmt.Errorf("%w near '%s'", errMalformedNumber, num+string(c))
+			}
+			return num, nil
+		}
+	}
+
+	return l.src[start:l.pos], nil
+}
+
+// longBracketLevel returns the level of the opening long bracket at the current position
+// or -1 if there is no valid long bracket.
+func (l *lexer) longBracketLevel() int {
+	p := l.pos + 1
+	for p < len(l.src) && l.src[p] == '=' {
+		p++
+	}
+	if p < len(l.src) && l.src[p] == '[' {
+		return p - l.pos - 1
+	}
+	return -1
+}
+
+func (l *lexer) scanLongString(errUnfinished error) (string, error) {
+	level := l.longBracketLevel()
+	l.pos += level + 2
+	if l.pos < len(l.src) && isNewline(l.src[l.pos]) {
+		l.skipNewline()
+	}
+
+	closing := "]" + strings.Repeat("=", level) + "]"
+	var sb strings.Builder
+	for l.pos < len(l.src) {
+		switch c := l.src[l.pos]; {
+		case strings.HasPrefix(l.src[l.pos:], closing):
+			l.pos += len(closing)
+			return sb.String(), nil
+		case isNewline(c):
+			l.skipNewline()
+			sb.WriteByte('\n')
+		default:
+			sb.WriteByte(c)
+			l.pos++
+		}
+	}
+
+	return "", errUnfinished
+}
+
+func (l *lexer) scanShortString(quote byte) (string, error) {
+	l.pos++
+
+	var sb strings.Builder
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+		switch {
+		case c == quote:
+			l.pos++
+			return sb.String(), nil
+		case isNewline(c):
+			return "", errUnfinishedString
+		case c == '\\':
+			if err := l.scanEscape(&sb); err != nil {
+				return "", err
+			}
+		default:
+			sb.WriteByte(c)
+			l.pos++
+		}
+	}
+
+	return "", errUnfinishedString
+}
+
+//nolint:gochecknoglobals // read-only lookup table
+var luaSimpleEscapes = map[byte]byte{
+	'a': '\a', 'b': '\b', 'f': '\f', 'n': '\n', 'r': '\r', 't': '\t', 'v': '\v',
+	'\\': '\\', '"': '"', '\'': '\'',
+}
+
+func (l *lexer) scanEscape(sb *strings.Builder) error {
+	l.pos++
+	if l.pos >= len(l.src) {
+		return errUnfinishedString
+	}
+
+	c := l.src[l.pos]
+	if r, ok := luaSimpleEscapes[c]; ok {
+		sb.WriteByte(r)
+		l.pos++
+		return nil
+	}
+
+	switch {
+	case isNewline(c):
+		l.skipNewline()
+		sb.WriteByte('\n')
+	case c == 'z' && l.version >= lua52:
+		l.pos++
+		for l.pos < len(l.src) && isSpace(l.src[l.pos]) {
+			if isNewline(l.src[l.pos]) {
+				l.skipNewline()
+			} else {
+				l.pos++
+			}
+		}
+	case c == 'x' && l.version >= lua52:
+		const hexEscapeLen = 2
+		if l.pos+hexEscapeLen >= len(l.src) {
+			return errInvalidEscape
+		}
+		v, err := strconv.ParseUint(l.src[l.pos+1:l.pos+1+hexEscapeLen], 16, 8)
+		if err != nil {
+			return fmt.Errorf("%w: %w", errInvalidEscape, err)
+		}
+		sb.WriteByte(byte(v))
+		l.pos += 1 + hexEscapeLen
+	case c == 'u' && l.version >= lua53:
+		return l.scanUTF8Escape(sb)
+	case isDigit(c):
+		const maxDecimalEscapeLen = 3
+		start := l.pos
+		for l.pos < len(l.src) && l.pos-start < maxDecimalEscapeLen && isDigit(l.src[l.pos]) {
+			l.pos++
+		}
+		v, err := strconv.ParseUint(l.src[start:l.pos], 10, 8)
+		if err != nil {
+			return fmt.Errorf("%w: %w", errInvalidEscape, err)
+		}
+		sb.WriteByte(byte(v))
+	case l.version == lua51:
+		// Lua 5.1 keeps the escaped character as is
+		sb.WriteByte(c)
+		l.pos++
+	default:
+		return fmt.Errorf("%w '\\%c'", errInvalidEscape, c)
+	}
+
+	return nil
+}
+
+func (l *lexer) scanUTF8Escape(sb *strings.Builder) error {
+	if !strings.HasPrefix(l.src[l.pos:], "u{") {
+		return errInvalidEscape
+	}
+
+	end := strings.IndexByte(l.src[l.pos:], '}')
+	if end < 0 {
+		return errInvalidEscape
+	}
+
+	v, err := strconv.ParseUint(l.src[l.pos+2:l.pos+end], 16, 32)
+	if err != nil || v > utf8.MaxRune {
+		return errInvalidEscape
+	}
+
+	sb.WriteRune(rune(v))
+	l.pos += end + 1
+
+	return nil
+}
+
+func (l *lexer) buildError(line int, err error) error {
+	return fmt.Errorf("line %d: %w", line, err)
+}
+
+func isNameStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isHexDigit(c byte) bool {
+	return isDigit(c) || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
+
+func isNewline(c byte) bool {
+	return c == '\n' || c == '\r'
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\v' || c == '\f' || isNewline(c)
+}
@@ -0,0 +1,226 @@
+package analyzer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLexer(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		src     string
+		version luaVersion
+		tokens  []token
+	}{
+		{
+			name:    "long brackets",
+			src:     "[[a]] [==[\nb]]c]=]d]==] [=[]=]",
+			version: lua53,
+			tokens: []token{
+				{kind: tokenString, value: "a", line: 1},
+				{kind: tokenString, value: "b]]c]=]d", line: 1},
+				{kind: tokenString, value: "", line: 2},
+			},
+		},
+		{
+			name:    "long comments",
+			src:     "--[==[ a\n]] ]==] x --[[\n]] y --[ z\nw",
+			version: lua53,
+			tokens: []token{
+				{kind: tokenName, value: "x", line: 2},
+				{kind: tokenName, value: "y", line: 3},
+				{kind: tokenName, value: "w", line: 4},
+			},
+		},
+		{
+			name:    "shebang",
+			src:     "#!/usr/bin/env lua\nx",
+			version: lua53,
+			tokens:  []token{{kind: tokenName, value: "x", line: 2}},
+		},
+		{
+			name:    "escapes",
+			src:     `"\a\n\\\"\'" "\z   ` + "\n" + `  a" "\x41\x6a" "\u{48}\u{10FFFF}" "\65\0489" "a\` + "\n" + `b"`,
+			version: lua53,
+			tokens: []token{
+				{kind: tokenString, value: "\a\n\\\"'", line: 1},
+				{kind: tokenString, value: "a", line: 1},
+				{kind: tokenString, value: "Aj", line: 2},
+				{kind: tokenString, value: "H\U0010FFFF", line: 2},
+				{kind: tokenString, value: "A09", line: 2},
+				{kind: tokenString, value: "a\nb", line: 2},
+			},
+		},
+		{
+			name:    "lua51 escapes",
+			src:     `"\z\x41\q"`,
+			version: lua51,
+			tokens:  []token{{kind: tokenString, value: "zx41q", line: 1}},
+		},
+		{
+			name:    "numerals",
+			src:     "3 345 0xff 0xBEBADA 3.0 3.1416 314.16e-2 0.31416E1 34e1 .5 0x0.1E 0xA23p-4 0X1.921FB54442D18P+1",
+			version: lua53,
+			tokens: []token{
+				{kind: tokenNumber, value: "3", line: 1},
+				{kind: tokenNumber, value: "345", line: 1},
+				{kind: tokenNumber, value: "0xff", line: 1},
+				{kind: tokenNumber, value: "0xBEBADA", line: 1},
+				{kind: tokenNumber, value: "3.0", line: 1},
+				{kind: tokenNumber, value: "3.1416", line: 1},
+				{kind: tokenNumber, value: "314.16e-2", line: 1},
+				{kind: tokenNumber, value: "0.31416E1", line: 1},
+				{kind: tokenNumber, value: "34e1", line: 1},
+				{kind: tokenNumber, value: ".5", line: 1},
+				{kind: tokenNumber, value: "0x0.1E", line: 1},
+				{kind: tokenNumber, value: "0xA23p-4", line: 1},
+				{kind: tokenNumber, value: "0X1.921FB54442D18P+1", line: 1},
+			},
+		},
+		{
+			name:    "goto and labels",
+			src:     "goto continue ::continue::",
+			version: lua52,
+			tokens: []token{
+				{kind: tokenKeyword, value: "goto", line: 1},
+				{kind: tokenName, value: "continue", line: 1},
+				{kind: tokenSymbol, value: "::", line: 1},
+				{kind: tokenName, value: "continue", line: 1},
+				{kind: tokenSymbol, value: "::", line: 1},
+			},
+		},
+		{
+			name:    "lua51 goto",
+			src:     "goto::",
+			version: lua51,
+			tokens: []token{
+				{kind: tokenName, value: "goto", line: 1},
+				{kind: tokenSymbol, value: ":", line: 1},
+				{kind: tokenSymbol, value: ":", line: 1},
+			},
+		},
+		{
+			name:    "lua53 operators",
+			src:     "a//b<<c>>d&e~f|g..h...",
+			version: lua53,
+			tokens: []token{
+				{kind: tokenName, value: "a", line: 1},
+				{kind: tokenSymbol, value: "//", line: 1},
+				{kind: tokenName, value: "b", line: 1},
+				{kind: tokenSymbol, value: "<<", line: 1},
+				{kind: tokenName, value: "c", line: 1},
+				{kind: tokenSymbol, value: ">>", line: 1},
+				{kind: tokenName, value: "d", line: 1},
+				{kind: tokenSymbol, value: "&", line: 1},
+				{kind: tokenName, value: "e", line: 1},
+				{kind: tokenSymbol, value: "~", line: 1},
+				{kind: tokenName, value: "f", line: 1},
+				{kind: tokenSymbol, value: "|", line: 1},
+				{kind: tokenName, value: "g", line: 1},
+				{kind: tokenSymbol, value: "..", line: 1},
+				{kind: tokenName, value: "h", line: 1},
+				{kind: tokenSymbol, value: "...", line: 1},
+			},
+		},
+		{
+			name:    "lua54 attribs",
+			src:     "local x <const>, y <close> = 1",
+			version: lua54,
+			tokens: []token{
+				{kind: tokenKeyword, value: "local", line: 1},
+				{kind: tokenName, value: "x", line: 1},
+				{kind: tokenSymbol, value: "<", line: 1},
+				{kind: tokenName, value: "const", line: 1},
+				{kind: tokenSymbol, value: ">", line: 1},
+				{kind: tokenSymbol, value: ",", line: 1},
+				{kind: tokenName, value: "y", line: 1},
+				{kind: tokenSymbol, value: "<", line: 1},
+				{kind: tokenName, value: "close", line: 1},
+				{kind: tokenSymbol, value: ">", line: 1},
+				{kind: tokenSymbol, value: "=", line: 1},
+				{kind: tokenNumber, value: "1", line: 1},
+			},
+		},
+		{
+			name:    "newlines",
+			src:     "a\r\nb\n\rc\n\nd\re",
+			version: lua53,
+			tokens: []token{
+				{kind: tokenName, value: "a", line: 1},
+				{kind: tokenName, value: "b", line: 2},
+				{kind: tokenName, value: "c", line: 3},
+				{kind: tokenName, value: "d", line: 5},
+				{kind: tokenName, value: "e", line: 6},
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			tokens, err := lexAll(tc.src, tc.version)
+			require.NoError(t, err)
+			require.Equal(t, tc.tokens, tokens)
+		})
+	}
+}
+
+func TestLexerErrors(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		src     string
+		version luaVersion
+		err     error
+	}{
+		{name: "unfinished string", src: `"abc`, version: lua53, err: errUnfinishedString},
+		{name: "newline in string", src: "'a\nb'", version: lua53, err: errUnfinishedString},
+		{name: "unfinished escape", src: `"\`, version: lua53, err: errUnfinishedString},
+		{name: "unfinished long string", src: "[==[ a ]=]", version: lua53, err: errUnfinishedLongString},
+		{name: "unfinished long comment", src: "--[[ a", version: lua53, err: errUnfinishedLongComment},
+		{name: "unknown escape", src: `"\q"`, version: lua53, err: errInvalidEscape},
+		{name: "short hex escape", src: `"\x4`, version: lua53, err: errInvalidEscape},
+		{name: "bad hex escape", src: `"\xg1"`, version: lua53, err: errInvalidEscape},
+		{name: "large decimal escape", src: `"\256"`, version: lua53, err: errInvalidEscape},
+		{name: "unclosed utf8 escape", src: `"\u{48"`, version: lua53, err: errInvalidEscape},
+		{name: "empty utf8 escape", src: `"\u{}"`, version: lua53, err: errInvalidEscape},
+		{name: "large utf8 escape", src: `"\u{110000}"`, version: lua53, err: errInvalidEscape},
+		{name: "utf8 escape in lua52", src: `"\u{48}"`, version: lua52, err: errInvalidEscape},
+		{name: "hex prefix only", src: "0x", version: lua53, err: errMalformedNumber},
+		{name: "number with name", src: "3abc", version: lua53, err: errMalformedNumber},
+		{name: "unexpected symbol", src: "a @ b", version: lua53, err: errUnexpectedSymbol},
+		{name: "lua53 operator in lua52", src: "a & b", version: lua52, err: errUnexpectedSymbol},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := lexAll(tc.src, tc.version)
+			require.ErrorIs(t, err, tc.err)
+		})
+	}
+}
+
+// lexAll returns all tokens of the source without positions.
+func lexAll(src string, version luaVersion) ([]token, error) {
+	l := newLexer(src, version)
+
+	var tokens []token
+	for {
+		tok, err := l.Next()
+		if err != nil {
+			return nil, err
+		}
+		if tok.kind == tokenEOF {
+			return tokens, nil
+		}
+		tok.pos, tok.end = 0, 0
+		tokens = append(tokens, tok)
+	}
+}
@@ -0,0 +1,1001 @@
+package analyzer
+
+import (
+	"errors"
+	"fmt"
+)
+
+var errSyntax = errors.New("syntax error")
+
+// binaryPriority holds left and right priorities of binary operators, as in lparser.c.
+// Right priority lower than the left one means right associativity.
+//
+//nolint:gochecknoglobals // read-only lookup table
+var binaryPriority = map[string][2]int{
+	"or":  {1, 1},
+	"and": {2, 2},
+	"<":   {3, 3}, ">": {3, 3}, "<=": {3, 3}, ">=": {3, 3}, "~=": {3, 3}, "==": {3, 3},
+	"|":  {4, 4},
+	"~":  {5, 5},
+	"&":  {6, 6},
+	"<<": {7, 7}, ">>": {7, 7},
+	"..": {9, 8},
+	"+":  {10, 10}, "-": {10, 10},
+	"*": {11, 11}, "/": {11, 11}, "//": {11, 11}, "%": {11, 11},
+	"^": {14, 13},
+}
+
+const unaryPriority = 12
+
+type sourceParser struct{}
+
+func newSourceParser() *sourceParser {
+	return &sourceParser{}
+}
+
+// ParseSource parses Lua source of the given version into an AST of the main chunk.
+func (*sourceParser) ParseSource(src []byte, version luaVersion) (*block, error) {
+	return parseChunk(&luaParser{lex: newLexer(string(src), version), version: version})
+}
+
+func parseChunk(p *luaParser) (*block, error) {
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+
+	b, err := p.parseBlock()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.tok.kind != tokenEOF {
+		return nil, p.errorf("'<eof>' expected")
+	}
+
+	return b, nil
+}
+
+// luaParser is a recursive descent parser of Lua following the grammar from lparser.c.
+// Version specific tokens are handled by the lexer, the parser handles local attributes of Lua 5.4.
+type luaParser struct {
+	lex      *lexer
+	version  luaVersion
+	tok      token
+	ahead    token
+	hasAhead bool
+	// actives is a stack of local variables visible at the current position.
+	actives []*localVar
+	// bindings maps positions of name tokens to their local variables, if not nil.
+	bindings map[int]*localVar
+}
+
+func (p *luaParser) next() error {
+	if p.hasAhead {
+		p.tok, p.hasAhead = p.ahead, false
+		return nil
+	}
+
+	tok, err := p.lex.Next()
+	if err != nil {
+		return fmt.Errorf("%w: %w", errSyntax, err)
+	}
+	p.tok = tok
+
+	return nil
+}
+
+func (p *luaParser) peek() (token, error) {
+	if !p.hasAhead {
+		tok, err := p.lex.Next()
+		if err != nil {
+			return token{}, fmt.Errorf("%w: %w", errSyntax, err)
+		}
+		p.ahead, p.hasAhead = tok, true
+	}
+	return p.ahead, nil
+}
+
+func (p *luaParser) errorf(format string, args ...any) error {
+	return fmt.Errorf("%w: line %d: %s near '%s'", errSyntax, p.tok.line, fmt.Sprintf(format, args...), p.tok)
+}
+
+func (p *luaParser) check(kind tokenKind, value string) bool {
+	return p.tok.is(kind, value)
+}
+
+func (p *luaParser) testNext(kind tokenKind, value string) (bool, error) {
+	if !p.check(kind, value) {
+		return false, nil
+	}
+	return true, p.next()
+}
+
+func (p *luaParser) expect(kind tokenKind, value string) error {
+	if !p.check(kind, value) {
+		return p.errorf("'%s' expected", value)
+	}
+	return p.next()
+}
+
+func (p *luaParser) expectMatch(kind tokenKind, value, open string, line int) error {
+	if p.check(kind, value) {
+		return p.next()
+	}
+	if line == p.tok.line {
+		return p.errorf("'%s' expected", value)
+	}
+	return p.errorf("'%s' expected (to close '%s' at line %d)", value, open, line)
+}
+
+func (p *luaParser) expectName() (token, error) {
+	tok := p.tok
+	if tok.kind != tokenName {
+		return token{}, p.errorf("<name> expected")
+	}
+	return tok, p.next()
+}
+
+func (p *luaParser) openScope() int {
+	return len(p.actives)
+}
+
+func (p *luaParser) closeScope(mark int) {
+	p.actives = p.actives[:mark]
+}
+
+func (p *luaParser) declareLocal(tok token) *localVar {
+	v := &localVar{name: tok.value, line: tok.line}
+	p.actives = append(p.actives, v)
+	// implicit self has no token in the source
+	if p.bindings != nil && tok.end > tok.pos {
+		p.bindings[tok.pos] = v
+	}
+	return v
+}
+
+func (p *luaParser) findLocal(name string) *localVar {
+	for i := len(p.actives) - 1; i >= 0; i-- {
+		if p.actives[i].name == name {
+			return p.actives[i]
+		}
+	}
+	return nil
+}
+
+func (p *luaParser) blockFollow(withUntil bool) bool {
+	if p.tok.kind == tokenEOF {
+		return true
+	}
+	if p.tok.kind != tokenKeyword {
+		return false
+	}
+	switch p.tok.value {
+	case "else", "elseif", "end":
+		return true
+	case "until":
+		return withUntil
+	}
+	return false
+}
+
+func (p *luaParser) parseBlock() (*block, error) {
+	b := &block{}
+	for !p.blockFollow(true) {
+		if p.check(tokenKeyword, "return") {
+			st, err := p.parseReturn()
+			if err != nil {
+				return nil, err
+			}
+			b.stats = append(b.stats, st)
+			break
+		}
+
+		st, err := p.parseStatement()
+		if err != nil {
+			return nil, err
+		}
+		if st != nil {
+			b.stats = append(b.stats, st)
+		}
+	}
+	return b, nil
+}
+
+// parseScopedBlock parses a block in its own scope of local variables.
+func (p *luaParser) parseScopedBlock() (*block, error) {
+	mark := p.openScope()
+	defer p.closeScope(mark)
+	return p.parseBlock()
+}
+
+func (p *luaParser) parseStatement() (stat, error) {
+	line := p.tok.line
+	if p.tok.kind == tokenSymbol {
+		switch p.tok.value {
+		case ";":
+			return nil, p.next()
+		case "::":
+			return p.parseLabel()
+		}
+	}
+
+	if p.tok.kind != tokenKeyword {
+		return p.parseExprStat()
+	}
+
+	switch p.tok.value {
+	case "if":
+		return p.parseIf(line)
+	case "while":
+		return p.parseWhile(line)
+	case "do":
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		body, err := p.parseScopedBlock()
+		if err != nil {
+			return nil, err
+		}
+		return &doStat{body: body}, p.expectMatch(tokenKeyword, "end", "do", line)
+	case "for":
+		return p.parseFor(line)
+	case "repeat":
+		return p.parseRepeat(line)
+	case "function":
+		return p.parseFunctionStat(line)
+	case "local":
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		if ok, err := p.testNext(tokenKeyword, "function"); err != nil {
+			return nil, err
+		} else if ok {
+			return p.parseLocalFunction()
+		}
+		return p.parseLocal()
+	case "goto":
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		name, err := p.expectName()
+		if err != nil {
+			return nil, err
+		}
+		return &gotoStat{label: name.value}, nil
+	case "break":
+		return &breakStat{}, p.next()
+	}
+
+	return p.parseExprStat()
+}
+
+func (p *luaParser) parseLabel() (stat, error) {
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	name, err := p.expectName()
+	if err != nil {
+		return nil, err
+	}
+	return &labelStat{name: name.value}, p.expect(tokenSymbol, "::")
+}
+
+func (p *luaParser) parseIf(line int) (stat, error) {
+	st := &ifStat{}
+	for {
+		// skip 'if' or 'elseif'
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		cond, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(tokenKeyword, "then"); err != nil {
+			return nil, err
+		}
+		body, err := p.parseScopedBlock()
+		if err != nil {
+			return nil, err
+		}
+		st.conds = append(st.conds, cond)
+		st.blocks = append(st.blocks, body)
+
+		if !p.check(tokenKeyword, "elseif") {
+			break
+		}
+	}
+
+	if ok, err := p.testNext(tokenKeyword, "else"); err != nil {
+		return nil, err
+	} else if ok {
+		body, err := p.parseScopedBlock()
+		if err != nil {
+			return nil, err
+		}
+		st.elseBody = body
+	}
+
+	return st, p.expectMatch(tokenKeyword, "end", "if", line)
+}
+
+func (p *luaParser) parseWhile(line int) (stat, error) {
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	cond, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect(tokenKeyword, "do"); err != nil {
+		return nil, err
+	}
+	body, err := p.parseScopedBlock()
+	if err != nil {
+		return nil, err
+	}
+	return &whileStat{cond: cond, body: body}, p.expectMatch(tokenKeyword, "end", "while", line)
+}
+
+func (p *luaParser) parseRepeat(line int) (stat, error) {
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+
+	// the condition of repeat-until sees the locals of the loop body
+	mark := p.openScope()
+	defer p.closeScope(mark)
+
+	body, err := p.parseBlock()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expectMatch(tokenKeyword, "until", "repeat", line); err != nil {
+		return nil, err
+	}
+	cond, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	return &repeatStat{body: body, cond: cond}, nil
+}
+
+func (p *luaParser) parseFor(line int) (stat, error) {
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	first, err := p.expectName()
+	if err != nil {
+		return nil, err
+	}
+
+	var st stat
+	switch {
+	case p.check(tokenSymbol, "="):
+		st, err = p.parseNumericFor(first)
+	case p.check(tokenSymbol, ","), p.check(tokenKeyword, "in"):
+		st, err = p.parseGenericFor(first)
+	default:
+		return nil, p.errorf("'=' or 'in' expected")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return st, p.expectMatch(tokenKeyword, "end", "for", line)
+}
+
+func (p *luaParser) parseNumericFor(name token) (stat, error) {
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+
+	st := &numericForStat{}
+	var err error
+	if st.start, err = p.parseExpr(); err != nil {
+		return nil, err
+	}
+	if err := p.expect(tokenSymbol, ","); err != nil {
+		return nil, err
+	}
+	if st.limit, err = p.parseExpr(); err != nil {
+		return nil, err
+	}
+	if ok, err := p.testNext(tokenSymbol, ","); err != nil {
+		return nil, err
+	} else if ok {
+		if st.step, err = p.parseExpr(); err != nil {
+			return nil, err
+		}
+	}
+	if err := p.expect(tokenKeyword, "do"); err != nil {
+		return nil, err
+	}
+
+	mark := p.openScope()
+	defer p.closeScope(mark)
+
+	st.v = p.declareLocal(name)
+	if st.body, err = p.parseBlock(); err != nil {
+		return nil, err
+	}
+
+	return st, nil
+}
+
+func (p *luaParser) parseGenericFor(first token) (stat, error) {
+	names := []token{first}
+	for p.check(tokenSymbol, ",") {
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		name, err := p.expectName()
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	if err := p.expect(tokenKeyword, "in"); err != nil {
+		return nil, err
+	}
+
+	st := &genericForStat{}
+	var err error
+	if st.exprs, err = p.parseExprList(); err != nil {
+		return nil, err
+	}
+	if err := p.expect(tokenKeyword, "do"); err != nil {
+		return nil, err
+	}
+
+	mark := p.openScope()
+	defer p.closeScope(mark)
+
+	for _, n := range names {
+		st.vars = append(st.vars, p.declareLocal(n))
+	}
+	if st.body, err = p.parseBlock(); err != nil {
+		return nil, err
+	}
+
+	return st, nil
+}
+
+func (p *luaParser) parseFunctionStat(line int) (stat, error) {
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+
+	name, err := p.expectName()
+	if err != nil {
+		return nil, err
+	}
+
+	var target expr = p.buildNameExpr(name)
+	isMethod := false
+	for p.check(tokenSymbol, ".") || p.check(tokenSymbol, ":") {
+		isMethod = p.check(tokenSymbol, ":")
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		key, err := p.expectName()
+		if err != nil {
+			return nil, err
+		}
+		target = &indexExpr{obj: target, key: &stringExpr{value: key.value}}
+		if isMethod {
+			break
+		}
+	}
+
+	if n, ok := target.(*nameExpr); ok && n.local != nil {
+		n.local.assigned = true
+	}
+
+	fn, err := p.parseFunctionBody(isMethod, line)
+	if err != nil {
+		return nil, err
+	}
+
+	return &functionStat{target: target, fn: fn}, nil
+}
+
+func (p *luaParser) parseLocalFunction() (stat, error) {
+	line := p.tok.line
+	name, err := p.expectName()
+	if err != nil {
+		return nil, err
+	}
+
+	// the local function is visible inside its own body
+	v := p.declareLocal(name)
+	fn, err := p.parseFunctionBody(false, line)
+	if err != nil {
+		return nil, err
+	}
+
+	return &localFunctionStat{v: v, fn: fn}, nil
+}
+
+func (p *luaParser) parseLocal() (stat, error) {
+	var names []token
+	for {
+		name, err := p.expectName()
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+
+		if err := p.skipLocalAttrib(); err != nil {
+			return nil, err
+		}
+
+		if ok, err := p.testNext(tokenSymbol, ","); err != nil {
+			return nil, err
+		} else if !ok {
+			break
+		}
+	}
+
+	st := &localStat{}
+	if ok, err := p.testNext(tokenSymbol, "="); err != nil {
+		return nil, err
+	} else if ok {
+		if st.exprs, err = p.parseExprList(); err != nil {
+			return nil, err
+		}
+	}
+
+	// locals become visible after the whole statement
+	for _, n := range names {
+		st.vars = append(st.vars, p.declareLocal(n))
+	}
+
+	return st, nil
+}
+
+// skipLocalAttrib skips the attribute of a local variable declaration: <const> or <close>.
+// Attributes do not affect requires, so they are not kept in the AST.
+func (p *luaParser) skipLocalAttrib() error {
+	if p.version < lua54 || !p.check(tokenSymbol, "<") {
+		return nil
+	}
+
+	if err := p.next(); err != nil {
+		return err
+	}
+
+	attrib, err := p.expectName()
+	if err != nil {
+		return err
+	}
+
+	if attrib.value != "const" && attrib.value != "close" {
+		return fmt.Errorf("%w: line %d: unknown attribute '%s'", errSyntax, attrib.line, attrib.value)
+	}
+
+	return p.expect(tokenSymbol, ">")
+}
+
+func (p *luaParser) parseReturn() (stat, error) {
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+
+	st := &returnStat{}
+	if !p.blockFollow(true) && !p.check(tokenSymbol, ";") {
+		var err error
+		if st.exprs, err = p.parseExprList(); err != nil {
+			return nil, err
+		}
+	}
+
+	if _, err := p.testNext(tokenSymbol, ";"); err != nil {
+		return nil, err
+	}
+
+	if !p.blockFollow(true) {
+		return nil, p.errorf("'<eof>' expected")
+	}
+
+	return st, nil
+}
+
+func (p *luaParser) parseExprStat() (stat, error) {
+	e, err := p.parseSuffixedExpr()
+	if err != nil {
+		return nil, err
+	}
+
+	if !p.check(tokenSymbol, "=") && !p.check(tokenSymbol, ",") {
+		switch e.(type) {
+		case *callExpr, *methodCallExpr:
+			return &callStat{call: e}, nil
+		}
+		return nil, p.errorf("syntax error")
+	}
+
+	targets := []expr{e}
+	for p.check(tokenSymbol, ",") {
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		t, err := p.parseSuffixedExpr()
+		if err != nil {
+			return nil, err
+		}
+		targets = append(targets, t)
+	}
+
+	for _, t := range targets {
+		switch t := t.(type) {
+		case *nameExpr:
+			if t.local != nil {
+				t.local.assigned = true
+			}
+		case *indexExpr:
+		default:
+			return nil, p.errorf("syntax error")
+		}
+	}
+
+	if err := p.expect(tokenSymbol, "="); err != nil {
+		return nil, err
+	}
+
+	exprs, err := p.parseExprList()
+	if err != nil {
+		return nil, err
+	}
+
+	return &assignStat{targets: targets, exprs: exprs}, nil
+}
+
+func (p *luaParser) parseExprList() ([]expr, error) {
+	var exprs []expr
+	for {
+		e, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		exprs = append(exprs, e)
+
+		if ok, err := p.testNext(tokenSymbol, ","); err != nil {
+			return nil, err
+		} else if !ok {
+			return exprs, nil
+		}
+	}
+}
+
+func (p *luaParser) parseExpr() (expr, error) {
+	return p.parseSubExpr(0)
+}
+
+// parseSubExpr parses an expression where binary operators have priority greater than limit.
+func (p *luaParser) parseSubExpr(limit int) (expr, error) {
+	var (
+		e   expr
+		err error
+	)
+
+	if op, ok := p.unaryOp(); ok {
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		operand, err := p.parseSubExpr(unaryPriority)
+		if err != nil {
+			return nil, err
+		}
+		e = &unopExpr{op: op, operand: operand}
+	} else if e, err = p.parseSimpleExpr(); err != nil {
+		return nil, err
+	}
+
+	for {
+		op, ok := p.binaryOp()
+		if !ok {
+			return e, nil
+		}
+
+		prio := binaryPriority[op]
+		if prio[0] <= limit {
+			return e, nil
+		}
+
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		rhs, err := p.parseSubExpr(prio[1])
+		if err != nil {
+			return nil, err
+		}
+		e = &binopExpr{op: op, lhs: e, rhs: rhs}
+	}
+}
+
+func (p *luaParser) unaryOp() (string, bool) {
+	switch {
+	case p.check(tokenKeyword, "not"):
+		return "not", true
+	case p.tok.kind == tokenSymbol:
+		switch p.tok.value {
+		case "-", "#", "~":
+			return p.tok.value, true
+		}
+	}
+	return "", false
+}
+
+func (p *luaParser) binaryOp() (string, bool) {
+	if p.tok.kind != tokenSymbol && !p.check(tokenKeyword, "and") && !p.check(tokenKeyword, "or") {
+		return "", false
+	}
+	_, ok := binaryPriority[p.tok.value]
+	return p.tok.value, ok
+}
+
+func (p *luaParser) parseSimpleExpr() (expr, error) {
+	tok := p.tok
+	switch tok.kind {
+	case tokenNumber:
+		return &numberExpr{value: tok.value}, p.next()
+	case tokenString:
+		return &stringExpr{value: tok.value}, p.next()
+	case tokenKeyword:
+		switch tok.value {
+		case "nil":
+			return &nilExpr{}, p.next()
+		case "true":
+			return &trueExpr{}, p.next()
+		case "false":
+			return &falseExpr{}, p.next()
+		case "function":
+			if err := p.next(); err != nil {
+				return nil, err
+			}
+			return p.parseFunctionBody(false, tok.line)
+		}
+	case tokenSymbol:
+		switch tok.value {
+		case "...":
+			return &varargExpr{}, p.next()
+		case "{":
+			return p.parseTable()
+		}
+	case tokenEOF, tokenName:
+	}
+
+	return p.parseSuffixedExpr()
+}
+
+func (p *luaParser) parsePrimaryExpr() (expr, error) {
+	switch {
+	case p.tok.kind == tokenName:
+		name := p.tok
+		return p.buildNameExpr(name), p.next()
+	case p.check(tokenSymbol, "("):
+		line := p.tok.line
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		inner, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		return &parenExpr{inner: inner}, p.expectMatch(tokenSymbol, ")", "(", line)
+	}
+
+	return nil, p.errorf("unexpected symbol")
+}
+
+func (p *luaParser) buildNameExpr(name token) *nameExpr {
+	e := &nameExpr{name: name.value, line: name.line, local: p.findLocal(name.value)}
+	if p.bindings != nil && e.local != nil {
+		p.bindings[name.pos] = e.local
+	}
+	// globals are fields of _ENV since Lua 5.2
+	if e.local == nil && p.version >= lua52 {
+		e.env = p.findLocal("_ENV")
+	}
+	return e
+}
+
+func (p *luaParser) parseSuffixedExpr() (expr, error) {
+	// calls are attributed to the line where the expression starts, as luac does
+	line := p.tok.line
+	e, err := p.parsePrimaryExpr()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		switch {
+		case p.check(tokenSymbol, "."):
+			if err := p.next(); err != nil {
+				return nil, err
+			}
+			key, err := p.expectName()
+			if err != nil {
+				return nil, err
+			}
+			e = &indexExpr{obj: e, key: &stringExpr{value: key.value}}
+		case p.check(tokenSymbol, "["):
+			if err := p.next(); err != nil {
+				return nil, err
+			}
+			key, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(tokenSymbol, "]"); err != nil {
+				return nil, err
+			}
+			e = &indexExpr{obj: e, key: key}
+		case p.check(tokenSymbol, ":"):
+			if err := p.next(); err != nil {
+				return nil, err
+			}
+			method, err := p.expectName()
+			if err != nil {
+				return nil, err
+			}
+			args, err := p.parseCallArgs()
+			if err != nil {
+				return nil, err
+			}
+			e = &methodCallExpr{obj: e, method: method.value, args: args, line: line}
+		case p.check(tokenSymbol, "("), p.check(tokenSymbol, "{"), p.tok.kind == tokenString:
+			args, err := p.parseCallArgs()
+			if err != nil {
+				return nil, err
+			}
+			e = &callExpr{fn: e, args: args, line: line}
+		default:
+			return e, nil
+		}
+	}
+}
+
+func (p *luaParser) parseCallArgs() ([]expr, error) {
+	switch {
+	case p.tok.kind == tokenString:
+		s := &stringExpr{value: p.tok.value}
+		return []expr{s}, p.next()
+	case p.check(tokenSymbol, "{"):
+		t, err := p.parseTable()
+		if err != nil {
+			return nil, err
+		}
+		return []expr{t}, nil
+	case p.check(tokenSymbol, "("):
+		line := p.tok.line
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		var args []expr
+		if !p.check(tokenSymbol, ")") {
+			var err error
+			if args, err = p.parseExprList(); err != nil {
+				return nil, err
+			}
+		}
+		return args, p.expectMatch(tokenSymbol, ")", "(", line)
+	}
+
+	return nil, p.errorf("function arguments expected")
+}
+
+func (p *luaParser) parseTable() (expr, error) {
+	line := p.tok.line
+	if err := p.expect(tokenSymbol, "{"); err != nil {
+		return nil, err
+	}
+
+	t := &tableExpr{}
+	for !p.check(tokenSymbol, "}") {
+		f, err := p.parseTableField()
+		if err != nil {
+			return nil, err
+		}
+		t.fields = append(t.fields, f)
+
+		if !p.check(tokenSymbol, ",") && !p.check(tokenSymbol, ";") {
+			break
+		}
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+	}
+
+	return t, p.expectMatch(tokenSymbol, "}", "{", line)
+}
+
+func (p *luaParser) parseTableField() (tableField, error) {
+	switch {
+	case p.tok.kind == tokenName:
+		ahead, err := p.peek()
+		if err != nil {
+			return tableField{}, err
+		}
+		if !ahead.is(tokenSymbol, "=") {
+			break
+		}
+
+		key := &stringExpr{value: p.tok.value}
+		if err := p.next(); err != nil {
+			return tableField{}, err
+		}
+		if err := p.next(); err != nil {
+			return tableField{}, err
+		}
+		value, err := p.parseExpr()
+		return tableField{key: key, value: value}, err
+	case p.check(tokenSymbol, "["):
+		if err := p.next(); err != nil {
+			return tableField{}, err
+		}
+		key, err := p.parseExpr()
+		if err != nil {
+			return tableField{}, err
+		}
+		if err := p.expect(tokenSymbol, "]"); err != nil {
+			return tableField{}, err
+		}
+		if err := p.expect(tokenSymbol, "="); err != nil {
+			return tableField{}, err
+		}
+		value, err := p.parseExpr()
+		return tableField{key: key, value: value}, err
+	}
+
+	value, err := p.parseExpr()
+	return tableField{value: value}, err
+}
+
+func (p *luaParser) parseFunctionBody(isMethod bool, line int) (*functionExpr, error) {
+	mark := p.openScope()
+	defer p.closeScope(mark)
+
+	fn := &functionExpr{}
+	if isMethod {
+		fn.params = append(fn.params, p.declareLocal(token{value: "self", line: line}))
+	}
+
+	if err := p.expect(tokenSymbol, "("); err != nil {
+		return nil, err
+	}
+
+	for !p.check(tokenSymbol, ")") {
+		if ok, err := p.testNext(tokenSymbol, "..."); err != nil {
+			return nil, err
+		} else if ok {
+			fn.isVararg = true
+			break
+		}
+
+		name, err := p.expectName()
+		if err != nil {
+			return nil, err
+		}
+		fn.params = append(fn.params, p.declareLocal(name))
+
+		if ok, err := p.testNext(tokenSymbol, ","); err != nil {
+			return nil, err
+		} else if !ok {
+			break
+		}
+	}
+
+	if err := p.expect(tokenSymbol, ")"); err != nil {
+		return nil, err
+	}
+
+	body, err := p.parseBlock()
+	if err != nil {
+		return nil, err
+	}
+	fn.body = body
+
+	return fn, p.expectMatch(tokenKeyword, "end", "function", line)
+}
@@ -0,0 +1,170 @@
+package analyzer
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSource(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		src     string
+		version luaVersion
+		nodes   []string
+	}{
+		{
+			name: "goto and labels",
+			src: `for i = 1, 3 do
+  if i == 2 then goto continue end
+  ::continue::
+end
+goto done; ::done::`,
+			version: lua52,
+			nodes: []string{
+				"number 1", "number 3", "local i", "number 2",
+				"goto continue", "label continue", "goto done", "label done",
+			},
+		},
+		{
+			name:    "lua51 goto is a name",
+			src:     "local goto = 1; goto = goto + 1",
+			version: lua51,
+			nodes:   []string{"local goto", "number 1", "local goto", "local goto", "number 1"},
+		},
+		{
+			name:    "lua54 attribs",
+			src:     "local a <const>, b <close>, c = 1, nil\nlocal d <const> = a",
+			version: lua54,
+			nodes:   []string{"local a b c", "number 1", "local d", "local a"},
+		},
+		{
+			name:    "long strings and numerals",
+			src:     "local s = [==[\n]]]==] .. '\\x41\\z\n  \\u{42}' .. 0x1p4 .. 1e-2 // 3 -- [[\n--[[ x ]]",
+			version: lua53,
+			nodes:   []string{"local s", `string "]]"`, `string "AB"`, "number 0x1p4", "number 1e-2", "number 3"},
+		},
+		{
+			name:    "operators",
+			src:     "x = not a == b and -c ^ 2 or #d .. e >> 1 & ~f",
+			version: lua53,
+			nodes: []string{
+				"global x", "global a", "global b", "global c", "number 2",
+				"global d", "global e", "number 1", "global f",
+			},
+		},
+		{
+			name:    "method calls and tables",
+			src:     "obj:m{a = 1, [2] = 'b'; 'c'}:n'd'.e = function(...) return ... end",
+			version: lua53,
+			nodes: []string{
+				"global obj", `string "a"`, "number 1", "number 2", `string "b"`, `string "c"`,
+				`string "d"`, `string "e"`, "vararg",
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			b, err := newSourceParser().ParseSource([]byte(tc.src), tc.version)
+			require.NoError(t, err)
+			require.Equal(t, tc.nodes, describeNodes(b))
+		})
+	}
+}
+
+func TestParseSourceErrors(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		src     string
+		version luaVersion
+	}{
+		{name: "unfinished block", src: "do x = 1", version: lua53},
+		{name: "unfinished call", src: "f(1, 2", version: lua53},
+		{name: "unfinished table", src: "t = {1, 2", version: lua53},
+		{name: "expression statement", src: "x + 1", version: lua53},
+		{name: "call result assignment", src: "f() = 1", version: lua53},
+		{name: "missing then", src: "if x end", version: lua53},
+		{name: "missing for variable", src: "for = 1, 2 do end", version: lua53},
+		{name: "statement after return", src: "return 1 x = 2", version: lua53},
+		{name: "unknown attrib", src: "local x <static> = 1", version: lua54},
+		{name: "attrib in lua53", src: "local x <const> = 1", version: lua53},
+		{name: "label without name", src: ":: ::", version: lua52},
+		{name: "label in lua51", src: "::done::", version: lua51},
+		{name: "goto without label", src: "goto", version: lua52},
+		{name: "integer division in lua52", src: "x = a // b", version: lua52},
+		{name: "lexer error", src: `x = "\q"`, version: lua53},
+		{name: "unexpected end", src: "end", version: lua53},
+		{name: "unbalanced parens", src: "x = (1", version: lua53},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := newSourceParser().ParseSource([]byte(tc.src), tc.version)
+			require.ErrorIs(t, err, errSyntax)
+		})
+	}
+}
+
+// TestParseSourceTruncated checks that the parser fails without panics on every prefix of a valid chunk.
+func TestParseSourceTruncated(t *testing.T) {
+	t.Parallel()
+
+	const src = `local a <const>, b = require("a"), {[1] = 2, x = "y"; 3}
+local function f(x, ...) return x:m(...)[a].b, #b end
+::top:: for k, v in pairs(b) do if k then goto top elseif v then break else f(k) end end
+repeat local n = 0x1p4 // 2 << 1 until n ~= 1e3 and not n
+x = [==[ long ]==] .. '\x41\u{42}\z
+    c' --[[ comment ]]`
+
+	for i := range len(src) {
+		require.NotPanics(t, func() {
+			_, _ = newSourceParser().ParseSource([]byte(src[:i]), lua54)
+		}, src[:i])
+	}
+
+	_, err := newSourceParser().ParseSource([]byte(src), lua54)
+	require.NoError(t, err)
+}
+
+// describeNodes lists statements and expressions of the block which are interesting for tests.
+func describeNodes(b *block) []string {
+	var nodes []string
+	inspectBlock(b, func(node any) bool {
+		switch n := node.(type) {
+		case *gotoStat:
+			nodes = append(nodes, "goto "+n.label)
+		case *labelStat:
+			nodes = append(nodes, "label "+n.name)
+		case *localStat:
+			desc := "local"
+			for _, v := range n.vars {
+				desc += " " + v.name
+			}
+			nodes = append(nodes, desc)
+		case *nameExpr:
+			if n.local == nil {
+				nodes = append(nodes, "global "+n.name)
+			} else {
+				nodes = append(nodes, "local "+n.local.name)
+			}
+		case *numberExpr:
+			nodes = append(nodes, "number "+n.value)
+		case *stringExpr:
+			nodes = append(nodes, "string "+strconv.Quote(n.value))
+		case *varargExpr:
+			nodes = append(nodes, "vararg")
+		}
+		return true
+	})
+	return nodes
+}
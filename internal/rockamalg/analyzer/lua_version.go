@@ -0,0 +1,39 @@
+package analyzer
+
+import (
+	"errors"
+	"fmt"
+)
+
+var errUnsupportedLuaVersion = errors.New("unsupported lua version")
+
+// luaVersion is a version of Lua the analyzed modules are written for.
+// Versions differ in syntax, in the bytecode listing format and in
+// the string representation of numbers.
+type luaVersion int
+
+const (
+	lua51 luaVersion = iota + 51
+	lua52
+	lua53
+	lua54
+)
+
+func parseLuaVersion(s string) (luaVersion, error) {
+	switch s {
+	case "5.1":
+		return lua51, nil
+	case "5.2":
+		return lua52, nil
+	case "5.3":
+		return lua53, nil
+	case "5.4":
+		return lua54, nil
+	}
+	return 0, fmt.Errorf("%w: %q", errUnsupportedLuaVersion, s)
+}
+
+func (v luaVersion) String() string {
+	const minor = 10
+	return fmt.Sprintf("%d.%d", v/minor, v%minor)
+}
@@ -0,0 +1,240 @@
+package analyzer
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+var errMinifiedMismatch = errors.New("minified source does not match the original")
+
+// MinifyOptions are options of Lua source minification.
+type MinifyOptions struct {
+	// RenameLocals gives local variables short names.
+	RenameLocals bool
+	// KeepLines keeps tokens on their original lines, so line numbers in tracebacks stay valid.
+	KeepLines bool
+}
+
+// Minify strips comments and redundant whitespace from the Lua source written for the given Lua version.
+// Tokens are kept as is, except the names of renamed locals, so the semantics is not changed.
+// The result is parsed again and compared with the original tokens.
+func Minify(src []byte, luaVersion string, opts MinifyOptions) ([]byte, error) {
+	version, err := parseLuaVersion(luaVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	tokens, err := scanTokens(string(src), version)
+	if err != nil {
+		return nil, fmt.Errorf("scan: %w", err)
+	}
+
+	var names map[int]string
+	if opts.RenameLocals {
+		if names, err = renameLocals(src, tokens, version); err != nil {
+			return nil, fmt.Errorf("rename locals: %w", err)
+		}
+	}
+
+	out := writeMinified(src, tokens, names, version, opts.KeepLines)
+
+	if err := checkMinified(out, tokens, names, version, opts.KeepLines); err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
+func scanTokens(src string, version luaVersion) ([]token, error) {
+	var tokens []token
+	lex := newLexer(src, version)
+	for {
+		t, err := lex.Next()
+		if err != nil {
+			return nil, err
+		}
+		if t.kind == tokenEOF {
+			return tokens, nil
+		}
+		tokens = append(tokens, t)
+	}
+}
+
+// renameLocals returns new names of locals by positions of their name tokens.
+// Every local gets a name unique within the chunk, which is not used by any
+// global, field or label, so no name could be captured by another variable.
+func renameLocals(src []byte, tokens []token, version luaVersion) (map[int]string, error) {
+	p := &luaParser{
+		lex:      newLexer(string(src), version),
+		version:  version,
+		bindings: make(map[int]*localVar),
+	}
+	if _, err := parseChunk(p); err != nil {
+		return nil, err
+	}
+
+	reserved := make(map[string]struct{})
+	for _, t := range tokens {
+		if v, ok := p.bindings[t.pos]; t.kind == tokenName && (!ok || !isRenameable(v)) {
+			reserved[t.value] = struct{}{}
+		}
+	}
+
+	positions := make([]int, 0, len(p.bindings))
+	for pos, v := range p.bindings {
+		if isRenameable(v) {
+			positions = append(positions, pos)
+		}
+	}
+	sort.Ints(positions)
+
+	gen := nameGenerator{reserved: reserved}
+	renamed := make(map[*localVar]string)
+	names := make(map[int]string, len(positions))
+	for _, pos := range positions {
+		v := p.bindings[pos]
+		if _, ok := renamed[v]; !ok {
+			renamed[v] = gen.Next()
+		}
+		names[pos] = renamed[v]
+	}
+
+	return names, nil
+}
+
+// isRenameable reports whether the local could be renamed. Self is declared implicitly
+// by methods and _ENV changes the meaning of globals, so they keep their names.
+func isRenameable(v *localVar) bool {
+	return v.name != "self" && v.name != "_ENV"
+}
+
+type nameGenerator struct {
+	reserved map[string]struct{}
+	n        int
+}
+
+const (
+	nameStartChars = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ_"
+	nameChars      = nameStartChars + "0123456789"
+)
+
+// Next returns the next shortest name, which is neither a keyword nor reserved.
+func (g *nameGenerator) Next() string {
+	for {
+		name := g.name(g.n)
+		g.n++
+
+		if _, ok := luaKeywords[name]; ok {
+			continue
+		}
+		if _, ok := g.reserved[name]; ok {
+			continue
+		}
+		return name
+	}
+}
+
+func (*nameGenerator) name(n int) string {
+	b := []byte{nameStartChars[n%len(nameStartChars)]}
+	for n /= len(nameStartChars); n > 0; n /= len(nameChars) {
+		n--
+		b = append(b, nameChars[n%len(nameChars)])
+	}
+	return string(b)
+}
+
+func writeMinified(
+	src []byte, tokens []token, names map[int]string, version luaVersion, keepLines bool,
+) []byte {
+	var out bytes.Buffer
+	line := 1
+	prev := ""
+	for _, t := range tokens {
+		text := string(src[t.pos:t.end])
+		if name, ok := names[t.pos]; ok {
+			text = name
+		}
+
+		if keepLines && t.line > line {
+			out.Write(bytes.Repeat([]byte("\n"), t.line-line))
+			line = t.line
+			prev = ""
+		}
+
+		if prev != "" && needsSpace(prev, text, version) {
+			out.WriteByte(' ')
+		}
+
+		out.WriteString(text)
+		line += countLines(text)
+		prev = text
+	}
+
+	if out.Len() != 0 {
+		out.WriteByte('\n')
+	}
+
+	return out.Bytes()
+}
+
+// needsSpace reports whether two tokens written together would be scanned differently,
+// e.g. two names, a number followed by a concatenation or minuses forming a comment.
+func needsSpace(prev, next string, version luaVersion) bool {
+	lex := &lexer{src: prev + next, line: 1, version: version}
+
+	first, err := lex.Next()
+	if err != nil || first.end != len(prev) {
+		return true
+	}
+
+	second, err := lex.Next()
+	return err != nil || second.pos != len(prev) || second.end != len(prev)+len(next)
+}
+
+// countLines counts line breaks the same way as the lexer does.
+func countLines(s string) int {
+	lines := 0
+	for i := 0; i < len(s); i++ {
+		if !isNewline(s[i]) {
+			continue
+		}
+		if i+1 < len(s) && isNewline(s[i+1]) && s[i+1] != s[i] {
+			i++
+		}
+		lines++
+	}
+	return lines
+}
+
+func checkMinified(
+	out []byte, tokens []token, names map[int]string, version luaVersion, keepLines bool,
+) error {
+	if _, err := (&sourceParser{}).ParseSource(out, version); err != nil {
+		return fmt.Errorf("%w: parse: %w", errMinifiedMismatch, err)
+	}
+
+	minified, err := scanTokens(string(out), version)
+	if err != nil {
+		return fmt.Errorf("%w: scan: %w", errMinifiedMismatch, err)
+	}
+
+	if len(minified) != len(tokens) {
+		return fmt.Errorf("%w: %d tokens instead of %d", errMinifiedMismatch, len(minified), len(tokens))
+	}
+
+	for i, t := range tokens {
+		value := t.value
+		if name, ok := names[t.pos]; ok {
+			value = name
+		}
+
+		m := minified[i]
+		if m.kind != t.kind || m.value != value || (keepLines && m.line != t.line) {
+			return fmt.Errorf("%w: line %d: %s instead of %s", errMinifiedMismatch, t.line, m, t)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,63 @@
+package analyzer_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/enapter/rockamalg/internal/rockamalg/analyzer"
+)
+
+func TestMinify(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		src      string
+		opts     analyzer.MinifyOptions
+		expected string
+	}{
+		{
+			name: "comments and spaces",
+			src: `-- module
+local x = 1 - -1 --[[ long
+comment ]] local s = "a" .. 1 .. [[
+str]]
+return x, s`,
+			expected: "local x=1- -1 local s=\"a\"..1 ..[[\nstr]]return x,s\n",
+		},
+		{
+			name: "keep lines",
+			src: `local t = {} -- table
+
+function t.get(self)
+  return self
+end`,
+			opts:     analyzer.MinifyOptions{KeepLines: true},
+			expected: "local t={}\n\nfunction t.get(self)\nreturn self\nend\n",
+		},
+		{
+			name: "rename locals",
+			src: `local value = print
+local function add(left, right)
+  local a = left + right
+  return a, value
+end
+function obj:method(arg) return self, arg, a end
+return { value = add(1, 2), value }`,
+			opts: analyzer.MinifyOptions{RenameLocals: true},
+			expected: "local b=print local function c(d,e)local f=d+e return f,b end " +
+				"function obj:method(g)return self,g,a end return{value=c(1,2),b}\n",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			out, err := analyzer.Minify([]byte(tc.src), "5.3", tc.opts)
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, string(out))
+		})
+	}
+}
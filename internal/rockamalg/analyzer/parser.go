@@ -12,8 +12,11 @@ import (
 
 // listing is a listing of the compiled bytecode for Lua's virtual machine.
 // A listing could contain several chunks.
+// Chunks are listed in depth-first order: each chunk is followed by chunks of its nested functions.
 // Each chunk consists of a header and several segments: instructions, constants, locals and upvalues.
 // Lua compiler emits new chunk for main and each declared function.
+// The format slightly differs between Lua versions: Lua 5.1 lists only names of upvalues,
+// Lua 5.4 lists types of constants, numbers them from zero and marks constant operands with k.
 //
 // listing example:
 //
@@ -41,22 +44,45 @@ type listing []chunk
 
 type chunk struct {
 	instructions []instruction
-	constants    map[int]string
+	constants    map[int]constant
 	upvalues     map[int]string
+	upvalueRefs  map[int]upvalueRef
+	functions    int
+}
+
+// constant is a chunk constant. Strings are unquoted and unescaped,
+// other constants (numbers, booleans and nil) keep the listing representation.
+type constant struct {
+	value    string
+	isString bool
+}
+
+// upvalueRef describes where a function takes an upvalue from on closure creation:
+// a register of the enclosing function (inStack) or an upvalue of the enclosing function.
+type upvalueRef struct {
+	inStack bool
+	idx     int
 }
 
 // Instruction represents Lua's virtual machine instruction.
-// Opcode identifies the instruction, other fields represent operands.
+// Opcode identifies the instruction, line is the source line or zero if unknown,
+// other fields represent operands. K is the Lua 5.4 flag of constant operand.
+// Jump is the 1-based target of jumps and loops or zero for other instructions.
 type instruction struct {
 	opcode string
+	line   int
 	a      int
 	b      int
 	c      int
+	k      bool
+	jump   int
 }
 
 var (
 	errMissHeaderLine     = errors.New("miss header line")
 	errParseMetadata      = errors.New("parse metadata and instructions count header")
+	errParseUpvalueRef    = errors.New("parse upvalue reference")
+	errParseConstant      = errors.New("parse constant")
 	errMissLocalsSegment  = errors.New("miss locals segment")
 	errWrongSegmentLength = errors.New("wrong required segment length")
 	errParseSegment       = errors.New("parse segment")
@@ -69,9 +95,10 @@ func newParser() *parser {
 	return &parser{}
 }
 
-func (p *parser) ParseListing(buf *bytes.Buffer) (listing, error) {
+func (p *parser) ParseListing(buf *bytes.Buffer, version luaVersion) (listing, error) {
 	cp := chunksParser{
 		Scanner: bufio.NewScanner(buf),
+		version: version,
 	}
 
 	var chunks []chunk
@@ -88,6 +115,7 @@ func (p *parser) ParseListing(buf *bytes.Buffer) (listing, error) {
 
 type chunksParser struct {
 	*bufio.Scanner
+	version  luaVersion
 	metadata string
 }
 
@@ -104,7 +132,7 @@ func (p *chunksParser) ParseChunk() (chunk, error) {
 		return chunk{}, p.buildError(fmt.Errorf("parse instruction segment: %w", err))
 	}
 
-	constants, err := p.parseSegment("constants")
+	constants, err := p.parseConstantsSegment()
 	if err != nil {
 		return chunk{}, p.buildError(fmt.Errorf("parse constants segment: %w", err))
 	}
@@ -118,7 +146,7 @@ func (p *chunksParser) ParseChunk() (chunk, error) {
 		return chunk{}, p.buildError(errMissLocalsSegment)
 	}
 
-	upvalues, err := p.parseSegment("upvalues")
+	upvalues, upvalueRefs, err := p.parseUpvaluesSegment()
 	if err != nil {
 		return chunk{}, p.buildError(fmt.Errorf("parse upvalues segment: %w", err))
 	}
@@ -127,13 +155,11 @@ func (p *chunksParser) ParseChunk() (chunk, error) {
 		instructions: instructions,
 		constants:    constants,
 		upvalues:     upvalues,
+		upvalueRefs:  upvalueRefs,
+		functions:    h.functionCount,
 	}, nil
 }
 
-func (p *chunksParser) skipLine() bool {
-	return p.skipLines(1)
-}
-
 func (p *chunksParser) skipLines(count int) bool {
 	for i := 0; i < count; i++ {
 		if !p.Scan() {
@@ -154,11 +180,16 @@ func (p *chunksParser) buildError(err error) error {
 	return fmt.Errorf("%s: %w", p.metadata, err)
 }
 
-var headerRegexp = regexp.MustCompile(`<(?P<meta>.*.lua:\d+,\d+)>[[:space:]]\((?P<count>\d+)`)
+var (
+	headerRegexp    = regexp.MustCompile(`<(?P<meta>.*.lua:\d+,\d+)>[[:space:]]\((?P<count>\d+)`)
+	subheaderRegexp = regexp.MustCompile(`(\d+) functions?$`)
+	jumpRegexp      = regexp.MustCompile(`to (\d+)$`)
+)
 
 type header struct {
 	metadata         string
 	instructionCount int
+	functionCount    int
 }
 
 // parseHeader parses header of a chunk.
@@ -186,11 +217,22 @@ func (p *chunksParser) parseHeader() (header, error) {
 		return header{}, fmt.Errorf("map instructions count to int: %w", err)
 	}
 
-	if !p.skipLine() {
+	sh, ok := p.nextLine()
+	if !ok {
 		return header{}, fmt.Errorf("%s: %w", metaStr, errMissHeaderLine)
 	}
 
-	return header{metaStr, count}, nil
+	matches = subheaderRegexp.FindStringSubmatch(sh)
+	if matches == nil {
+		return header{}, fmt.Errorf("%s: %w", metaStr, errParseMetadata)
+	}
+
+	functions, err := strconv.Atoi(matches[1])
+	if err != nil {
+		return header{}, fmt.Errorf("map functions count to int: %w", err)
+	}
+
+	return header{metaStr, count, functions}, nil
 }
 
 // parseInstructionSegment parses instruction segment.
@@ -221,6 +263,90 @@ func (p *chunksParser) parseInstructionSegment(count int) ([]instruction, error)
 	return instructions, nil
 }
 
+// parseConstantsSegment parses constants segment.
+//
+// constants example:
+//
+//	1	"require"
+//	2	"mymod"
+//	3	"yopta.utils"
+//	4	2
+//	5	"say \"it\""
+//
+// Lua 5.4 constants example:
+//
+//	0	S	"require"
+//	1	I	2
+func (p *chunksParser) parseConstantsSegment() (map[int]constant, error) {
+	rawConstants, err := p.parseSegment("constants")
+	if err != nil {
+		return nil, err
+	}
+
+	if p.version >= lua54 {
+		for i, raw := range rawConstants {
+			// the constant type precedes the value
+			_, rawConstants[i], _ = strings.Cut(raw, "\t")
+		}
+	}
+
+	constants := make(map[int]constant, len(rawConstants))
+	for i, raw := range rawConstants {
+		c, err := parseConstant(raw)
+		if err != nil {
+			return nil, fmt.Errorf("constant %d: %w", i, err)
+		}
+		constants[i] = c
+	}
+
+	return constants, nil
+}
+
+// parseConstant unquotes string constant escaped by luac.
+// Luac escapes quotes, backslashes, control characters with C escapes
+// and other non-printable characters with decimal escapes.
+func parseConstant(raw string) (constant, error) {
+	const quotedMinLength = 2
+	if len(raw) < quotedMinLength || raw[0] != '"' || raw[len(raw)-1] != '"' {
+		return constant{value: raw}, nil
+	}
+
+	raw = raw[1 : len(raw)-1]
+
+	var sb strings.Builder
+	for i := 0; i < len(raw); i++ {
+		if raw[i] != '\\' {
+			sb.WriteByte(raw[i])
+			continue
+		}
+
+		i++
+		if i >= len(raw) {
+			return constant{}, fmt.Errorf("%w: unfinished escape", errParseConstant)
+		}
+
+		if r, ok := luaSimpleEscapes[raw[i]]; ok {
+			sb.WriteByte(r)
+			continue
+		}
+
+		const decimalEscapeLength = 3
+		if i+decimalEscapeLength > len(raw) {
+			return constant{}, fmt.Errorf("%w: wrong escape", errParseConstant)
+		}
+
+		v, err := strconv.ParseUint(raw[i:i+decimalEscapeLength], 10, 8)
+		if err != nil {
+			return constant{}, fmt.Errorf("%w: %w", errParseConstant, err)
+		}
+
+		sb.WriteByte(byte(v))
+		i += decimalEscapeLength - 1
+	}
+
+	return constant{value: sb.String(), isString: true}, nil
+}
+
 // parseSegment parses single segment.
 //
 // constant example:
@@ -232,10 +358,6 @@ func (p *chunksParser) parseInstructionSegment(count int) ([]instruction, error)
 //	5	"yopta_utils"
 //	6	"yopta.utils"
 //	7	"say_it"
-//
-// upvalues example:
-//
-//	0	_ENV	1	0
 func (p *chunksParser) parseSegment(name string) (map[int]string, error) {
 	length, err := p.parseSegmentLength(name)
 	if err != nil {
@@ -261,6 +383,61 @@ func (p *chunksParser) parseSegment(name string) (map[int]string, error) {
 	return segValues, err
 }
 
+// parseUpvaluesSegment parses upvalues segment.
+// Besides the names it returns references to the enclosing function values.
+//
+// upvalues example:
+//
+//	0	_ENV	1	0
+//	1	require	1	2
+//	2	say	0	1
+//
+// Lua 5.1 lists only names, references are given by pseudo-instructions following CLOSURE.
+func (p *chunksParser) parseUpvaluesSegment() (map[int]string, map[int]upvalueRef, error) {
+	const upvalueTokens = 4
+
+	length, err := p.parseSegmentLength("upvalues")
+	if err != nil {
+		return nil, nil, fmt.Errorf("parse segment length: %w", err)
+	}
+
+	names := make(map[int]string, length)
+	refs := make(map[int]upvalueRef, length)
+	for i := 0; i < length; i++ {
+		l, ok := p.nextLine()
+		if !ok {
+			return nil, nil,
+				fmt.Errorf("%w: required - %d, found - %d", errWrongSegmentLength, length, i+1)
+		}
+
+		idx, rest, err := p.parseSegmentLine(l)
+		if err != nil {
+			return nil, nil, fmt.Errorf("parse segment line %w", err)
+		}
+
+		if p.version == lua51 {
+			names[idx] = rest
+			continue
+		}
+
+		tokens := strings.Split(l, "\t")[1:]
+		if len(tokens) < upvalueTokens {
+			return nil, nil, fmt.Errorf("%w: min upvalue line tokens: %d, found: %d",
+				errWrongTokensLength, upvalueTokens, len(tokens))
+		}
+
+		ref, err := strconv.Atoi(tokens[3])
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: %w", errParseUpvalueRef, err)
+		}
+
+		names[idx] = tokens[1]
+		refs[idx] = upvalueRef{inStack: tokens[2] == "1", idx: ref}
+	}
+
+	return names, refs, nil
+}
+
 // parseSegmentLength parses segment length.
 //
 // segment header example:
@@ -285,17 +462,17 @@ func (p *chunksParser) parseSegmentLength(segName string) (int, error) {
 	return strconv.Atoi(matches[1])
 }
 
-// parseInstructionLine parses single instruction line.
+// parseInstructionLine parses single instruction line. Targets of jumps are taken from
+// the comment, because operands of jumps differ between Lua versions.
 //
 // instruction line examples:
 //
 //	14	[5]	RETURN   	0 1
 //	1	[1]	CALL     	0 1 1
+//	2	[-]	RETURN   	0 1
+//	4	[2]	JMP      	0 1	; to 6
 func (p *chunksParser) parseInstructionLine(str string) (instruction, error) {
-	const (
-		minTokens   = 4
-		minOperands = 2
-	)
+	const minTokens = 4
 	tokens := strings.Split(str, "\t")[1:]
 
 	if len(tokens) < minTokens {
@@ -303,58 +480,85 @@ func (p *chunksParser) parseInstructionLine(str string) (instruction, error) {
 			fmt.Errorf("%w: instruction line, min tokens: %d, found: %d", errWrongTokensLength, minTokens, len(tokens))
 	}
 
-	opcode, operandsLine := tokens[2], tokens[3]
-	a, b, c, err := p.parseOperandsLine(operandsLine)
+	lineToken, opcode, operandsLine := tokens[1], tokens[2], tokens[3]
+	operands, k, err := p.parseOperandsLine(operandsLine)
 	if err != nil {
 		return instruction{}, fmt.Errorf("parse operands line: %w", err)
 	}
 
-	return instruction{
+	// line is not known for stripped chunks
+	line, err := strconv.Atoi(strings.Trim(lineToken, "[]"))
+	if err != nil {
+		line = 0
+	}
+
+	in := instruction{
 		opcode: strings.TrimSpace(opcode),
-		a:      a,
-		b:      b,
-		c:      c,
-	}, nil
+		line:   line,
+		a:      operands[0],
+		b:      operands[1],
+		c:      operands[2],
+		k:      k,
+	}
+
+	if len(tokens) > minTokens && isJump(in.opcode) {
+		if matches := jumpRegexp.FindStringSubmatch(tokens[minTokens]); matches != nil {
+			in.jump, _ = strconv.Atoi(matches[1])
+		}
+	}
+
+	return in, nil
 }
 
 // parseOperandsLine parses operands.
 //
-// operands line example:
+// operands line examples:
 //
 //	0 1 1
-func (p *chunksParser) parseOperandsLine(line string) (int, int, int, error) {
-	const minOperands = 2
-	fields := strings.Fields(line)
+//	0 1 2k
+//	-3
+//
+// Some instructions have a single operand, Lua 5.4 RETURN0 has no operands at all.
+// Missing operands are zero, operands after the third one are ignored.
+func (p *chunksParser) parseOperandsLine(line string) ([3]int, bool, error) {
+	var (
+		operands [3]int
+		k        bool
+	)
 
+	minOperands := 1
+	if p.version >= lua54 {
+		minOperands = 0
+	}
+
+	fields := strings.Fields(line)
 	if len(fields) < minOperands {
-		return 0, 0, 0,
+		return operands, false,
 			fmt.Errorf("%w: instruction should have at least %d operands, found: %d",
 				errWrongTokensLength, minOperands, len(fields),
 			)
 	}
 
-	a, err := strconv.Atoi(fields[0])
-	if err != nil {
-		return 0, 0, 0, fmt.Errorf("convert operand a to int: %w", err)
-	}
-
-	b, err := strconv.Atoi(fields[1])
-	if err != nil {
-		return 0, 0, 0, fmt.Errorf("convert operand b to int: %w", err)
-	}
+	for i := 0; i < len(operands) && i < len(fields); i++ {
+		field := fields[i]
+		if p.version >= lua54 {
+			var isK bool
+			if field, isK = strings.CutSuffix(field, "k"); isK {
+				k = true
+			}
+		}
 
-	var c int
-	if len(fields) > minOperands {
-		c, err = strconv.Atoi(fields[2])
+		v, err := strconv.Atoi(field)
 		if err != nil {
-			return 0, 0, 0, fmt.Errorf("convert operand c to int: %w", err)
+			return operands, false, fmt.Errorf("convert operand %c to int: %w", 'a'+i, err)
 		}
+		operands[i] = v
 	}
 
-	return a, b, c, nil
+	return operands, k, nil
 }
 
-// parse segment line parses single segment line.
+// parse segment line parses single segment line into the index and the rest of the line.
 //
 // segment line examples:
 //
@@ -362,7 +566,7 @@ func (p *chunksParser) parseOperandsLine(line string) (int, int, int, error) {
 //	0	_ENV	1	0
 func (*chunksParser) parseSegmentLine(line string) (int, string, error) {
 	const minTokens = 2
-	tokens := strings.Split(line, "\t")[1:]
+	tokens := strings.SplitN(line, "\t", minTokens+1)[1:]
 
 	if len(tokens) < minTokens {
 		return 0, "",
@@ -370,5 +574,5 @@ func (*chunksParser) parseSegmentLine(line string) (int, string, error) {
 	}
 
 	i, err := strconv.Atoi(tokens[0])
-	return i, strings.ReplaceAll(tokens[1], "\"", ""), err
+	return i, tokens[1], err
 }
@@ -3,9 +3,22 @@ package analyzer
 import (
 	"errors"
 	"fmt"
+	"sort"
+	"strconv"
+	"strings"
 )
 
-var errMissEnvUpvalue = errors.New("miss _ENV upvalue")
+var errWrongFunctionsCount = errors.New("wrong nested functions count")
+
+// moduleRequire is a module required by another module.
+// Optional requires are protected with pcall, so the module may be absent at runtime.
+// Dynamic requires have no name, because it is not known statically.
+type moduleRequire struct {
+	name     string
+	optional bool
+	dynamic  bool
+	line     int
+}
 
 type resolver struct{}
 
@@ -13,114 +26,528 @@ func newResolver() *resolver {
 	return &resolver{}
 }
 
-func (*resolver) ResolveListingRequires(listing listing) ([]string, error) {
-	r := chunkResolver{make(map[string]struct{})}
+func (*resolver) ResolveListingRequires(listing listing, version luaVersion) ([]moduleRequire, error) {
+	r := chunkResolver{
+		listing:  listing,
+		version:  version,
+		children: make([][]int, len(listing)),
+		resolved: newRequireSet(),
+	}
+
+	if err := r.ResolveListing(); err != nil {
+		return nil, fmt.Errorf("resolve chunk requires: %w", err)
+	}
+
+	return r.resolved.Requires(), nil
+}
+
+// valueKind is a kind of value tracked by resolvers. Only values which
+// could lead to a require call are tracked, everything else is unknown.
+type valueKind int
+
+const (
+	valueUnknown valueKind = iota
+	valueRequire
+	valuePcall
+	valueGlobals
+	valueString
+	valueNumber
+	valueTable
+)
+
+// value is a tracked value. Str holds strings and string representation
+// of numbers, table holds known fields of tables.
+type value struct {
+	kind  valueKind
+	str   string
+	table constTable
+}
+
+func constantValue(c constant) value {
+	if c.isString {
+		return value{kind: valueString, str: c.value}
+	}
+	if _, err := strconv.ParseFloat(c.value, 64); err == nil {
+		return value{kind: valueNumber, str: c.value}
+	}
+	return value{}
+}
+
+func (v value) isConstant() bool {
+	return v.kind == valueString || v.kind == valueNumber
+}
+
+// concatValues returns the value of concatenation, known only if all operands are constants.
+func concatValues(values ...value) value {
+	var sb strings.Builder
+	for _, v := range values {
+		if !v.isConstant() {
+			return value{}
+		}
+		sb.WriteString(v.str)
+	}
+	return value{kind: valueString, str: sb.String()}
+}
+
+// constTable holds fields of a table with constant keys.
+// A table with fields assigned by unknown keys is unknown.
+type constTable map[tableKey]value
+
+type tableKey struct {
+	kind valueKind
+	str  string
+}
+
+func newTableValue() value {
+	return value{kind: valueTable, table: make(constTable)}
+}
+
+// SetField sets the field of the table value if both the table and the key are known.
+// Otherwise the table becomes unknown, because any of its fields could be changed.
+func (v value) SetField(key, field value) {
+	if v.kind != valueTable {
+		return
+	}
+
+	if !key.isConstant() {
+		clear(v.table)
+		v.table[tableKey{kind: valueUnknown}] = value{}
+		return
+	}
+
+	v.table[tableKey{kind: key.kind, str: key.str}] = field
+}
+
+// indexValue returns the value of obj[key].
+func indexValue(obj, key value) value {
+	switch obj.kind {
+	case valueGlobals:
+		if key.kind == valueString {
+			return globalValue(key.str)
+		}
+	case valueTable:
+		if _, tainted := obj.table[tableKey{kind: valueUnknown}]; !tainted && key.isConstant() {
+			return obj.table[tableKey{kind: key.kind, str: key.str}]
+		}
+	case valueUnknown, valueRequire, valuePcall, valueString, valueNumber:
+	}
+	return value{}
+}
+
+// globalValue returns the value of the global variable with the given name.
+func globalValue(name string) value {
+	switch name {
+	case "require":
+		return value{kind: valueRequire}
+	case "pcall":
+		return value{kind: valuePcall}
+	case "_G":
+		return value{kind: valueGlobals}
+	}
+	return value{}
+}
+
+// requireOf returns the required module of the call with the given function and arguments values.
+// Both require("mod") and pcall(require, "mod") are recognized, the latter is optional.
+// Requires with non-constant module name are dynamic.
+func requireOf(fn value, args []value, line int) (moduleRequire, bool) {
+	arg := func(i int) value {
+		if i < len(args) {
+			return args[i]
+		}
+		return value{}
+	}
+
+	var (
+		name     value
+		optional bool
+	)
 
-	for _, chunk := range listing {
-		err := r.ResolveChunkRequires(chunk)
-		if err != nil {
-			return nil, fmt.Errorf("resolve chunk requires: %w", err)
+	switch fn.kind {
+	case valueRequire:
+		name = arg(0)
+	case valuePcall:
+		if arg(0).kind != valueRequire {
+			return moduleRequire{}, false
 		}
+		name, optional = arg(1), true
+	case valueUnknown, valueGlobals, valueString, valueNumber, valueTable:
+		return moduleRequire{}, false
+	}
+
+	if name.kind != valueString {
+		return moduleRequire{optional: optional, dynamic: true, line: line}, true
+	}
+
+	return moduleRequire{name: name.str, optional: optional, line: line}, true
+}
+
+// requireSet is a set of required modules. A module is optional
+// only if all its requires are optional. Each dynamic require is kept.
+type requireSet struct {
+	static  map[string]moduleRequire
+	dynamic []moduleRequire
+}
+
+func newRequireSet() *requireSet {
+	return &requireSet{static: make(map[string]moduleRequire)}
+}
+
+func (s *requireSet) Add(r moduleRequire) {
+	if r.dynamic {
+		s.dynamic = append(s.dynamic, r)
+		return
+	}
+
+	if prev, ok := s.static[r.name]; !ok || (prev.optional && !r.optional) {
+		s.static[r.name] = r
 	}
+}
 
-	return r.ResolvedRequires(), nil
+// Requires returns static requires sorted by names followed by dynamic ones in order of appearance.
+func (s *requireSet) Requires() []moduleRequire {
+	requires := make([]moduleRequire, 0, len(s.static)+len(s.dynamic))
+	for _, r := range s.static {
+		requires = append(requires, r)
+	}
+	sort.Slice(requires, func(i, j int) bool { return requires[i].name < requires[j].name })
+	return append(requires, s.dynamic...)
 }
 
+// chunkResolver tracks values of registers and upvalues through the chunk instructions.
+// Values of the enclosing function are passed to nested functions on closure creation,
+// so aliases like local require = require are followed into nested functions.
+// Instructions are resolved in order, so values assigned in branches and loops are
+// forgotten at jump targets, where different paths meet, see branchJoins.
+// Instruction sets differ between Lua versions, see resolveInstruction* methods.
 type chunkResolver struct {
-	resolved map[string]struct{}
+	listing  listing
+	version  luaVersion
+	children [][]int
+	resolved *requireSet
 }
 
-func (c *chunkResolver) ResolveChunkRequires(ch chunk) error {
-	requireID, ok := findKey(ch.constants, "require")
-	if !ok {
+func (c *chunkResolver) ResolveListing() error {
+	if len(c.listing) == 0 {
 		return nil
 	}
 
-	envID, ok := findKey(ch.upvalues, "_ENV")
-	if !ok {
-		return errMissEnvUpvalue
+	if next, err := c.indexChildren(0); err != nil {
+		return err
+	} else if next != len(c.listing) {
+		return fmt.Errorf("%w: %d chunks are not nested into main", errWrongFunctionsCount, len(c.listing)-next)
 	}
 
-	checkIsRequire := func(i instruction) bool {
-		return i.b == envID && i.c == -requireID
+	c.ResolveChunkRequires(0, nil)
+
+	return nil
+}
+
+// indexChildren fills listing indexes of the nested functions chunks
+// and returns the index of the chunk next to the function with all nested functions.
+func (c *chunkResolver) indexChildren(idx int) (int, error) {
+	next := idx + 1
+	for i := 0; i < c.listing[idx].functions; i++ {
+		if next >= len(c.listing) {
+			return 0, fmt.Errorf("%w: chunk %d, required - %d, found - %d",
+				errWrongFunctionsCount, idx, c.listing[idx].functions, i)
+		}
+
+		c.children[idx] = append(c.children[idx], next)
+
+		var err error
+		if next, err = c.indexChildren(next); err != nil {
+			return 0, err
+		}
 	}
+	return next, nil
+}
 
-	checkHasRegisters := func(i instruction, requireReg, constantReg int) bool {
-		return i.a == requireReg && i.b == 2 && i.a+1 == constantReg
+func (c *chunkResolver) ResolveChunkRequires(idx int, upvalues map[int]value) {
+	f := &frame{
+		idx:      idx,
+		chunk:    c.listing[idx],
+		regs:     make(registers),
+		upvalues: upvalues,
+	}
+	if c.version >= lua52 {
+		f.envID, f.hasEnv = findKey(f.chunk.upvalues, "_ENV")
 	}
 
-	cursor := newCursor(ch.instructions)
-	for cursor.HasNext() {
-		gettabup, ok := cursor.MoveForwardUntil(func(i instruction) bool {
-			return i.opcode == "GETTABUP"
-		})
-		if !ok || !checkIsRequire(gettabup) {
-			continue
+	joins := c.branchJoins(idx)
+	for pc := 0; pc < len(f.chunk.instructions); pc++ {
+		if j, ok := joins[pc]; ok {
+			j.Apply(f.regs)
 		}
 
-		loadk, ok := cursor.MoveForward()
-		if !ok || loadk.opcode != "LOADK" {
-			continue
+		in := f.chunk.instructions[pc]
+		switch c.version {
+		case lua51:
+			pc += c.resolveInstruction51(f, in, pc)
+		case lua54:
+			c.resolveInstruction54(f, in)
+		case lua52, lua53:
+			c.resolveInstruction53(f, in)
 		}
+	}
+}
+
+// join holds registers which values are not known at a jump target, because they are
+// changed on some of the paths leading to it. Tables of changed registers keep
+// the identity, but any of their fields could be changed.
+type join struct {
+	regs      map[int]struct{}
+	tables    map[int]struct{}
+	clearFrom int
+}
+
+func newJoin() *join {
+	return &join{regs: make(map[int]struct{}), tables: make(map[int]struct{}), clearFrom: -1}
+}
+
+func (j *join) Apply(regs registers) {
+	for r := range j.tables {
+		regs[r].SetField(value{}, value{})
+	}
+	for r := range j.regs {
+		delete(regs, r)
+	}
+	if j.clearFrom >= 0 {
+		regs.ClearFrom(j.clearFrom)
+	}
+}
 
-		call, ok := cursor.MoveForward()
-		if !ok || call.opcode != "CALL" || !checkHasRegisters(call, gettabup.a, loadk.a) {
+// branchJoins returns joins of the chunk by 0-based jump targets. Instructions skipped by a forward
+// jump may not be executed, instructions of a loop body may be executed again after the loop start.
+func (c *chunkResolver) branchJoins(idx int) map[int]*join {
+	instructions := c.listing[idx].instructions
+	pseudo := c.pseudoInstructions(idx)
+
+	joins := make(map[int]*join)
+	for pc, in := range instructions {
+		target := in.jump - 1
+		if in.jump == 0 || target < 0 || target >= len(instructions) {
 			continue
 		}
 
-		req, ok := ch.constants[-loadk.b]
+		first, last := pc+1, target-1
+		if target <= pc {
+			first, last = target, pc
+		}
+
+		j, ok := joins[target]
 		if !ok {
+			j = newJoin()
+			joins[target] = j
+		}
+
+		for i := first; i <= last; i++ {
+			if _, ok := pseudo[i]; !ok {
+				j.add(instructions[i])
+			}
+		}
+	}
+
+	return joins
+}
+
+// add records registers changed by the instruction.
+func (j *join) add(in instruction) {
+	switch in.opcode {
+	case "SETTABLE", "SETI", "SETFIELD", "SETLIST":
+		j.tables[in.a] = struct{}{}
+	case "CALL", "TAILCALL", "LOADNIL", "SELF", "VARARG",
+		"FORPREP", "FORLOOP", "TFORPREP", "TFORCALL", "TFORLOOP":
+		if j.clearFrom < 0 || in.a < j.clearFrom {
+			j.clearFrom = in.a
+		}
+	case "SETTABUP", "SETUPVAL", "SETGLOBAL", "JMP", "EQ", "LT", "LE", "EQK", "EQI", "LTI", "LEI", "GTI", "GEI",
+		"TEST", "RETURN", "RETURN0", "RETURN1", "CLOSE", "TBC", "VARARGPREP",
+		"MMBIN", "MMBINI", "MMBINK", "EXTRAARG":
+	default:
+		j.regs[in.a] = struct{}{}
+	}
+}
+
+// pseudoInstructions returns indexes of Lua 5.1 pseudo-instructions capturing upvalues after CLOSURE.
+// They do not change registers.
+func (c *chunkResolver) pseudoInstructions(idx int) map[int]struct{} {
+	pseudo := make(map[int]struct{})
+	if c.version != lua51 {
+		return pseudo
+	}
+
+	for pc, in := range c.listing[idx].instructions {
+		if in.opcode != "CLOSURE" || in.b < 0 || in.b >= len(c.children[idx]) {
 			continue
 		}
+		for i := range len(c.listing[c.children[idx][in.b]].upvalues) {
+			pseudo[pc+1+i] = struct{}{}
+		}
+	}
 
-		c.resolved[req] = struct{}{}
+	return pseudo
+}
+
+// isJump reports whether the instruction jumps to the target shown in the listing.
+func isJump(opcode string) bool {
+	switch opcode {
+	case "JMP", "FORPREP", "FORLOOP", "TFORPREP", "TFORLOOP":
+		return true
+	default:
+		return false
 	}
+}
 
-	return nil
+// frame is a state of a function being resolved.
+type frame struct {
+	idx      int
+	chunk    chunk
+	regs     registers
+	upvalues map[int]value
+	envID    int
+	hasEnv   bool
 }
 
-func (c *chunkResolver) ResolvedRequires() []string {
-	s := make([]string, 0, len(c.resolved))
-	for v := range c.resolved {
-		s = append(s, v)
+func (f *frame) upvalue(i int) value {
+	if f.hasEnv && i == f.envID {
+		return value{kind: valueGlobals}
 	}
-	return s
+	return f.upvalues[i]
 }
 
-type cursor struct {
-	instructions []instruction
-	pc           int
+// rk returns the value of a register or a constant encoded as a negative operand
+// in the listing of Lua versions before 5.4.
+func (f *frame) rk(i int) value {
+	if i < 0 {
+		return constantValue(f.chunk.constants[-i])
+	}
+	return f.regs[i]
 }
 
-type cursorPredFunc func(i instruction) bool
+// call resolves a require call and forgets the registers of the call.
+func (c *chunkResolver) call(f *frame, in instruction) {
+	if r, ok := requireOf(f.regs[in.a], callArgs(f.regs, in), in.line); ok {
+		c.resolved.Add(r)
+	}
+	f.regs.ClearFrom(in.a)
+}
 
-func newCursor(instructions []instruction) *cursor {
-	return &cursor{
-		instructions: instructions,
-		pc:           -1,
+// child returns the listing index of the nested function with the given index in the enclosing function.
+func (c *chunkResolver) child(f *frame, i int) (int, bool) {
+	if i < 0 || i >= len(c.children[f.idx]) {
+		return 0, false
 	}
+	return c.children[f.idx][i], true
 }
 
-func (c *cursor) HasNext() bool {
-	return c.pc+1 < len(c.instructions)
+// closure resolves the nested function with values its upvalues are referring to.
+func (c *chunkResolver) closure(f *frame, idx int, refs map[int]upvalueRef) {
+	upvalues := make(map[int]value, len(refs))
+	for i, ref := range refs {
+		if ref.inStack {
+			upvalues[i] = f.regs[ref.idx]
+		} else {
+			upvalues[i] = f.upvalue(ref.idx)
+		}
+	}
+
+	c.ResolveChunkRequires(idx, upvalues)
 }
 
-func (c *cursor) MoveForward() (instruction, bool) {
-	if !c.HasNext() {
-		return instruction{}, false
+// resolveInstruction53 resolves an instruction of Lua 5.2 and 5.3, they share the instruction set
+// except for bitwise operations and integer division which are not tracked.
+func (c *chunkResolver) resolveInstruction53(f *frame, in instruction) {
+	switch in.opcode {
+	case "GETTABUP":
+		f.regs[in.a] = indexValue(f.upvalue(in.b), f.rk(in.c))
+	case "GETTABLE":
+		f.regs[in.a] = indexValue(f.regs[in.b], f.rk(in.c))
+	case "GETUPVAL":
+		f.regs[in.a] = f.upvalue(in.b)
+	case "MOVE":
+		f.regs[in.a] = f.regs[in.b]
+	case "LOADK":
+		f.regs[in.a] = f.rk(in.b)
+	case "CONCAT":
+		f.regs[in.a] = concatRegisters(f.regs, in.b, in.c)
+	case "NEWTABLE":
+		f.regs[in.a] = newTableValue()
+	case "SETTABLE":
+		f.regs[in.a].SetField(f.rk(in.b), f.rk(in.c))
+	case "SETLIST":
+		resolveSetList(f.regs, in)
+	case "CALL", "TAILCALL":
+		c.call(f, in)
+	case "CLOSURE":
+		if idx, ok := c.child(f, in.b); ok {
+			c.closure(f, idx, c.listing[idx].upvalueRefs)
+		}
+		delete(f.regs, in.a)
+	case "LOADNIL", "SELF", "VARARG", "FORPREP", "FORLOOP", "TFORCALL", "TFORLOOP":
+		f.regs.ClearFrom(in.a)
+	case "SETTABUP", "SETUPVAL", "JMP", "EQ", "LT", "LE", "TEST", "RETURN", "EXTRAARG":
+	default:
+		delete(f.regs, in.a)
 	}
-	c.pc++
-	return c.instructions[c.pc], true
 }
 
-func (c *cursor) MoveForwardUntil(fn cursorPredFunc) (instruction, bool) {
-	for c.HasNext() {
-		next, _ := c.MoveForward()
-		if fn(next) {
-			return next, true
+// callArgs returns values of the call arguments.
+// B is the number of arguments plus one, or zero if arguments are up to the stack top.
+// In the latter case the last argument is a multiple results call, which has
+// already cleared its registers, so the known leading arguments are returned.
+func callArgs(regs registers, in instruction) []value {
+	const leadingArgs = 2
+
+	last := in.a + in.b - 1
+	if in.b == 0 {
+		last = in.a + leadingArgs
+	}
+
+	args := make([]value, 0, last-in.a)
+	for i := in.a + 1; i <= last; i++ {
+		args = append(args, regs[i])
+	}
+	return args
+}
+
+// resolveSetList sets positional fields of a table constructor before Lua 5.4:
+// R(A)[(C-1)*FPF+i] := R(A+i), 1 <= i <= B.
+func resolveSetList(regs registers, in instruction) {
+	// LFIELDS_PER_FLUSH from lopcodes.h
+	const fieldsPerFlush = 50
+
+	if in.b == 0 || in.c == 0 {
+		// number of fields or the batch are not known statically
+		regs[in.a].SetField(value{}, value{})
+		return
+	}
+
+	for i := 1; i <= in.b; i++ {
+		key := value{kind: valueNumber, str: strconv.Itoa((in.c-1)*fieldsPerFlush + i)}
+		regs[in.a].SetField(key, regs[in.a+i])
+	}
+}
+
+// concatRegisters returns the value of concatenation of registers from first to last.
+func concatRegisters(regs registers, first, last int) value {
+	operands := make([]value, 0, last-first+1)
+	for i := first; i <= last; i++ {
+		operands = append(operands, regs[i])
+	}
+	return concatValues(operands...)
+}
+
+// registers holds known values of a function registers.
+type registers map[int]value
+
+// ClearFrom forgets values of registers starting from the given one.
+func (r registers) ClearFrom(reg int) {
+	for i := range r {
+		if i >= reg {
+			delete(r, i)
 		}
 	}
-	return instruction{}, false
 }
 
 func findKey(values map[int]string, value string) (int, bool) {
@@ -0,0 +1,54 @@
+package analyzer
+
+// resolveInstruction51 resolves an instruction of Lua 5.1 and returns the number of
+// pseudo-instructions following it. Lua 5.1 has no _ENV: globals are accessed
+// with GETGLOBAL and SETGLOBAL, and upvalues of a closure are captured by
+// pseudo-instructions following CLOSURE: MOVE takes a register and GETUPVAL takes an upvalue.
+func (c *chunkResolver) resolveInstruction51(f *frame, in instruction, pc int) int {
+	switch in.opcode {
+	case "GETGLOBAL":
+		f.regs[in.a] = indexValue(value{kind: valueGlobals}, f.rk(in.b))
+	case "GETTABLE":
+		f.regs[in.a] = indexValue(f.regs[in.b], f.rk(in.c))
+	case "GETUPVAL":
+		f.regs[in.a] = f.upvalue(in.b)
+	case "MOVE":
+		f.regs[in.a] = f.regs[in.b]
+	case "LOADK":
+		f.regs[in.a] = f.rk(in.b)
+	case "CONCAT":
+		f.regs[in.a] = concatRegisters(f.regs, in.b, in.c)
+	case "NEWTABLE":
+		f.regs[in.a] = newTableValue()
+	case "SETTABLE":
+		f.regs[in.a].SetField(f.rk(in.b), f.rk(in.c))
+	case "SETLIST":
+		resolveSetList(f.regs, in)
+	case "CALL", "TAILCALL":
+		c.call(f, in)
+	case "CLOSURE":
+		idx, ok := c.child(f, in.b)
+		if !ok {
+			delete(f.regs, in.a)
+			return 0
+		}
+
+		pseudo := f.chunk.instructions[pc+1:]
+		refs := make(map[int]upvalueRef, len(c.listing[idx].upvalues))
+		for i := 0; i < len(c.listing[idx].upvalues) && i < len(pseudo); i++ {
+			refs[i] = upvalueRef{inStack: pseudo[i].opcode == "MOVE", idx: pseudo[i].b}
+		}
+
+		c.closure(f, idx, refs)
+		delete(f.regs, in.a)
+
+		return len(refs)
+	case "LOADNIL", "SELF", "VARARG", "FORPREP", "FORLOOP", "TFORLOOP":
+		f.regs.ClearFrom(in.a)
+	case "SETGLOBAL", "SETUPVAL", "JMP", "EQ", "LT", "LE", "TEST", "RETURN", "CLOSE":
+	default:
+		delete(f.regs, in.a)
+	}
+
+	return 0
+}
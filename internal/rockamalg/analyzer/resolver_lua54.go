@@ -0,0 +1,86 @@
+package analyzer
+
+import "strconv"
+
+// resolveInstruction54 resolves an instruction of Lua 5.4. Unlike previous versions,
+// constant operands are not negative: they are plain indexes of constants, either
+// by the instruction definition (GETFIELD, LOADK) or marked with the k flag (SETFIELD).
+// Small integers are immediate operands of LOADI, GETI and SETI.
+//
+//nolint:funlen // a case per tracked opcode
+func (c *chunkResolver) resolveInstruction54(f *frame, in instruction) {
+	k := func(i int) value {
+		return constantValue(f.chunk.constants[i])
+	}
+	rk := func(i int) value {
+		if in.k {
+			return k(i)
+		}
+		return f.regs[i]
+	}
+
+	switch in.opcode {
+	case "GETTABUP":
+		f.regs[in.a] = indexValue(f.upvalue(in.b), k(in.c))
+	case "GETTABLE":
+		f.regs[in.a] = indexValue(f.regs[in.b], f.regs[in.c])
+	case "GETI":
+		f.regs[in.a] = indexValue(f.regs[in.b], integerValue(in.c))
+	case "GETFIELD":
+		f.regs[in.a] = indexValue(f.regs[in.b], k(in.c))
+	case "GETUPVAL":
+		f.regs[in.a] = f.upvalue(in.b)
+	case "MOVE":
+		f.regs[in.a] = f.regs[in.b]
+	case "LOADK":
+		f.regs[in.a] = k(in.b)
+	case "LOADI":
+		f.regs[in.a] = integerValue(in.b)
+	case "LOADF":
+		f.regs[in.a] = floatValue(float64(in.b), lua54)
+	case "CONCAT":
+		f.regs[in.a] = concatRegisters(f.regs, in.a, in.a+in.b-1)
+	case "NEWTABLE":
+		f.regs[in.a] = newTableValue()
+	case "SETTABLE":
+		f.regs[in.a].SetField(f.regs[in.b], rk(in.c))
+	case "SETI":
+		f.regs[in.a].SetField(integerValue(in.b), rk(in.c))
+	case "SETFIELD":
+		f.regs[in.a].SetField(k(in.b), rk(in.c))
+	case "SETLIST":
+		resolveSetList54(f.regs, in)
+	case "CALL", "TAILCALL":
+		c.call(f, in)
+	case "CLOSURE":
+		if idx, ok := c.child(f, in.b); ok {
+			c.closure(f, idx, c.listing[idx].upvalueRefs)
+		}
+		delete(f.regs, in.a)
+	case "LOADNIL", "SELF", "VARARG", "FORPREP", "FORLOOP", "TFORPREP", "TFORCALL", "TFORLOOP":
+		f.regs.ClearFrom(in.a)
+	case "SETTABUP", "SETUPVAL", "JMP", "EQ", "LT", "LE", "EQK", "EQI", "LTI", "LEI", "GTI", "GEI",
+		"TEST", "RETURN", "RETURN0", "RETURN1", "CLOSE", "TBC", "VARARGPREP",
+		"MMBIN", "MMBINI", "MMBINK", "EXTRAARG":
+	default:
+		delete(f.regs, in.a)
+	}
+}
+
+// resolveSetList54 sets positional fields of a table constructor in Lua 5.4:
+// R[A][C+i] := R[A+i], 1 <= i <= B.
+func resolveSetList54(regs registers, in instruction) {
+	if in.b == 0 || in.k {
+		// number of fields or the offset are not known statically
+		regs[in.a].SetField(value{}, value{})
+		return
+	}
+
+	for i := 1; i <= in.b; i++ {
+		regs[in.a].SetField(integerValue(in.c+i), regs[in.a+i])
+	}
+}
+
+func integerValue(i int) value {
+	return value{kind: valueNumber, str: strconv.Itoa(i)}
+}
@@ -0,0 +1,157 @@
+package analyzer
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// Listings of testdata/listings are made with luac -l -l of the corresponding Lua version.
+func TestResolveListingRequires(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		listing  string
+		version  luaVersion
+		requires []moduleRequire
+	}{
+		{
+			// values assigned in branches and loops are not known after them
+			name:    "branches",
+			listing: "testdata/listings/branches53.txt",
+			version: lua53,
+			requires: []moduleRequire{
+				{name: "d", line: 6},
+				{dynamic: true, line: 3},
+				{dynamic: true, line: 4},
+			},
+		},
+		{
+			// globals, CLOSURE pseudo-instructions and 1-based RK constants
+			name:    "lua51",
+			listing: "testdata/listings/lua51.txt",
+			version: lua51,
+			requires: []moduleRequire{
+				{name: "mod.b", line: 3},
+				{name: "mod.c", line: 5},
+				{dynamic: true, line: 6},
+			},
+		},
+		{
+			// typed 0-based constants, k flags, GETI and SETLIST without batches
+			name:    "lua54",
+			listing: "testdata/listings/lua54.txt",
+			version: lua54,
+			requires: []moduleRequire{
+				{name: "mod.a", line: 3},
+				{name: "mod.c", line: 7},
+				{name: "mod.n", line: 4},
+				{dynamic: true, line: 5},
+				{dynamic: true, line: 8},
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			data, err := os.ReadFile(tc.listing)
+			require.NoError(t, err)
+
+			l, err := newParser().ParseListing(bytes.NewBuffer(data), tc.version)
+			require.NoError(t, err)
+
+			requires, err := newResolver().ResolveListingRequires(l, tc.version)
+			require.NoError(t, err)
+			require.Equal(t, tc.requires, requires)
+		})
+	}
+}
+
+func TestResolveListingFunctionsCount(t *testing.T) {
+	t.Parallel()
+
+	data, err := os.ReadFile("testdata/listings/lua54.txt")
+	require.NoError(t, err)
+
+	// the main chunk claims more nested functions than the listing has
+	data = bytes.Replace(data, []byte("1 function\n"), []byte("2 functions\n"), 1)
+
+	l, err := newParser().ParseListing(bytes.NewBuffer(data), lua54)
+	require.NoError(t, err)
+
+	_, err = newResolver().ResolveListingRequires(l, lua54)
+	require.ErrorIs(t, err, errWrongFunctionsCount)
+}
+
+func TestResolveSourceRequires(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		src      string
+		requires []moduleRequire
+	}{
+		{
+			name: "fields",
+			src: `local t = {m = "a"}
+t.m = "b"
+require(t.m)`,
+			requires: []moduleRequire{{name: "b", line: 3}},
+		},
+		{
+			name: "fields assigned in branches",
+			src: `local t = {m = "a", n = "n"}
+if x then t.m = "b" else t.m = "c"; require(t.m) end
+require(t.m)
+require(t.n)`,
+			requires: []moduleRequire{
+				{name: "c", line: 2},
+				{name: "n", line: 4},
+				{dynamic: true, line: 3},
+			},
+		},
+		{
+			name: "fields assigned in loops",
+			src: `local t = {m = "a"}
+for i = 1, 2 do require(t.m); t.m = "b" end
+while x do t.m = "c" end
+require(t.m)`,
+			requires: []moduleRequire{
+				{dynamic: true, line: 2},
+				{dynamic: true, line: 4},
+			},
+		},
+		{
+			name: "fields assigned in functions",
+			src: `local t = {m = "a"}
+local function f() require(t.m); t.m = "b" end
+require(t.m)`,
+			requires: []moduleRequire{
+				{dynamic: true, line: 2},
+				{dynamic: true, line: 3},
+			},
+		},
+		{
+			name: "fields assigned by unknown keys in branches",
+			src: `local t = {m = "a"}
+if x then t[x] = "b" end
+require(t.m)`,
+			requires: []moduleRequire{{dynamic: true, line: 3}},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			b, err := newSourceParser().ParseSource([]byte(tc.src), lua53)
+			require.NoError(t, err)
+			require.Equal(t, tc.requires, newResolver().ResolveSourceRequires(b, lua53))
+		})
+	}
+}
@@ -0,0 +1,217 @@
+package analyzer
+
+import (
+	"strconv"
+	"strings"
+)
+
+// luaFloatDigits is the precision of LUAI_NUMFFORMAT "%.14g".
+const luaFloatDigits = 14
+
+// ResolveSourceRequires finds requires of modules with constant names in the AST of a module.
+// Calls of the global require function, its aliases and pcall-protected requires
+// are taken into account, the same way as ResolveListingRequires does for the bytecode listing.
+func (*resolver) ResolveSourceRequires(b *block, version luaVersion) []moduleRequire {
+	r := sourceResolver{
+		version:  version,
+		locals:   make(map[*localVar]value),
+		resolved: newRequireSet(),
+	}
+
+	inspectBlock(b, r.Visit)
+
+	return r.resolved.Requires()
+}
+
+// sourceResolver tracks values of local variables which are never reassigned.
+// Nested functions share local variables with the enclosing function, so
+// upvalues need no special handling. Fields of tables are tracked in the source order,
+// fields assigned in branches, loops and functions are not known after them.
+type sourceResolver struct {
+	version  luaVersion
+	locals   map[*localVar]value
+	resolved *requireSet
+	// branch is the innermost branch being visited
+	branch any
+}
+
+func (r *sourceResolver) Visit(node any) bool {
+	if node != r.branch && isBranch(node) {
+		r.visitBranch(node)
+		return false
+	}
+
+	switch n := node.(type) {
+	case *localStat:
+		for i, v := range n.vars {
+			if i < len(n.exprs) && !v.assigned {
+				r.locals[v] = r.eval(n.exprs[i])
+			}
+		}
+	case *assignStat:
+		// all expressions are evaluated before the assignment
+		values := make([]value, len(n.targets))
+		for i := range values {
+			if i < len(n.exprs) {
+				values[i] = r.eval(n.exprs[i])
+			}
+		}
+		for i, t := range n.targets {
+			if idx, ok := t.(*indexExpr); ok {
+				r.eval(idx.obj).SetField(r.eval(idx.key), values[i])
+			}
+		}
+	case *callExpr:
+		args := make([]value, 0, len(n.args))
+		for _, a := range n.args {
+			args = append(args, r.eval(a))
+		}
+		if req, ok := requireOf(r.eval(n.fn), args, n.line); ok {
+			r.resolved.Add(req)
+		}
+	}
+	return true
+}
+
+// visitBranch visits a statement or a function which body may be skipped or executed
+// several times. Fields assigned in loops and functions are not known before the body,
+// fields assigned in any branch are not known after it.
+func (r *sourceResolver) visitBranch(node any) {
+	outer := r.branch
+	r.branch = node
+	defer func() { r.branch = outer }()
+
+	switch n := node.(type) {
+	case *functionExpr:
+		r.forgetFields(n)
+		inspectExpr(n, r.Visit)
+		r.forgetFields(n)
+	case *ifStat:
+		inspectStat(n, r.Visit)
+		r.forgetFields(n)
+	case stat:
+		r.forgetFields(n)
+		inspectStat(n, r.Visit)
+		r.forgetFields(n)
+	}
+}
+
+// forgetFields makes fields assigned in the node unknown.
+func (r *sourceResolver) forgetFields(node any) {
+	forget := func(node any) bool {
+		if st, ok := node.(*assignStat); ok {
+			for _, t := range st.targets {
+				if idx, ok := t.(*indexExpr); ok {
+					r.eval(idx.obj).SetField(r.eval(idx.key), value{})
+				}
+			}
+		}
+		return true
+	}
+
+	switch n := node.(type) {
+	case *functionExpr:
+		inspectExpr(n, forget)
+	case stat:
+		inspectStat(n, forget)
+	}
+}
+
+func isBranch(node any) bool {
+	switch node.(type) {
+	case *ifStat, *whileStat, *repeatStat, *numericForStat, *genericForStat, *functionExpr:
+		return true
+	}
+	return false
+}
+
+func (r *sourceResolver) eval(e expr) value {
+	switch e := e.(type) {
+	case *nameExpr:
+		if e.local != nil {
+			return r.locals[e.local]
+		}
+		if e.env != nil {
+			return value{}
+		}
+		if e.name == "_ENV" && r.version >= lua52 {
+			// _ENV is an upvalue of the main chunk, not a global
+			return value{kind: valueGlobals}
+		}
+		return globalValue(e.name)
+	case *indexExpr:
+		return indexValue(r.eval(e.obj), r.eval(e.key))
+	case *stringExpr:
+		return value{kind: valueString, str: e.value}
+	case *numberExpr:
+		return numberValue(e.value, r.version)
+	case *binopExpr:
+		if e.op == ".." {
+			return concatValues(r.eval(e.lhs), r.eval(e.rhs))
+		}
+	case *tableExpr:
+		return r.evalTable(e)
+	case *parenExpr:
+		return r.eval(e.inner)
+	}
+	return value{}
+}
+
+func (r *sourceResolver) evalTable(t *tableExpr) value {
+	tv := newTableValue()
+
+	pos := 0
+	for i, f := range t.fields {
+		if f.key != nil {
+			tv.SetField(r.eval(f.key), r.eval(f.value))
+			continue
+		}
+
+		pos++
+		switch f.value.(type) {
+		case *callExpr, *methodCallExpr, *varargExpr:
+			if i == len(t.fields)-1 {
+				// the last multiple results expression fills an unknown number of fields
+				tv.SetField(value{}, value{})
+				continue
+			}
+		}
+		tv.SetField(value{kind: valueNumber, str: strconv.Itoa(pos)}, r.eval(f.value))
+	}
+
+	return tv
+}
+
+// numberValue converts a numeral to the value with the same string representation
+// as tostring gives. Since Lua 5.3 integers are decimal and floats have at least
+// one decimal place, before Lua 5.3 all numbers are floats printed with %.14g.
+func numberValue(numeral string, version luaVersion) value {
+	hex, isHex := strings.CutPrefix(strings.ToLower(numeral), "0x")
+	if isHex {
+		// hexadecimal integers wrap around on overflow
+		if u, err := strconv.ParseUint(hex, 16, 64); err == nil {
+			if version < lua53 {
+				return floatValue(float64(u), version)
+			}
+			return value{kind: valueNumber, str: strconv.FormatInt(int64(u), 10)}
+		}
+	} else if i, err := strconv.ParseInt(numeral, 10, 64); err == nil && version >= lua53 {
+		return value{kind: valueNumber, str: strconv.FormatInt(i, 10)}
+	}
+
+	f, err := strconv.ParseFloat(numeral, 64)
+	if err != nil {
+		return value{}
+	}
+
+	return floatValue(f, version)
+}
+
+func floatValue(f float64, version luaVersion) value {
+	str := strconv.FormatFloat(f, 'g', luaFloatDigits, 64)
+	if version >= lua53 && strings.Trim(str, "-0123456789") == "" {
+		str += ".0"
+	}
+
+	return value{kind: valueNumber, str: str}
+}
@@ -0,0 +1,101 @@
+package analyzer
+
+import (
+	"errors"
+	"fmt"
+)
+
+var errNotTableLiteral = errors.New("not a table literal")
+
+// ReadTable reads a Lua file with the single assignment of a table constructor to the global
+// variable, like rock_manifest or manifest files written by luarocks. Nested tables are returned
+// as maps and strings as strings, keys should be strings. Other values are not supported.
+func ReadTable(src []byte, name string) (map[string]any, error) {
+	// luarocks writes these files for any Lua version, Lua 5.1 syntax is the common one
+	b, err := newSourceParser().ParseSource(src, lua51)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(b.stats) != 1 {
+		return nil, fmt.Errorf("%w: single assignment to %s is expected", errNotTableLiteral, name)
+	}
+
+	st, ok := b.stats[0].(*assignStat)
+	if !ok || len(st.targets) != 1 || len(st.exprs) != 1 || !isGlobal(st.targets[0], name) {
+		return nil, fmt.Errorf("%w: single assignment to %s is expected", errNotTableLiteral, name)
+	}
+
+	return readTableExpr(st.exprs[0])
+}
+
+// ReadStringList reads the list of strings assigned to the global variable by a top level statement
+// of a Lua file, like dependencies of rockspecs. The last assignment wins, the list is nil
+// if the variable is not assigned.
+func ReadStringList(src []byte, name string) ([]string, error) {
+	b, err := newSourceParser().ParseSource(src, lua51)
+	if err != nil {
+		return nil, err
+	}
+
+	var list expr
+	for _, st := range b.stats {
+		if st, ok := st.(*assignStat); ok {
+			for i, target := range st.targets {
+				if i < len(st.exprs) && isGlobal(target, name) {
+					list = st.exprs[i]
+				}
+			}
+		}
+	}
+
+	if list == nil {
+		return nil, nil
+	}
+
+	t, ok := list.(*tableExpr)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s: table is expected", errNotTableLiteral, name)
+	}
+
+	strs := make([]string, 0, len(t.fields))
+	for _, f := range t.fields {
+		s, ok := f.value.(*stringExpr)
+		if f.key != nil || !ok {
+			return nil, fmt.Errorf("%w: %s: list of strings is expected", errNotTableLiteral, name)
+		}
+		strs = append(strs, s.value)
+	}
+
+	return strs, nil
+}
+
+func readTableExpr(e expr) (map[string]any, error) {
+	t, ok := e.(*tableExpr)
+	if !ok {
+		return nil, fmt.Errorf("%w: table is expected", errNotTableLiteral)
+	}
+
+	fields := make(map[string]any, len(t.fields))
+	for _, f := range t.fields {
+		key, ok := f.key.(*stringExpr)
+		if !ok {
+			return nil, fmt.Errorf("%w: string key is expected", errNotTableLiteral)
+		}
+
+		switch v := f.value.(type) {
+		case *stringExpr:
+			fields[key.value] = v.value
+		case *tableExpr:
+			nested, err := readTableExpr(v)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", key.value, err)
+			}
+			fields[key.value] = nested
+		default:
+			return nil, fmt.Errorf("%w: %s: string or table is expected", errNotTableLiteral, key.value)
+		}
+	}
+
+	return fields, nil
+}
@@ -0,0 +1,83 @@
+package analyzer_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/enapter/rockamalg/internal/rockamalg/analyzer"
+)
+
+func TestReadTable(t *testing.T) {
+	t.Parallel()
+
+	table, err := analyzer.ReadTable([]byte(`-- written by luarocks
+rock_manifest = {
+   lua = {
+      ["lua-string"] = {
+         ["init.lua"] = "e9920ca802c3f0a56c00e837ce166653",
+      },
+      ['it\'s.lua'] = "4531899c522ab276618eb2ffd6e964af";
+   },
+   ["lua-string-1.2.0-1.rockspec"] = [[6bf2731cc78a94d27239f155ce6fa227]]
+}
+`), "rock_manifest")
+	require.NoError(t, err)
+	require.Equal(t, map[string]any{
+		"lua": map[string]any{
+			"lua-string": map[string]any{"init.lua": "e9920ca802c3f0a56c00e837ce166653"},
+			"it's.lua":   "4531899c522ab276618eb2ffd6e964af",
+		},
+		"lua-string-1.2.0-1.rockspec": "6bf2731cc78a94d27239f155ce6fa227",
+	}, table)
+}
+
+func TestReadTableErrors(t *testing.T) {
+	t.Parallel()
+
+	for _, src := range []string{
+		`rock_manifest = {`,
+		`manifest = {}`,
+		`rock_manifest = {}; x = 1`,
+		`rock_manifest = "lua"`,
+		`rock_manifest = {"lua"}`,
+		`rock_manifest = {[1] = "lua"}`,
+		`rock_manifest = {lua = {x = true}}`,
+		`local rock_manifest = {}`,
+	} {
+		_, err := analyzer.ReadTable([]byte(src), "rock_manifest")
+		require.Error(t, err, src)
+	}
+}
+
+func TestReadStringList(t *testing.T) {
+	t.Parallel()
+
+	src := []byte(`package = "app"
+local ver = "3.1"
+dependencies = { "lua >= 5.1" }
+dependencies = {
+   "lua ~> 5.3", -- "penlight", }
+   'inspect >= 3.1';
+}
+build = { type = "builtin", modules = { app = "app.lua" } }
+`)
+
+	list, err := analyzer.ReadStringList(src, "dependencies")
+	require.NoError(t, err)
+	require.Equal(t, []string{"lua ~> 5.3", "inspect >= 3.1"}, list)
+
+	list, err = analyzer.ReadStringList(src, "test_dependencies")
+	require.NoError(t, err)
+	require.Nil(t, list)
+
+	for _, src := range []string{
+		`dependencies = "inspect"`,
+		`dependencies = { inspect = "3.1" }`,
+		`dependencies = { "inspect >= " .. ver }`,
+		`dependencies = {`,
+	} {
+		_, err := analyzer.ReadStringList([]byte(src), "dependencies")
+		require.Error(t, err, src)
+	}
+}
@@ -0,0 +1,6 @@
+local m, r = "a", require
+if x then m = "b" end
+r(m)
+while x do r(m); m = "c" end
+if x then print("e") end
+r("d")
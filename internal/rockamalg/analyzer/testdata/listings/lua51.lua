@@ -0,0 +1,7 @@
+local r = require
+local t = {"mod.a", "mod.b"}
+r(t[2])
+local function load(...)
+  r("mod.c")
+  return r(...)
+end
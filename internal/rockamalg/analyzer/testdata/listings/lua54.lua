@@ -0,0 +1,9 @@
+local r = require
+local t = {"mod.a", "mod.b", n = "mod.n"}
+r(t[1])
+r(t.n)
+r(...)
+local function load(name)
+  r("mod.c")
+  return r(name)
+end
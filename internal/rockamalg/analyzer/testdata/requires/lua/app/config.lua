@@ -0,0 +1 @@
+return { debug = false }
@@ -0,0 +1,7 @@
+local helpers = {}
+
+function helpers.plugin(name)
+  return require("app.plugins." .. name)
+end
+
+return helpers
@@ -0,0 +1,7 @@
+local app = {}
+
+function app.run(rock)
+  return rock.version
+end
+
+return app
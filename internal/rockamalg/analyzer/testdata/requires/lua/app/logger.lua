@@ -0,0 +1,4 @@
+local os = require("os")
+local syslog = require("app.syslog")
+
+return { log = print, time = os.time, syslog = syslog }
@@ -0,0 +1 @@
+return "1.0.0"
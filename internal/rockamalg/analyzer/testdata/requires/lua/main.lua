@@ -0,0 +1,25 @@
+local app = require "app"
+local rock = require("rock")
+
+-- require("commented")
+local text = [[ require("quoted") ]]
+
+local function shadowed()
+  local require = print
+  require("shadowed")
+end
+
+local load = require
+local function helpers()
+  return load("app.helpers")
+end
+
+local has_json, json = pcall(require, "json")
+local logger = select(2, pcall(_G.require, "app.logger"))
+
+local prefix = "app."
+local modules = { config = prefix .. "config" }
+local config = require(modules.config)
+local version = require(prefix .. "version")
+
+app.run(rock, text, shadowed, helpers, has_json and json, logger, config, version)
@@ -0,0 +1,3 @@
+local util = require "rock.util"
+
+return { version = util.version() }
@@ -0,0 +1,7 @@
+local util = {
+  version = function() return "1.0" end,
+}
+
+util.backend = pcall(require, os.getenv("ROCK_BACKEND"))
+
+return util
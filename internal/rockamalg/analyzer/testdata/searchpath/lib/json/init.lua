@@ -0,0 +1,5 @@
+return {
+  encode = function(v)
+    return tostring(v)
+  end,
+}
@@ -0,0 +1,5 @@
+local app = require("app")
+local json = require("json")
+local rock = require("rock")
+
+app.run(json, rock)
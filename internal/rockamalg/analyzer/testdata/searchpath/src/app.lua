@@ -0,0 +1,7 @@
+local config = require("app.config")
+
+return {
+  run = function(json, rock)
+    print(json.encode(config), rock)
+  end,
+}
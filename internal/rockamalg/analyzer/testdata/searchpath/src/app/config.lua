@@ -0,0 +1 @@
+return { name = "app" }
@@ -0,0 +1,5 @@
+-- goto is not a keyword and numbers are always floats in Lua 5.1
+local goto = require
+local _ENV = { require = print }
+
+goto("mod" .. 1.0)
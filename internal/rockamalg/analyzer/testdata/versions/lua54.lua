@@ -0,0 +1,6 @@
+-- local attributes are Lua 5.4 only
+local load <const> = require
+local _ENV <close> = nil
+
+load("mod" .. 1.0)
+require("ignored")
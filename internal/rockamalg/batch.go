@@ -0,0 +1,201 @@
+package rockamalg
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+)
+
+type BatchParams struct {
+	Targets []AmalgParams
+	// Writer receives progress of all targets, writers of the targets are ignored.
+	Writer io.Writer
+}
+
+// BatchResult is a result of the target in the same position. Err is set if the target failed.
+type BatchResult struct {
+	AmalgResult
+	Err error
+}
+
+// batchTree is a rocks tree shared by targets with the same dependencies.
+type batchTree struct {
+	dir string
+	// lua is the first target which installed the tree
+	lua string
+	err error
+}
+
+// AmalgBatch amalgamates targets one by one. Dependencies are installed once for targets with
+// the same dependencies, vendor archive and lockfile, and such targets are amalgamated against
+// the shared rocks tree. Targets pruning the vendor install their own trees. A failed target
+// does not stop the batch.
+func (r *Rockamalg) AmalgBatch(ctx context.Context, p BatchParams) []BatchResult {
+	trees := make(map[string]*batchTree)
+	defer func() {
+		for _, t := range trees {
+			os.RemoveAll(t.dir)
+		}
+	}()
+
+	results := make([]BatchResult, len(p.Targets))
+	for i, target := range p.Targets {
+		if p.Writer != nil {
+			fmt.Fprintf(p.Writer, "[%d/%d] %s\n", i+1, len(p.Targets), target.Lua)
+		}
+		target.Writer = p.Writer
+
+		results[i].AmalgResult, results[i].Err = r.amalgBatchTarget(ctx, target, trees)
+		if results[i].Err != nil && p.Writer != nil {
+			fmt.Fprintln(p.Writer, "Error:", results[i].Err)
+		}
+	}
+
+	return results
+}
+
+func (r *Rockamalg) amalgBatchTarget(
+	ctx context.Context, p AmalgParams, trees map[string]*batchTree,
+) (AmalgResult, error) {
+	a, err := r.newAmalg(p)
+	if err != nil {
+		return AmalgResult{}, err
+	}
+	defer a.cleanup()
+
+	if err := a.wrapWithMsg(a.setupLuaConfig, "Setting up configuration")(ctx); err != nil {
+		return AmalgResult{}, fmt.Errorf("set up configuration: %w", err)
+	}
+
+	if err := a.setupHome(); err != nil {
+		return AmalgResult{}, err
+	}
+
+	key, err := a.treeKey()
+	if err != nil {
+		return AmalgResult{}, fmt.Errorf("dependencies key: %w", err)
+	}
+
+	if p.PruneVendor {
+		// pruning removes rocks from the tree, so the target does not share it
+		if err := a.setupPrivateTree(ctx); err != nil {
+			return AmalgResult{}, err
+		}
+	} else if t, ok := trees[key]; ok {
+		if t.err != nil {
+			return AmalgResult{}, fmt.Errorf("dependencies of %s: %w", t.lua, t.err)
+		}
+
+		a.tree = t.dir
+		if err := a.reuseTree(ctx, t.lua); err != nil {
+			return AmalgResult{}, err
+		}
+	} else {
+		t := &batchTree{lua: p.Lua}
+		if t.dir, err = os.MkdirTemp("/tmp", "luarocks_deps_"); err != nil {
+			return AmalgResult{}, fmt.Errorf("mkdir temp: %w", err)
+		}
+		trees[key] = t
+
+		a.tree = t.dir
+		if t.err = a.installTree(ctx); t.err != nil {
+			return AmalgResult{}, t.err
+		}
+	}
+
+	if err := a.amalgamateTree(ctx); err != nil {
+		return AmalgResult{}, err
+	}
+
+	return a.result(), nil
+}
+
+// setupPrivateTree installs dependencies into the tree removed on clean up of the target.
+func (a *amalg) setupPrivateTree(ctx context.Context) error {
+	dir, err := os.MkdirTemp("/tmp", "luarocks_deps_")
+	if err != nil {
+		return fmt.Errorf("mkdir temp: %w", err)
+	}
+	a.cleanupFns = append(a.cleanupFns, func() { os.RemoveAll(dir) })
+	a.tree = dir
+
+	return a.installTree(ctx)
+}
+
+// reuseTree prepares the target to use the tree installed for another target.
+// The rockspec is generated anyway, because the vendor archive is built for rockspecs only.
+func (a *amalg) reuseTree(ctx context.Context, lua string) error {
+	if a.p.Dependencies != "" {
+		if err := a.wrapWithMsg(a.generateRockspec, "Generating rockspec")(ctx); err != nil {
+			return fmt.Errorf("generate rockspec: %w", err)
+		}
+	}
+
+	reuse := func(context.Context) error { return nil }
+	if err := a.wrapWithMsg(reuse, "Reusing dependencies of "+lua)(ctx); err != nil {
+		return err
+	}
+
+	if a.p.Rockspec == "" {
+		return nil
+	}
+
+	if a.p.Locked {
+		if err := a.readLockedRocks(); err != nil {
+			return fmt.Errorf("check lockfile: %w", err)
+		}
+	}
+
+	return a.lockTree(ctx)
+}
+
+// treeKey identifies the rocks tree installed for the target. Files are hashed by contents,
+// so targets with equal dependencies share the tree even if the files are different.
+func (a *amalg) treeKey() (string, error) {
+	h := sha256.New()
+	fmt.Fprintf(h, "lua=%s dev=%t locked=%t offline=%t\n",
+		a.p.LuaVersion, a.p.AllowDevDeps, a.p.Locked, a.p.Offline)
+
+	files := map[string]string{
+		"deps":     a.p.Dependencies,
+		"rockspec": a.p.Rockspec,
+		"vendor":   a.p.Vendor,
+	}
+	if a.p.Locked {
+		files["lockfile"] = a.p.LockFile
+	}
+
+	// vendor directories are hashed file by file
+	if a.p.Vendor != "" && inputVendorFormat(a.p.Vendor) == VendorFormatDir {
+		delete(files, "vendor")
+
+		vendor, err := readVendorFiles(a.p.Vendor, VendorFormatDir)
+		if err != nil {
+			return "", err
+		}
+		for _, path := range sortedKeys(vendor) {
+			fmt.Fprintf(h, "vendor %s %d\n", path, len(vendor[path]))
+			h.Write(vendor[path])
+		}
+	}
+
+	for _, name := range []string{"deps", "rockspec", "vendor", "lockfile"} {
+		path := files[name]
+		if path == "" {
+			continue
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil && !os.IsNotExist(err) {
+			return "", fmt.Errorf("read %s: %w", name, err)
+		}
+
+		fmt.Fprintf(h, "%s %d\n", name, len(data))
+		h.Write(data)
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,43 @@
+package rockamalg
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAmalgBatch(t *testing.T) {
+	t.Parallel()
+
+	const testdata = "../../tests/integration/testdata/amalg"
+
+	dir := t.TempDir()
+	targets := []AmalgParams{
+		{Lua: filepath.Join(testdata, "multi_files_no_deps", "fw_dir"), Output: filepath.Join(dir, "multi.lua")},
+		{Lua: filepath.Join(dir, "missed"), Output: filepath.Join(dir, "missed.lua")},
+		{Lua: filepath.Join(testdata, "single_file_no_deps", "fw.lua"), Output: filepath.Join(dir, "single.lua")},
+	}
+
+	var progress bytes.Buffer
+	results := New(Params{}).AmalgBatch(context.Background(), BatchParams{Targets: targets, Writer: &progress})
+	require.Len(t, results, 3)
+
+	require.NoError(t, results[0].Err)
+	require.Error(t, results[1].Err)
+	require.NoError(t, results[2].Err)
+
+	for i, golden := range map[int]string{0: "multi_files_no_deps", 2: "single_file_no_deps"} {
+		expected, err := os.ReadFile(filepath.Join(testdata, golden, "out.lua"))
+		require.NoError(t, err)
+		actual, err := os.ReadFile(targets[i].Output)
+		require.NoError(t, err)
+		require.Equal(t, string(expected), string(actual))
+	}
+
+	// targets without dependencies share the empty tree
+	require.Contains(t, progress.String(), "Reusing dependencies of "+targets[0].Lua+"... Done\n")
+}
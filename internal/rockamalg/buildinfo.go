@@ -0,0 +1,142 @@
+package rockamalg
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// BuildInfoModule is a name of the virtual module with the build info.
+const BuildInfoModule = "rockamalg.buildinfo"
+
+// buildInfo describes how the result is produced. It is written as the header comment
+// and as the BuildInfoModule, so the code could report its build at runtime.
+type buildInfo struct {
+	rockamalg  string
+	time       string
+	version    string
+	git        string
+	luaVersion string
+	modules    []string
+	rocks      []installedRock
+}
+
+func (a *amalg) collectBuildInfo(ctx context.Context) error {
+	modules := a.moduleNames()
+	if slices.Contains(modules, BuildInfoModule) {
+		return fmt.Errorf("%w: %s", errBuildInfoModuleExists, BuildInfoModule)
+	}
+
+	buildTime, err := buildTime()
+	if err != nil {
+		return err
+	}
+
+	rocks, err := a.listRocks(ctx)
+	if err != nil {
+		return err
+	}
+
+	slices.SortFunc(rocks, func(x, y installedRock) int { return strings.Compare(x.name, y.name) })
+
+	a.buildInfo = &buildInfo{
+		rockamalg:  a.version,
+		time:       buildTime.Format(time.RFC3339),
+		version:    a.p.BuildVersion,
+		git:        a.gitDescribe(ctx),
+		luaVersion: a.p.LuaVersion,
+		modules:    modules,
+		rocks:      rocks,
+	}
+
+	return nil
+}
+
+// buildTime is taken from SOURCE_DATE_EPOCH if it is set, so builds stay reproducible.
+// See https://reproducible-builds.org/specs/source-date-epoch/.
+func buildTime() (time.Time, error) {
+	epoch := os.Getenv("SOURCE_DATE_EPOCH")
+	if epoch == "" {
+		return time.Now().UTC(), nil
+	}
+
+	sec, err := strconv.ParseInt(epoch, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%w: %s", errInvalidSourceDateEpoch, epoch)
+	}
+
+	return time.Unix(sec, 0).UTC(), nil
+}
+
+// gitDescribe returns git describe of the Lua directory. It is empty if the directory
+// is not a git repository or git is not available.
+func (a *amalg) gitDescribe(ctx context.Context) string {
+	cmd := exec.CommandContext(ctx, "git", "describe", "--tags", "--always", "--dirty")
+	cmd.Dir = a.luaDir
+
+	out, err := a.runCmd(cmd)
+	if err != nil {
+		return ""
+	}
+
+	return strings.TrimSpace(out.String())
+}
+
+// header returns Lua comments with the build info.
+func (b *buildInfo) header() []byte {
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "-- Amalgamated by rockamalg %s at %s for Lua %s\n", b.rockamalg, b.time, b.luaVersion)
+	if b.version != "" {
+		fmt.Fprintf(&out, "-- Version: %s\n", b.version)
+	}
+	if b.git != "" {
+		fmt.Fprintf(&out, "-- Git: %s\n", b.git)
+	}
+	if len(b.modules) != 0 {
+		fmt.Fprintf(&out, "-- Modules: %s\n", strings.Join(b.modules, ", "))
+	}
+	if len(b.rocks) != 0 {
+		rocks := make([]string, 0, len(b.rocks))
+		for _, r := range b.rocks {
+			rocks = append(rocks, r.name+" "+r.version)
+		}
+		fmt.Fprintf(&out, "-- Rocks: %s\n", strings.Join(rocks, ", "))
+	}
+	return out.Bytes()
+}
+
+// module returns the source of BuildInfoModule. Empty fields are nil.
+func (b *buildInfo) module() []byte {
+	var out bytes.Buffer
+	out.WriteString("return {\n")
+	fmt.Fprintf(&out, "  rockamalg = %s,\n", quoteLua([]byte(b.rockamalg)))
+	fmt.Fprintf(&out, "  time = %s,\n", quoteLua([]byte(b.time)))
+	if b.version != "" {
+		fmt.Fprintf(&out, "  version = %s,\n", quoteLua([]byte(b.version)))
+	}
+	if b.git != "" {
+		fmt.Fprintf(&out, "  git = %s,\n", quoteLua([]byte(b.git)))
+	}
+	fmt.Fprintf(&out, "  lua_version = %s,\n", quoteLua([]byte(b.luaVersion)))
+
+	out.WriteString("  modules = {")
+	for _, m := range b.modules {
+		fmt.Fprintf(&out, " %s,", quoteLua([]byte(m)))
+	}
+	out.WriteString(" },\n")
+
+	out.WriteString("  rocks = {")
+	for _, r := range b.rocks {
+		fmt.Fprintf(&out, " [%s] = %s,", quoteLua([]byte(r.name)), quoteLua([]byte(r.version)))
+	}
+	out.WriteString(" },\n")
+
+	out.WriteString("}\n")
+	return out.Bytes()
+}
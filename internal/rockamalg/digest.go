@@ -0,0 +1,53 @@
+package rockamalg
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+)
+
+// hashOutputs calculates content hashes of the written files. Outputs are reproducible,
+// so equal hashes mean equal inputs and the hashes could be used as cache keys.
+func (a *amalg) hashOutputs() error {
+	var err error
+	if a.outputSHA256, err = fileSHA256(a.p.Output); err != nil {
+		return fmt.Errorf("output: %w", err)
+	}
+
+	if a.p.BytecodeOutput != "" && a.p.BytecodeOutput != a.p.Output {
+		if a.bytecodeSHA256, err = fileSHA256(a.p.BytecodeOutput); err != nil {
+			return fmt.Errorf("bytecode output: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func (a *amalg) reportHashes() {
+	if a.p.Writer == nil {
+		return
+	}
+
+	fmt.Fprintln(a.p.Writer, "Output SHA-256:", a.outputSHA256)
+	if a.bytecodeSHA256 != "" {
+		fmt.Fprintln(a.p.Writer, "Bytecode SHA-256:", a.bytecodeSHA256)
+	}
+}
+
+// fileSHA256 returns the hex encoded SHA-256 of the file content.
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("open: %w", err)
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", fmt.Errorf("read: %w", err)
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
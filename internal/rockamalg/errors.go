@@ -6,4 +6,33 @@ var (
 	errRockspecDepsSimultaneously = errors.New("rockspec and deps are not allowed simultaneously")
 	errLuaMissed                  = errors.New("lua is missed")
 	errRockspecIsNotRegularFile   = errors.New("rockspec is not a regular file")
+	errUnresolvedModules          = errors.New("unresolved modules")
+	errUnsupportedLuaVersion      = errors.New("unsupported lua version")
+	errModuleFileNotFound         = errors.New("module file not found")
+	errUnsupportedBackend         = errors.New("unsupported amalgamation backend")
+	errMinifyBackend              = errors.New("minification is supported by native backend only")
+	errSourceMapBackend           = errors.New("source map is supported by native backend only")
+	errUnsupportedSourceMap       = errors.New("unsupported source map version")
+	errInvalidSearchPath          = errors.New("invalid search path")
+	errInvalidSearchTemplate      = errors.New("search template should be a relative path with one '?'")
+	errLockFileDrift              = errors.New("installed rocks differ from lockfile")
+	errLockFileMissed             = errors.New("lockfile is missed")
+	errDependenciesMissed         = errors.New("deps or rockspec is missed")
+	errOutdatedSourceMissed       = errors.New("deps, rockspec or lockfile is missed")
+	errRockNotLocked              = errors.New("rock is not locked")
+	errRockNotFound               = errors.New("rock is not found on rocks server")
+	errInvalidRockVersion         = errors.New("invalid rock version")
+	errInvalidRockDependency      = errors.New("invalid rock dependency")
+	errBuildInfoBackend           = errors.New("build info is supported by native backend only")
+	errBuildInfoModuleExists      = errors.New("build info module conflicts with existing module")
+	errInvalidSourceDateEpoch     = errors.New("invalid SOURCE_DATE_EPOCH")
+	errVendorUnsatisfied          = errors.New("vendor does not satisfy dependencies")
+	errVendorManifestMissed       = errors.New("vendor manifest is missed")
+	errInvalidVendorManifest      = errors.New("invalid vendor manifest")
+	errVendorManifestMismatch     = errors.New("vendor does not match its manifest")
+	errInvalidRockManifest        = errors.New("invalid rock_manifest")
+	errVendorDirNotEmpty          = errors.New("vendor directory is not empty and has no manifest")
+	errVendorOutputMissed         = errors.New("vendor output is missed")
+	errUnsupportedVendorFormat    = errors.New("unsupported vendor format")
+	errPruneVendorMissed          = errors.New("vendor zip archive is required to prune it")
 )
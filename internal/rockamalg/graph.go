@@ -0,0 +1,171 @@
+package rockamalg
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/enapter/rockamalg/internal/rockamalg/analyzer"
+)
+
+type GraphParams struct {
+	Dependencies      string
+	Rockspec          string
+	Lua               string
+	Vendor            string
+	AllowLegacyVendor bool
+	AllowDevDeps      bool
+	LuaVersion        string
+	SearchPath        string
+	Writer            io.Writer
+}
+
+// Graph is a graph of requires between modules.
+type Graph struct {
+	Nodes []GraphNode `json:"nodes"`
+	Edges []GraphEdge `json:"edges"`
+}
+
+type NodeKind string
+
+const (
+	NodeLocal      NodeKind = "local"
+	NodeRock       NodeKind = "rock"
+	NodeUnresolved NodeKind = "unresolved"
+)
+
+// GraphNode is a module. Rock and version are set for modules of rocks only.
+type GraphNode struct {
+	Name    string   `json:"name"`
+	Kind    NodeKind `json:"kind"`
+	File    string   `json:"file,omitempty"`
+	Rock    string   `json:"rock,omitempty"`
+	Version string   `json:"version,omitempty"`
+}
+
+// GraphEdge is a require of the module To by the module From.
+type GraphEdge struct {
+	From     string `json:"from"`
+	To       string `json:"to"`
+	Optional bool   `json:"optional"`
+}
+
+// Graph installs dependencies the same way as Amalg does and builds the graph of requires.
+func (r *Rockamalg) Graph(ctx context.Context, p GraphParams) (Graph, error) {
+	a, err := r.newAmalg(AmalgParams{
+		Dependencies:      p.Dependencies,
+		Rockspec:          p.Rockspec,
+		Lua:               p.Lua,
+		Vendor:            p.Vendor,
+		AllowLegacyVendor: p.AllowLegacyVendor,
+		AllowDevDeps:      p.AllowDevDeps,
+		LuaVersion:        p.LuaVersion,
+		SearchPath:        p.SearchPath,
+		Writer:            p.Writer,
+	})
+	if err != nil {
+		return Graph{}, err
+	}
+	defer a.cleanup()
+
+	if err := a.prepareTree(ctx); err != nil {
+		return Graph{}, err
+	}
+
+	var g Graph
+	buildGraph := func(ctx context.Context) error {
+		g, err = a.buildGraph(ctx)
+		return err
+	}
+
+	if err := a.wrapWithMsg(buildGraph, "Building graph")(ctx); err != nil {
+		return Graph{}, fmt.Errorf("build graph: %w", err)
+	}
+
+	return g, nil
+}
+
+func (a *amalg) buildGraph(ctx context.Context) (Graph, error) {
+	res, err := a.analyzer.AnalyzeRequires(a.luaMain, a.luaDir, a.tree, a.p.LuaVersion, a.searchPath)
+	if err != nil {
+		return Graph{}, fmt.Errorf("analyze requires: %w", err)
+	}
+
+	rockModules, err := a.listRockModules(ctx)
+	if err != nil {
+		return Graph{}, err
+	}
+
+	rocks := make(map[string]rockModule, len(rockModules))
+	for _, m := range rockModules {
+		rocks[m.module] = m
+	}
+
+	g := Graph{
+		Nodes: make([]GraphNode, 0, len(res.Modules)),
+		Edges: make([]GraphEdge, 0, len(res.Dependencies)),
+	}
+
+	for _, m := range res.Modules {
+		n := GraphNode{Name: m.Name, File: m.File}
+		switch m.Kind {
+		case analyzer.ModuleLocal:
+			n.Kind = NodeLocal
+		case analyzer.ModuleRock:
+			n.Kind = NodeRock
+			n.Rock, n.Version = rocks[m.Name].rock, rocks[m.Name].version
+		case analyzer.ModuleUnresolved:
+			n.Kind = NodeUnresolved
+		}
+		g.Nodes = append(g.Nodes, n)
+	}
+
+	for _, d := range res.Dependencies {
+		g.Edges = append(g.Edges, GraphEdge{From: d.From, To: d.To, Optional: d.Optional})
+	}
+
+	return g, nil
+}
+
+// WriteJSON writes the graph in JSON format.
+func (g Graph) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(g)
+}
+
+// WriteDOT writes the graph in Graphviz DOT format. Local modules are boxes, rocks modules are
+// ellipses labeled with the rock, unresolved modules are red. Optional requires are dashed.
+func (g Graph) WriteDOT(w io.Writer) error {
+	var sb strings.Builder
+
+	sb.WriteString("digraph requires {\n")
+	for _, n := range g.Nodes {
+		switch n.Kind {
+		case NodeLocal:
+			fmt.Fprintf(&sb, "\t%q [shape=box];\n", n.Name)
+		case NodeRock:
+			label := n.Name
+			if n.Rock != "" {
+				label += "\n" + n.Rock + " " + n.Version
+			}
+			fmt.Fprintf(&sb, "\t%q [shape=ellipse, label=%q];\n", n.Name, label)
+		case NodeUnresolved:
+			fmt.Fprintf(&sb, "\t%q [shape=box, style=dashed, color=red];\n", n.Name)
+		}
+	}
+
+	for _, e := range g.Edges {
+		if e.Optional {
+			fmt.Fprintf(&sb, "\t%q -> %q [style=dashed];\n", e.From, e.To)
+		} else {
+			fmt.Fprintf(&sb, "\t%q -> %q;\n", e.From, e.To)
+		}
+	}
+	sb.WriteString("}\n")
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
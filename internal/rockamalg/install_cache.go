@@ -0,0 +1,94 @@
+package rockamalg
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// installCachedRocks restores the rocks tree from the cache. On a miss rocks are installed
+// and the tree is stored to the cache for the following amalgamations.
+func (a *amalg) installCachedRocks(ctx context.Context) error {
+	key, err := a.installCacheKey()
+	if err != nil {
+		return fmt.Errorf("cache key: %w", err)
+	}
+
+	restored, err := a.cache.Restore(key, a.tree)
+	if err != nil {
+		return fmt.Errorf("restore cached dependencies: %w", err)
+	}
+
+	if restored {
+		restore := func(context.Context) error { return nil }
+		if err := a.wrapWithMsg(restore, "Restoring cached dependencies")(ctx); err != nil {
+			return err
+		}
+
+		if a.p.Locked {
+			if err := a.readLockedRocks(); err != nil {
+				return fmt.Errorf("check lockfile: %w", err)
+			}
+		}
+
+		return nil
+	}
+
+	if err := a.installRocksTree(ctx); err != nil {
+		return err
+	}
+
+	store := func(context.Context) error { return a.cache.Store(key, a.tree) }
+	if err := a.wrapWithMsg(store, "Caching dependencies")(ctx); err != nil {
+		return fmt.Errorf("cache dependencies: %w", err)
+	}
+
+	return nil
+}
+
+// installCacheKey identifies the installed tree by everything luarocks install depends on:
+// the normalised rockspec, the Lua version, the rocks server, the dev dependencies flag
+// and the lockfile in locked mode.
+func (a *amalg) installCacheKey() (string, error) {
+	rockspec, err := os.ReadFile(a.p.Rockspec)
+	if err != nil {
+		return "", fmt.Errorf("read rockspec: %w", err)
+	}
+
+	h := sha256.New()
+	fmt.Fprintf(h, "lua=%s server=%s dev=%t\n", a.p.LuaVersion, a.rocksServer, a.p.AllowDevDeps)
+	h.Write(normalizeRockspec(rockspec))
+
+	if a.p.Locked {
+		lf, err := readLockFile(a.p.LockFile)
+		if err != nil {
+			return "", fmt.Errorf("lockfile: %w", err)
+		}
+		for _, r := range lf.Rocks {
+			fmt.Fprintf(h, "locked %s %s %s\n", r.Name, r.Version, r.RockspecSHA256)
+		}
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// normalizeRockspec drops indentation, blank lines and comment lines,
+// so formatting changes of the rockspec do not invalidate the cache.
+func normalizeRockspec(data []byte) []byte {
+	var out bytes.Buffer
+	scan := bufio.NewScanner(bytes.NewReader(data))
+	for scan.Scan() {
+		line := strings.TrimSpace(scan.Text())
+		if line == "" || strings.HasPrefix(line, "--") {
+			continue
+		}
+		out.WriteString(line)
+		out.WriteByte('\n')
+	}
+	return out.Bytes()
+}
@@ -0,0 +1,62 @@
+package rockamalg
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/enapter/rockamalg/internal/rockscache"
+)
+
+func TestInstallCachedRocks(t *testing.T) {
+	t.Parallel()
+
+	cache, err := rockscache.New(rockscache.Params{Dir: t.TempDir()})
+	require.NoError(t, err)
+
+	rockspec := filepath.Join(t.TempDir(), "app-dev-1.rockspec")
+	require.NoError(t, os.WriteFile(rockspec, []byte("dependencies = {\n  'inspect'\n}\n"), 0o600))
+
+	installs := 0
+	newAmalg := func() *amalg {
+		a := &amalg{
+			p:     AmalgParams{Rockspec: rockspec, LuaVersion: "5.3"},
+			tree:  t.TempDir(),
+			cache: cache,
+		}
+		a.runCmd = func(cmd *exec.Cmd) (*bytes.Buffer, error) {
+			require.True(t, slices.Contains(cmd.Args, "install"))
+			installs++
+
+			path := filepath.Join(a.tree, "share", "lua", "5.3", "inspect.lua")
+			require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+			require.NoError(t, os.WriteFile(path, []byte("return {}"), 0o600))
+			return &bytes.Buffer{}, nil
+		}
+		return a
+	}
+
+	require.NoError(t, newAmalg().installCachedRocks(context.Background()))
+	require.Equal(t, 1, installs)
+
+	a := newAmalg()
+	require.NoError(t, a.installCachedRocks(context.Background()))
+	require.Equal(t, 1, installs)
+	require.FileExists(t, filepath.Join(a.tree, "share", "lua", "5.3", "inspect.lua"))
+
+	// formatting of the rockspec does not matter
+	require.NoError(t, os.WriteFile(rockspec, []byte("-- app\ndependencies = {\n\t'inspect'\n}\n\n"), 0o600))
+	require.NoError(t, newAmalg().installCachedRocks(context.Background()))
+	require.Equal(t, 1, installs)
+
+	a = newAmalg()
+	a.p.AllowDevDeps = true
+	require.NoError(t, a.installCachedRocks(context.Background()))
+	require.Equal(t, 2, installs)
+}
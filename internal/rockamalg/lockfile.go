@@ -0,0 +1,193 @@
+package rockamalg
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// LockFile is a conventional name of the lockfile.
+const LockFile = "rockamalg.lock"
+
+// lockFile records exact versions of rocks installed for the dependencies.
+type lockFile struct {
+	LuaVersion string       `json:"lua_version"`
+	Rocks      []lockedRock `json:"rocks"`
+}
+
+type lockedRock struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	// RockspecSHA256 detects rocks republished with the same version.
+	RockspecSHA256 string `json:"rockspec_sha256"`
+}
+
+func (r lockedRock) String() string {
+	return r.Name + " " + r.Version
+}
+
+func readLockFile(path string) (lockFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return lockFile{}, fmt.Errorf("read: %w", err)
+	}
+
+	var lf lockFile
+	if err := json.Unmarshal(data, &lf); err != nil {
+		return lockFile{}, fmt.Errorf("parse: %w", err)
+	}
+
+	return lf, nil
+}
+
+// writeLockFile writes the lockfile unless it is the same already, so it is not touched on every run.
+func writeLockFile(path string, lf lockFile) error {
+	data, err := json.MarshalIndent(lf, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal: %w", err)
+	}
+	data = append(data, '\n')
+
+	if old, err := os.ReadFile(path); err == nil && bytes.Equal(old, data) {
+		return nil
+	}
+
+	if err := os.WriteFile(path, data, outputFilePerm); err != nil {
+		return fmt.Errorf("write: %w", err)
+	}
+
+	return nil
+}
+
+// lockRocks records rocks installed into the tree sorted by names. Rocks pruned from the vendor
+// are recorded as installed, so offline builds of pruned vendors keep them locked.
+func (a *amalg) lockRocks(ctx context.Context) (lockFile, error) {
+	rocks, err := a.listRocks(ctx)
+	if err != nil {
+		return lockFile{}, err
+	}
+
+	lf := lockFile{LuaVersion: a.p.LuaVersion, Rocks: make([]lockedRock, 0, len(rocks))}
+	for _, r := range rocks {
+		hash, err := fileSHA256(a.rockspecPath(r))
+		if err != nil {
+			return lockFile{}, fmt.Errorf("rock=%s, rockspec hash: %w", r.name, err)
+		}
+		lf.Rocks = append(lf.Rocks, lockedRock{Name: r.name, Version: r.version, RockspecSHA256: hash})
+	}
+
+	lf.Rocks = append(lf.Rocks, vendorPrunedRocks(rocks, a.vendorPruned)...)
+
+	sort.Slice(lf.Rocks, func(i, j int) bool { return lf.Rocks[i].Name < lf.Rocks[j].Name })
+
+	return lf, nil
+}
+
+// rockspecPath returns the rockspec luarocks keeps in the tree for the installed rock.
+func (a *amalg) rockspecPath(r installedRock) string {
+	return filepath.Join(a.tree, "lib", "luarocks", "rocks-"+a.p.LuaVersion,
+		r.name, r.version, r.name+"-"+r.version+".rockspec")
+}
+
+func (a *amalg) writeLockFile(ctx context.Context) error {
+	lf, err := a.lockRocks(ctx)
+	if err != nil {
+		return err
+	}
+
+	return writeLockFile(a.p.LockFile, lf)
+}
+
+// installLockedDependencies installs rocks of the lockfile without their dependencies,
+// because all of them are locked too. Dependencies of the rockspec are installed after that,
+// so rocks missed in the lockfile are installed and detected by checkLockFile.
+func (a *amalg) installLockedDependencies(ctx context.Context) error {
+	if err := a.readLockedRocks(); err != nil {
+		return err
+	}
+
+	return a.installRocks(ctx, a.lockedRocks)
+}
+
+// readLockedRocks reads rocks of the lockfile to be checked by checkLockFile.
+func (a *amalg) readLockedRocks() error {
+	lf, err := readLockFile(a.p.LockFile)
+	if err != nil {
+		return fmt.Errorf("lockfile: %w", err)
+	}
+
+	if lf.LuaVersion != a.p.LuaVersion {
+		return fmt.Errorf("%w: locked for lua %s", errLockFileDrift, lf.LuaVersion)
+	}
+
+	a.lockedRocks = lf.Rocks
+	return nil
+}
+
+// installRocks installs exact versions of rocks without their dependencies.
+func (a *amalg) installRocks(ctx context.Context, rocks []lockedRock) error {
+	for _, r := range rocks {
+		args := []string{"install", "--deps-mode=none", r.Name, r.Version}
+		if a.rocksServer != "" {
+			args = append(args, "--only-server="+a.rocksServer)
+		}
+
+		cmd := a.buildLuaRocksCommand(ctx, args...)
+		if _, err := a.runCmd(cmd); err != nil {
+			return fmt.Errorf("run luarocks install %s: %w", r, err)
+		}
+	}
+
+	return nil
+}
+
+// checkLockFile fails if installed rocks differ from the locked ones.
+func (a *amalg) checkLockFile(ctx context.Context) error {
+	lf, err := a.lockRocks(ctx)
+	if err != nil {
+		return err
+	}
+
+	installed := make(map[string]lockedRock, len(lf.Rocks))
+	for _, r := range lf.Rocks {
+		installed[r.Name] = r
+	}
+
+	var drift []string
+	for _, locked := range a.lockedRocks {
+		r, ok := installed[locked.Name]
+		delete(installed, locked.Name)
+
+		switch {
+		case !ok:
+			drift = append(drift, locked.String()+" is not installed")
+		case r.Version != locked.Version:
+			drift = append(drift, fmt.Sprintf("%s is locked, %s is installed", locked, r.Version))
+		case r.RockspecSHA256 != locked.RockspecSHA256:
+			drift = append(drift, locked.String()+" rockspec is changed")
+		}
+	}
+
+	for _, r := range lf.Rocks {
+		if _, ok := installed[r.Name]; ok {
+			drift = append(drift, r.String()+" is not locked")
+		}
+	}
+
+	if len(drift) != 0 {
+		return fmt.Errorf("%w: %s", errLockFileDrift, strings.Join(drift, ", "))
+	}
+
+	return nil
+}
+
+// IsLockFileDrift reports whether the error is caused by rocks which differ from the lockfile.
+func IsLockFileDrift(err error) bool {
+	return errors.Is(err, errLockFileDrift)
+}
@@ -0,0 +1,100 @@
+package rockamalg
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLockFile(t *testing.T) {
+	t.Parallel()
+
+	a := newLockFileTestAmalg(t, map[string]string{
+		"inspect": "3.1.3-0",
+		"amalg":   "0.8-1",
+		"lua-lru": "1.0-1",
+	})
+
+	require.NoError(t, a.writeLockFile(context.Background()))
+
+	lf, err := readLockFile(a.p.LockFile)
+	require.NoError(t, err)
+	require.Equal(t, "5.3", lf.LuaVersion)
+	require.Len(t, lf.Rocks, 2)
+	require.Equal(t, "inspect 3.1.3-0", lf.Rocks[0].String())
+	require.Equal(t, "lua-lru 1.0-1", lf.Rocks[1].String())
+
+	a.lockedRocks = lf.Rocks
+	require.NoError(t, a.checkLockFile(context.Background()))
+}
+
+func TestLockTreeWithoutLockFile(t *testing.T) {
+	t.Parallel()
+
+	a := newLockFileTestAmalg(t, map[string]string{"inspect": "3.1.3-0"})
+	a.p.LockFile = ""
+
+	require.NoError(t, a.lockTree(context.Background()))
+
+	// the lockfile is not written into the Lua directory by default
+	entries, err := os.ReadDir(a.luaDir)
+	require.NoError(t, err)
+	require.Empty(t, entries)
+}
+
+func TestLockFileDrift(t *testing.T) {
+	t.Parallel()
+
+	locked := newLockFileTestAmalg(t, map[string]string{
+		"inspect":  "3.1.3-0",
+		"lua-lru":  "1.0-1",
+		"argparse": "0.7.1-1",
+	})
+	lf, err := locked.lockRocks(context.Background())
+	require.NoError(t, err)
+
+	a := newLockFileTestAmalg(t, map[string]string{
+		"inspect": "3.1.4-0",
+		"lua-lru": "1.0-1",
+		"json":    "1.0-1",
+	})
+	a.lockedRocks = lf.Rocks
+
+	err = a.checkLockFile(context.Background())
+	require.True(t, IsLockFileDrift(err))
+	require.EqualError(t, err, "installed rocks differ from lockfile: argparse 0.7.1-1 is not installed, "+
+		"inspect 3.1.3-0 is locked, 3.1.4-0 is installed, lua-lru 1.0-1 rockspec is changed, "+
+		"json 1.0-1 is not locked")
+}
+
+// newLockFileTestAmalg fakes luarocks list with the rocks and writes their rockspecs into the tree.
+// Rockspecs contain the tree, so the same rocks of different trees have different hashes.
+func newLockFileTestAmalg(t *testing.T, rocks map[string]string) *amalg {
+	t.Helper()
+
+	a := &amalg{
+		p:      AmalgParams{LuaVersion: "5.3", LockFile: filepath.Join(t.TempDir(), LockFile)},
+		tree:   t.TempDir(),
+		luaDir: t.TempDir(),
+	}
+
+	list := &bytes.Buffer{}
+	for name, version := range rocks {
+		list.WriteString(name + "\t" + version + "\tinstalled\t" + a.tree + "\n")
+
+		path := a.rockspecPath(installedRock{name: name, version: version})
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, []byte(a.tree), 0o600))
+	}
+
+	a.runCmd = func(*exec.Cmd) (*bytes.Buffer, error) {
+		return bytes.NewBuffer(list.Bytes()), nil
+	}
+
+	return a
+}
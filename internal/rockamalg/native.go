@@ -0,0 +1,148 @@
+package rockamalg
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// NativeModule is a C module installed by a rock. Such modules could not be
+// loaded from the amalgamated Lua file.
+type NativeModule struct {
+	Module  string
+	Rock    string
+	Version string
+}
+
+// NativeModulesError is returned when rocks install native modules and they are not allowed.
+type NativeModulesError struct {
+	Modules []NativeModule
+}
+
+func (e *NativeModulesError) Error() string {
+	return "native modules could not be amalgamated: " + formatNativeModules(e.Modules)
+}
+
+// formatNativeModules groups modules by rocks: "lua-cjson 2.1.0-1 (cjson), lpeg 1.1.0-1 (lpeg)".
+func formatNativeModules(modules []NativeModule) string {
+	var rocks []string
+	byRock := make(map[string][]string)
+	for _, m := range modules {
+		rock := strings.TrimSpace(m.Rock + " " + m.Version)
+		if rock == "" {
+			rock = "unknown rock"
+		}
+		if _, ok := byRock[rock]; !ok {
+			rocks = append(rocks, rock)
+		}
+		byRock[rock] = append(byRock[rock], m.Module)
+	}
+
+	s := make([]string, 0, len(rocks))
+	for _, r := range rocks {
+		s = append(s, fmt.Sprintf("%s (%s)", r, strings.Join(byRock[r], ", ")))
+	}
+	return strings.Join(s, ", ")
+}
+
+// checkNativeModules fails if the rocks tree contains C modules unless they are allowed.
+// Allowed native modules are reported and excluded from the amalgamation.
+func (a *amalg) checkNativeModules(ctx context.Context) error {
+	modules, err := a.findNativeModules(ctx)
+	if err != nil {
+		return err
+	}
+
+	if len(modules) == 0 {
+		return nil
+	}
+
+	if !a.p.AllowNativeModules {
+		return &NativeModulesError{Modules: modules}
+	}
+
+	a.nativeModules = modules
+	return nil
+}
+
+func (a *amalg) reportNativeModules() {
+	if a.p.Writer == nil || len(a.nativeModules) == 0 {
+		return
+	}
+
+	fmt.Fprintln(a.p.Writer, "native modules are not included:", formatNativeModules(a.nativeModules))
+}
+
+func (a *amalg) isNativeModule(module string) bool {
+	for _, m := range a.nativeModules {
+		if m.Module == module {
+			return true
+		}
+	}
+	return false
+}
+
+// findNativeModules looks for shared libraries installed into the rocks tree.
+// Rocks are looked up only if any native module is found.
+func (a *amalg) findNativeModules(ctx context.Context) ([]NativeModule, error) {
+	libDir := filepath.Join(a.tree, "lib", "lua", a.p.LuaVersion)
+
+	var modules []NativeModule
+	err := filepath.WalkDir(libDir, func(path string, de fs.DirEntry, err error) error {
+		if err != nil {
+			if path == libDir && os.IsNotExist(err) {
+				return filepath.SkipDir
+			}
+			return err
+		}
+
+		if !de.Type().IsRegular() {
+			return nil
+		}
+
+		if ext := filepath.Ext(path); ext != ".so" && ext != ".dll" {
+			return nil
+		}
+
+		mod := strings.TrimPrefix(path, libDir+string(os.PathSeparator))
+		mod = strings.TrimSuffix(mod, filepath.Ext(mod))
+		mod = strings.ReplaceAll(mod, string(os.PathSeparator), ".")
+		modules = append(modules, NativeModule{Module: mod})
+
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("lib dir walk: %w", err)
+	}
+
+	if len(modules) == 0 {
+		return nil, nil
+	}
+
+	rockModules, err := a.listRockModules(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	rocks := make(map[string]rockModule, len(rockModules))
+	for _, m := range rockModules {
+		rocks[m.module] = m
+	}
+
+	for i, m := range modules {
+		modules[i].Rock, modules[i].Version = rocks[m.Module].rock, rocks[m.Module].version
+	}
+
+	sort.Slice(modules, func(i, j int) bool {
+		if modules[i].Rock != modules[j].Rock {
+			return modules[i].Rock < modules[j].Rock
+		}
+		return modules[i].Module < modules[j].Module
+	})
+
+	return modules, nil
+}
@@ -0,0 +1,85 @@
+package rockamalg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// installOfflineRocks checks that the extracted vendor archive satisfies dependencies
+// instead of installing them.
+func (a *amalg) installOfflineRocks(ctx context.Context) error {
+	if a.p.Locked {
+		if err := a.readLockedRocks(); err != nil {
+			return fmt.Errorf("check lockfile: %w", err)
+		}
+	}
+
+	if err := a.wrapWithMsg(a.checkVendoredRocks, "Checking vendored dependencies")(ctx); err != nil {
+		return fmt.Errorf("check vendored dependencies: %w", err)
+	}
+
+	return nil
+}
+
+// checkVendoredRocks fails with the list of dependencies which are missed in the rocks tree
+// or which constraints are not satisfied by the vendored versions.
+func (a *amalg) checkVendoredRocks(ctx context.Context) error {
+	deps, err := a.readDependencies()
+	if err != nil {
+		return err
+	}
+
+	rocks, err := a.listRocks(ctx)
+	if err != nil {
+		return err
+	}
+
+	// pruned rocks are not used by the Lua sources, so they are treated as vendored
+	vendored := make(map[string]string, len(rocks)+len(a.vendorPruned))
+	for _, r := range a.vendorPruned {
+		vendored[r.Name] = r.Version
+	}
+	for _, r := range rocks {
+		vendored[r.name] = r.version
+	}
+
+	names := make([]string, 0, len(deps))
+	for name := range deps {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var unsatisfied []string
+	for _, name := range names {
+		dep := deps[name]
+
+		version, ok := vendored[name]
+		if !ok {
+			unsatisfied = append(unsatisfied, dep.String()+" is not vendored")
+			continue
+		}
+
+		v, err := parseRockVersion(version)
+		if err != nil {
+			return fmt.Errorf("rock=%s: %w", name, err)
+		}
+
+		if !dep.matches(v) {
+			unsatisfied = append(unsatisfied, fmt.Sprintf("%s is vendored as %s", dep, version))
+		}
+	}
+
+	if len(unsatisfied) != 0 {
+		return fmt.Errorf("%w: %s", errVendorUnsatisfied, strings.Join(unsatisfied, ", "))
+	}
+
+	return nil
+}
+
+// IsVendorUnsatisfied reports whether the error is caused by dependencies missed in the vendor archive.
+func IsVendorUnsatisfied(err error) bool {
+	return errors.Is(err, errVendorUnsatisfied)
+}
@@ -0,0 +1,41 @@
+package rockamalg
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckVendoredRocks(t *testing.T) {
+	t.Parallel()
+
+	deps := filepath.Join(t.TempDir(), "deps")
+	require.NoError(t, os.WriteFile(deps, []byte("inspect ~> 3.1\nlua-lru >= 2\nargparse\n"), 0o600))
+
+	a := &amalg{
+		p:    AmalgParams{Dependencies: deps, LuaVersion: "5.3", Offline: true},
+		tree: t.TempDir(),
+		runCmd: func(cmd *exec.Cmd) (*bytes.Buffer, error) {
+			require.Contains(t, cmd.Args, "list")
+			return bytes.NewBufferString("inspect\t3.1.3-0\tinstalled\t/tree\nlua-lru\t1.0-1\tinstalled\t/tree\n"), nil
+		},
+	}
+
+	err := a.checkVendoredRocks(context.Background())
+	require.True(t, IsVendorUnsatisfied(err))
+	require.EqualError(t, err, "vendor does not satisfy dependencies: "+
+		"argparse is not vendored, lua-lru >= 2 is vendored as 1.0-1")
+
+	require.NoError(t, os.WriteFile(deps, []byte("inspect ~> 3.1\nlua-lru\n"), 0o600))
+	require.NoError(t, a.checkVendoredRocks(context.Background()))
+
+	// rocks pruned from the vendor are not used, so they satisfy dependencies
+	require.NoError(t, os.WriteFile(deps, []byte("inspect ~> 3.1\nargparse\n"), 0o600))
+	a.vendorPruned = []lockedRock{{Name: "argparse", Version: "0.7.1-1"}}
+	require.NoError(t, a.checkVendoredRocks(context.Background()))
+}
@@ -0,0 +1,320 @@
+package rockamalg
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/enapter/rockamalg/internal/rockamalg/analyzer"
+)
+
+type OutdatedParams struct {
+	Dependencies string
+	Rockspec     string
+	// LockFile is used to get current versions of rocks, rocks of the lockfile are checked too.
+	LockFile   string
+	LuaVersion string
+	Writer     io.Writer
+}
+
+// OutdatedRock is a rock which has a newer version on the rocks server.
+type OutdatedRock struct {
+	Rock string
+	// Current is the locked version. It is empty if the rock is not locked.
+	Current string
+	// Wanted is the newest version satisfying constraints of the dependencies.
+	// Rocks of the lockfile missed in the dependencies have no constraints.
+	Wanted string
+	// Latest is the newest version on the rocks server.
+	Latest string
+}
+
+type UpdateParams struct {
+	Dependencies string
+	Rockspec     string
+	LockFile     string
+	// Rocks are updated to the newest versions satisfying the dependencies,
+	// other rocks keep their locked versions. All rocks are updated if it is empty.
+	Rocks        []string
+	AllowDevDeps bool
+	LuaVersion   string
+	Writer       io.Writer
+}
+
+// Outdated compares dependencies and locked rocks with versions available on the rocks server.
+func (r *Rockamalg) Outdated(ctx context.Context, p OutdatedParams) ([]OutdatedRock, error) {
+	if p.Dependencies == "" && p.Rockspec == "" && p.LockFile == "" {
+		return nil, errOutdatedSourceMissed
+	}
+
+	a, err := r.newRocksAmalg(AmalgParams{
+		Dependencies: p.Dependencies,
+		Rockspec:     p.Rockspec,
+		LockFile:     p.LockFile,
+		LuaVersion:   p.LuaVersion,
+		Writer:       p.Writer,
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer a.cleanup()
+
+	if err := a.wrapWithMsg(a.setupTree, "Setting up configuration")(ctx); err != nil {
+		return nil, fmt.Errorf("set up configuration: %w", err)
+	}
+
+	var outdated []OutdatedRock
+	findOutdated := func(ctx context.Context) error {
+		outdated, err = a.findOutdatedRocks(ctx)
+		return err
+	}
+
+	if err := a.wrapWithMsg(findOutdated, "Searching rocks")(ctx); err != nil {
+		return nil, fmt.Errorf("search rocks: %w", err)
+	}
+
+	return outdated, nil
+}
+
+// Update installs dependencies and rewrites the lockfile with installed versions.
+func (r *Rockamalg) Update(ctx context.Context, p UpdateParams) error {
+	if p.Dependencies == "" && p.Rockspec == "" {
+		return errDependenciesMissed
+	}
+
+	if p.LockFile == "" {
+		return errLockFileMissed
+	}
+
+	a, err := r.newRocksAmalg(AmalgParams{
+		Dependencies: p.Dependencies,
+		Rockspec:     p.Rockspec,
+		LockFile:     p.LockFile,
+		AllowDevDeps: p.AllowDevDeps,
+		LuaVersion:   p.LuaVersion,
+		Writer:       p.Writer,
+	})
+	if err != nil {
+		return err
+	}
+	defer a.cleanup()
+
+	if err := a.wrapWithMsg(a.setupTree, "Setting up configuration")(ctx); err != nil {
+		return fmt.Errorf("set up configuration: %w", err)
+	}
+
+	if a.p.Dependencies != "" {
+		if err := a.wrapWithMsg(a.generateRockspec, "Generating rockspec")(ctx); err != nil {
+			return fmt.Errorf("generate rockspec: %w", err)
+		}
+	}
+
+	if len(p.Rocks) != 0 {
+		installKept := func(ctx context.Context) error { return a.installKeptRocks(ctx, p.Rocks) }
+		if err := a.wrapWithMsg(installKept, "Installing locked dependencies")(ctx); err != nil {
+			return fmt.Errorf("install locked dependencies: %w", err)
+		}
+	}
+
+	if err := a.wrapWithMsg(a.installDependencies, "Installing dependencies")(ctx); err != nil {
+		return fmt.Errorf("install dependencies: %w", err)
+	}
+
+	if err := a.wrapWithMsg(a.writeLockFile, "Writing lockfile")(ctx); err != nil {
+		return fmt.Errorf("write lockfile: %w", err)
+	}
+
+	return nil
+}
+
+// installKeptRocks installs locked versions of all rocks except the updated ones,
+// so the following install of dependencies installs the newest versions of the updated rocks only.
+func (a *amalg) installKeptRocks(ctx context.Context, update []string) error {
+	lf, err := readLockFile(a.p.LockFile)
+	if err != nil {
+		return fmt.Errorf("lockfile: %w", err)
+	}
+
+	updated := make(map[string]bool, len(update))
+	for _, name := range update {
+		updated[name] = false
+	}
+
+	kept := make([]lockedRock, 0, len(lf.Rocks))
+	for _, r := range lf.Rocks {
+		if _, ok := updated[r.Name]; ok {
+			updated[r.Name] = true
+			continue
+		}
+		kept = append(kept, r)
+	}
+
+	for _, name := range update {
+		if !updated[name] {
+			return fmt.Errorf("%w: %s", errRockNotLocked, name)
+		}
+	}
+
+	return a.installRocks(ctx, kept)
+}
+
+// findOutdatedRocks returns rocks sorted by names which current version is not the wanted or the latest one.
+// Rocks which are not locked are outdated only if the latest version does not satisfy the dependencies.
+func (a *amalg) findOutdatedRocks(ctx context.Context) ([]OutdatedRock, error) {
+	deps, err := a.readDependencies()
+	if err != nil {
+		return nil, err
+	}
+
+	current := make(map[string]string)
+	if a.p.LockFile != "" {
+		lf, err := readLockFile(a.p.LockFile)
+		if err != nil {
+			return nil, fmt.Errorf("lockfile: %w", err)
+		}
+		for _, r := range lf.Rocks {
+			current[r.Name] = r.Version
+		}
+	}
+
+	names := make([]string, 0, len(deps)+len(current))
+	for name := range deps {
+		names = append(names, name)
+	}
+	for name := range current {
+		if _, ok := deps[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var outdated []OutdatedRock
+	for _, name := range names {
+		versions, err := a.searchRockVersions(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(versions) == 0 {
+			return nil, fmt.Errorf("%w: %s", errRockNotFound, name)
+		}
+
+		o := OutdatedRock{Rock: name, Current: current[name], Latest: versions[0].String()}
+		for _, v := range versions {
+			if deps[name].matches(v) {
+				o.Wanted = v.String()
+				break
+			}
+		}
+
+		if o.Current == "" {
+			// rocks which are not locked are installed in the wanted version
+			if o.Wanted == o.Latest {
+				continue
+			}
+		} else {
+			cur, err := parseRockVersion(o.Current)
+			if err != nil {
+				return nil, fmt.Errorf("rock=%s: %w", name, err)
+			}
+			if cur.compare(versions[0]) >= 0 && (o.Wanted == "" || o.Wanted == o.Current) {
+				continue
+			}
+		}
+
+		outdated = append(outdated, o)
+	}
+
+	return outdated, nil
+}
+
+// readDependencies returns dependencies of the deps file or the rockspec by rock names.
+// The Lua interpreter dependency is skipped.
+func (a *amalg) readDependencies() (map[string]rockDependency, error) {
+	var lines []string
+	switch {
+	case a.p.Dependencies != "":
+		data, err := os.ReadFile(a.p.Dependencies)
+		if err != nil {
+			return nil, fmt.Errorf("read deps: %w", err)
+		}
+		lines = strings.Split(string(data), "\n")
+	case a.p.Rockspec != "":
+		data, err := os.ReadFile(a.p.Rockspec)
+		if err != nil {
+			return nil, fmt.Errorf("read rockspec: %w", err)
+		}
+		lines, err = analyzer.ReadStringList(data, "dependencies")
+		if err != nil {
+			return nil, fmt.Errorf("parse rockspec: %w", err)
+		}
+	}
+
+	deps := make(map[string]rockDependency, len(lines))
+	for _, l := range lines {
+		if strings.TrimSpace(l) == "" {
+			continue
+		}
+
+		d, err := parseRockDependency(l)
+		if err != nil {
+			return nil, err
+		}
+
+		if d.name != "lua" {
+			deps[d.name] = d
+		}
+	}
+
+	return deps, nil
+}
+
+// searchRockVersions returns versions of the rock on the rocks server from the newest to the oldest.
+func (a *amalg) searchRockVersions(ctx context.Context, name string) ([]rockVersion, error) {
+	args := []string{"search", "--porcelain", name}
+	if a.rocksServer != "" {
+		args = append(args, "--only-server="+a.rocksServer)
+	}
+
+	buf, err := a.runCmd(a.buildLuaRocksCommand(ctx, args...))
+	if err != nil {
+		return nil, fmt.Errorf("run luarocks search: %w", err)
+	}
+
+	return parseRockSearch(buf, name)
+}
+
+// parseRockSearch parses the porcelain output of luarocks search. The search matches
+// substrings of names and lists every architecture, so other rocks and duplicates are skipped.
+func parseRockSearch(buf *bytes.Buffer, name string) ([]rockVersion, error) {
+	seen := make(map[string]struct{})
+	var versions []rockVersion
+	scan := bufio.NewScanner(buf)
+	for scan.Scan() {
+		// name, version, architecture and server are separated by tabs
+		fields := strings.Fields(scan.Text())
+		if len(fields) < 2 || !strings.EqualFold(fields[0], name) {
+			continue
+		}
+
+		if _, ok := seen[fields[1]]; ok {
+			continue
+		}
+		seen[fields[1]] = struct{}{}
+
+		v, err := parseRockVersion(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("rock=%s: %w", name, err)
+		}
+		versions = append(versions, v)
+	}
+
+	sort.SliceStable(versions, func(i, j int) bool { return versions[i].compare(versions[j]) > 0 })
+
+	return versions, nil
+}
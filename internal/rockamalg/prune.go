@@ -0,0 +1,95 @@
+package rockamalg
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// PrunedRock is a rock dropped from the vendor archive, since none of its modules
+// are included into the result.
+type PrunedRock struct {
+	Rock    string
+	Version string
+}
+
+func (r PrunedRock) String() string {
+	return r.Rock + " " + r.Version
+}
+
+// pruneVendorArchive removes unused rocks from the rocks tree and builds the vendor archive of the rest.
+// It runs after the amalgamation, so the tree is not used anymore.
+func (a *amalg) pruneVendorArchive(ctx context.Context) error {
+	if err := a.pruneRocks(ctx); err != nil {
+		return err
+	}
+
+	return a.buildVendorArchive(ctx)
+}
+
+// pruneRocks removes rocks which modules are not amalgamated. Local modules shadowing
+// modules of rocks do not keep the rocks. Trees restored from the cache are copies,
+// so luarocks remove does not modify cache entries.
+func (a *amalg) pruneRocks(ctx context.Context) error {
+	rockModules, err := a.listRockModules(ctx)
+	if err != nil {
+		return err
+	}
+
+	used := make(map[string]struct{})
+	for _, m := range rockModules {
+		path, ok := a.modulePaths[m.module]
+		if ok && strings.HasPrefix(path, a.tree+string(filepath.Separator)) {
+			used[m.rock] = struct{}{}
+		}
+	}
+
+	rocks, err := a.listRocks(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, r := range rocks {
+		if _, ok := used[r.name]; ok {
+			continue
+		}
+
+		// the rockspec is removed with the rock, so it is hashed to keep the rock locked
+		hash, err := fileSHA256(a.rockspecPath(r))
+		if err != nil {
+			return fmt.Errorf("rock=%s, rockspec hash: %w", r.name, err)
+		}
+
+		// rocks are removed even if kept rocks depend on them, dependencies are not loaded by the result
+		removeCmd := a.buildLuaRocksCommand(ctx, "remove", "--force", r.name, r.version)
+		if _, err := a.runCmd(removeCmd); err != nil {
+			return fmt.Errorf("rock=%s, run luarocks remove: %w", r.name, err)
+		}
+
+		a.prunedRocks = append(a.prunedRocks, lockedRock{Name: r.name, Version: r.version, RockspecSHA256: hash})
+	}
+
+	return nil
+}
+
+func (a *amalg) prunedRocksResult() []PrunedRock {
+	var rocks []PrunedRock
+	for _, r := range a.prunedRocks {
+		rocks = append(rocks, PrunedRock{Rock: r.Name, Version: r.Version})
+	}
+	return rocks
+}
+
+func (a *amalg) reportPrunedRocks() {
+	if a.p.Writer == nil || len(a.prunedRocks) == 0 {
+		return
+	}
+
+	rocks := make([]string, 0, len(a.prunedRocks))
+	for _, r := range a.prunedRocks {
+		rocks = append(rocks, r.String())
+	}
+
+	fmt.Fprintln(a.p.Writer, "Pruned unused rocks:", strings.Join(rocks, ", "))
+}
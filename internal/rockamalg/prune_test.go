@@ -0,0 +1,193 @@
+package rockamalg
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/enapter/rockamalg/internal/rockscache"
+)
+
+func TestPruneRocks(t *testing.T) {
+	t.Parallel()
+
+	tree := t.TempDir()
+	modules := map[string]string{"inspect": "inspect", "lua-lru": "lru", "argparse": "argparse"}
+
+	versions := map[string]string{"inspect": "3.1.3-0", "lua-lru": "1.0-1", "argparse": "0.7.1-1"}
+	for name, version := range versions {
+		rockspec := path.Join("lib/luarocks/rocks-5.3", name, version, name+"-"+version+".rockspec")
+		writeTreeFile(t, tree, rockspec, name)
+	}
+
+	var removed []string
+	a := &amalg{
+		p:    AmalgParams{LuaVersion: "5.3"},
+		tree: tree,
+		modulePaths: map[string]string{
+			"inspect": filepath.Join(tree, "share", "lua", "5.3", "inspect.lua"),
+			// the local module shadows the module of the rock
+			"lru": filepath.Join(t.TempDir(), "lru.lua"),
+		},
+		runCmd: func(cmd *exec.Cmd) (*bytes.Buffer, error) {
+			rock := cmd.Args[len(cmd.Args)-1]
+			switch {
+			case slices.Contains(cmd.Args, "list"):
+				return bytes.NewBufferString("argparse\t0.7.1-1\tinstalled\t/tree\n" +
+					"inspect\t3.1.3-0\tinstalled\t/tree\nlua-lru\t1.0-1\tinstalled\t/tree\n"), nil
+			case slices.Contains(cmd.Args, "show"):
+				return bytes.NewBufferString(modules[rock] + "\n"), nil
+			case slices.Contains(cmd.Args, "remove"):
+				require.Contains(t, cmd.Args, "--force")
+				removed = append(removed, cmd.Args[len(cmd.Args)-2])
+				return &bytes.Buffer{}, nil
+			}
+			require.FailNow(t, "unexpected command", cmd.Args)
+			return nil, nil
+		},
+	}
+
+	require.NoError(t, a.pruneRocks(context.Background()))
+	require.Equal(t, []string{"argparse", "lua-lru"}, removed)
+	require.Equal(t, []lockedRock{
+		{Name: "argparse", Version: "0.7.1-1", RockspecSHA256: sha256Hex([]byte("argparse"))},
+		{Name: "lua-lru", Version: "1.0-1", RockspecSHA256: sha256Hex([]byte("lua-lru"))},
+	}, a.prunedRocks)
+	require.Equal(t, []PrunedRock{
+		{Rock: "argparse", Version: "0.7.1-1"},
+		{Rock: "lua-lru", Version: "1.0-1"},
+	}, a.result().PrunedRocks)
+}
+
+func TestPruneRocksKeepsCache(t *testing.T) {
+	t.Parallel()
+
+	cache, err := rockscache.New(rockscache.Params{Dir: t.TempDir()})
+	require.NoError(t, err)
+
+	rockspec := filepath.Join(t.TempDir(), "app-dev-1.rockspec")
+	require.NoError(t, os.WriteFile(rockspec, []byte("dependencies = {\n  'inspect'\n}\n"), 0o600))
+
+	const (
+		manifest = "lib/luarocks/rocks-5.3/manifest"
+		module   = "share/lua/5.3/inspect.lua"
+	)
+
+	newAmalg := func() *amalg {
+		a := &amalg{
+			p:     AmalgParams{Rockspec: rockspec, LuaVersion: "5.3", PruneVendor: true},
+			tree:  t.TempDir(),
+			cache: cache,
+		}
+		a.runCmd = func(cmd *exec.Cmd) (*bytes.Buffer, error) {
+			switch {
+			case slices.Contains(cmd.Args, "install"):
+				writeTreeFile(t, a.tree, manifest, "manifest = {inspect}")
+				writeTreeFile(t, a.tree, module, "return {}")
+				writeTreeFile(t, a.tree, "lib/luarocks/rocks-5.3/inspect/3.1.3-0/inspect-3.1.3-0.rockspec", "inspect")
+			case slices.Contains(cmd.Args, "list"):
+				return bytes.NewBufferString("inspect\t3.1.3-0\tinstalled\t/tree\n"), nil
+			case slices.Contains(cmd.Args, "show"):
+				return bytes.NewBufferString("inspect\n"), nil
+			case slices.Contains(cmd.Args, "remove"):
+				// luarocks rewrites the manifest of the tree in place
+				f, err := os.OpenFile(filepath.Join(a.tree, manifest), os.O_WRONLY|os.O_TRUNC, 0)
+				require.NoError(t, err)
+				_, err = f.WriteString("manifest = {}")
+				require.NoError(t, err)
+				require.NoError(t, f.Close())
+				require.NoError(t, os.Remove(filepath.Join(a.tree, module)))
+			}
+			return &bytes.Buffer{}, nil
+		}
+		return a
+	}
+
+	require.NoError(t, newAmalg().installCachedRocks(context.Background()))
+
+	// the module is not used, so the rock is pruned from the restored tree
+	a := newAmalg()
+	require.NoError(t, a.installCachedRocks(context.Background()))
+	require.NoError(t, a.pruneRocks(context.Background()))
+	require.Len(t, a.prunedRocks, 1)
+
+	key, err := a.installCacheKey()
+	require.NoError(t, err)
+
+	restored := t.TempDir()
+	ok, err := cache.Restore(key, restored)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	data, err := os.ReadFile(filepath.Join(restored, manifest))
+	require.NoError(t, err)
+	require.Equal(t, "manifest = {inspect}", string(data))
+	require.FileExists(t, filepath.Join(restored, module))
+}
+
+func TestOfflinePrunedVendorLockFile(t *testing.T) {
+	t.Parallel()
+
+	deps := filepath.Join(t.TempDir(), "deps")
+	require.NoError(t, os.WriteFile(deps, []byte("inspect ~> 3.1\nargparse\n"), 0o600))
+
+	// argparse is pruned from the vendor, so it is not in the tree
+	a := newLockFileTestAmalg(t, map[string]string{"inspect": "3.1.3-0"})
+	a.p.Dependencies = deps
+	a.p.Offline = true
+	a.vendorPruned = []lockedRock{{Name: "argparse", Version: "0.7.1-1", RockspecSHA256: "argparse-hash"}}
+
+	// offline build without locked mode keeps pruned rocks in the lockfile
+	require.NoError(t, a.installOfflineRocks(context.Background()))
+	require.NoError(t, a.lockTree(context.Background()))
+
+	lf, err := readLockFile(a.p.LockFile)
+	require.NoError(t, err)
+	require.Len(t, lf.Rocks, 2)
+	require.Equal(t, a.vendorPruned[0], lf.Rocks[0])
+	require.Equal(t, "inspect 3.1.3-0", lf.Rocks[1].String())
+
+	// offline build in locked mode accepts pruned rocks of the lockfile
+	a.p.Locked = true
+	require.NoError(t, a.installOfflineRocks(context.Background()))
+	require.NoError(t, a.lockTree(context.Background()))
+
+	// pruned rocks are checked against the lockfile as installed ones
+	a.vendorPruned[0].Version = "0.7.0-1"
+	err = a.lockTree(context.Background())
+	require.True(t, IsLockFileDrift(err))
+	require.ErrorContains(t, err, "argparse 0.7.1-1 is locked, 0.7.0-1 is installed")
+}
+
+func TestVendorManifestPruned(t *testing.T) {
+	t.Parallel()
+
+	tree := t.TempDir()
+	writeTreeFile(t, tree, "share/lua/5.3/inspect.lua", "return {}")
+	writeTreeFile(t, tree, "lib/luarocks/rocks-5.3/inspect/3.1.3-0/rock_manifest", `rock_manifest = {
+   lua = {
+      ["inspect.lua"] = "e9920ca802c3f0a56c00e837ce166653"
+   }
+}
+`)
+
+	// installed rocks are not pruned anymore
+	m, err := buildVendorManifest(tree, "5.3", []lockedRock{
+		{Name: "lua-lru", Version: "1.0-1"},
+		{Name: "inspect", Version: "3.1.2-0"},
+		{Name: "argparse", Version: "0.7.1-1"},
+		{Name: "lua-lru", Version: "1.0-1"},
+	})
+	require.NoError(t, err)
+	require.Equal(t, []lockedRock{
+		{Name: "argparse", Version: "0.7.1-1"},
+		{Name: "lua-lru", Version: "1.0-1"},
+	}, m.Pruned)
+}
@@ -0,0 +1,220 @@
+package rockamalg
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// rockVersion is a version of a rock parsed the same way as luarocks does:
+// numbers and words separated by dots, dashes or underscores and an optional revision.
+type rockVersion struct {
+	text     string
+	parts    []float64
+	revision int
+	// hasRevision is false for versions of constraints like "3.1"
+	hasRevision bool
+}
+
+// rockVersionWords are weights of words in versions, other words are weighted by the first letter.
+//
+//nolint:gochecknoglobals // read-only lookup table
+var rockVersionWords = map[string]float64{
+	"dev": 120000000, "scm": 110000000, "cvs": 100000000,
+	"rc": -1000, "pre": -10000, "beta": -100000, "alpha": -1000000,
+}
+
+//nolint:gochecknoglobals // compiled once
+var (
+	rockVersionRevisionRe = regexp.MustCompile(`^(.*)-(\d+)$`)
+	rockVersionNumberRe   = regexp.MustCompile(`^(\d+)[.\-_]*`)
+	rockVersionWordRe     = regexp.MustCompile(`^([A-Za-z]+)[.\-_]*`)
+)
+
+func parseRockVersion(s string) (rockVersion, error) {
+	s = strings.TrimSpace(s)
+	v := rockVersion{text: s}
+
+	if m := rockVersionRevisionRe.FindStringSubmatch(s); m != nil {
+		rev, err := strconv.Atoi(m[2])
+		if err != nil {
+			return rockVersion{}, fmt.Errorf("%w: %s", errInvalidRockVersion, v.text)
+		}
+		s, v.revision, v.hasRevision = m[1], rev, true
+	}
+
+	for s != "" {
+		if m := rockVersionNumberRe.FindStringSubmatch(s); m != nil {
+			n, err := strconv.ParseFloat(m[1], 64)
+			if err != nil {
+				return rockVersion{}, fmt.Errorf("%w: %s", errInvalidRockVersion, v.text)
+			}
+			v.parts = append(v.parts, n)
+			s = s[len(m[0]):]
+			continue
+		}
+
+		m := rockVersionWordRe.FindStringSubmatch(s)
+		if m == nil {
+			return rockVersion{}, fmt.Errorf("%w: %s", errInvalidRockVersion, v.text)
+		}
+
+		w, ok := rockVersionWords[strings.ToLower(m[1])]
+		if !ok {
+			w = float64(m[1][0]) / 1000
+		}
+		v.parts = append(v.parts, w)
+		s = s[len(m[0]):]
+	}
+
+	if len(v.parts) == 0 {
+		return rockVersion{}, fmt.Errorf("%w: %q", errInvalidRockVersion, v.text)
+	}
+
+	return v, nil
+}
+
+func (v rockVersion) String() string {
+	return v.text
+}
+
+// compare returns -1, 0 or 1. Missing parts are zeros and revisions are compared
+// only if both versions have them, so "3.1" is equal to "3.1.0-1".
+func (v rockVersion) compare(other rockVersion) int {
+	for i := range max(len(v.parts), len(other.parts)) {
+		var a, b float64
+		if i < len(v.parts) {
+			a = v.parts[i]
+		}
+		if i < len(other.parts) {
+			b = other.parts[i]
+		}
+
+		if a != b {
+			if a < b {
+				return -1
+			}
+			return 1
+		}
+	}
+
+	if !v.hasRevision || !other.hasRevision || v.revision == other.revision {
+		return 0
+	}
+	if v.revision < other.revision {
+		return -1
+	}
+	return 1
+}
+
+// hasPrefix reports whether the version starts with parts of the prefix like luarocks ~> does,
+// e.g. 3.1.4-1 starts with 3.1.
+func (v rockVersion) hasPrefix(prefix rockVersion) bool {
+	for i, p := range prefix.parts {
+		var part float64
+		if i < len(v.parts) {
+			part = v.parts[i]
+		}
+		if part != p {
+			return false
+		}
+	}
+
+	return !prefix.hasRevision || v.revision == prefix.revision
+}
+
+// rockConstraint is a version constraint of a dependency like ">= 1.0" or "~> 3.1".
+type rockConstraint struct {
+	op      string
+	version rockVersion
+}
+
+// rockDependency is a rock with version constraints, e.g. "inspect >= 3.1, < 4".
+type rockDependency struct {
+	name        string
+	constraints []rockConstraint
+}
+
+//nolint:gochecknoglobals // compiled once
+var rockConstraintRe = regexp.MustCompile(`^\s*(==|~=|!=|>=|<=|~>|=|>|<)?\s*([^\s,]+)\s*$`)
+
+// parseRockDependency parses a dependency in the rockspec format.
+func parseRockDependency(s string) (rockDependency, error) {
+	s = strings.TrimSpace(s)
+	name, rest, _ := strings.Cut(s, " ")
+	if name == "" {
+		return rockDependency{}, fmt.Errorf("%w: %q", errInvalidRockDependency, s)
+	}
+
+	dep := rockDependency{name: strings.ToLower(name)}
+	if strings.TrimSpace(rest) == "" {
+		return dep, nil
+	}
+
+	for _, c := range strings.Split(rest, ",") {
+		m := rockConstraintRe.FindStringSubmatch(c)
+		if m == nil {
+			return rockDependency{}, fmt.Errorf("%w: %q", errInvalidRockDependency, s)
+		}
+
+		v, err := parseRockVersion(m[2])
+		if err != nil {
+			return rockDependency{}, err
+		}
+
+		op := m[1]
+		switch op {
+		case "", "=":
+			op = "=="
+		case "!=":
+			op = "~="
+		}
+
+		dep.constraints = append(dep.constraints, rockConstraint{op: op, version: v})
+	}
+
+	return dep, nil
+}
+
+// String formats the dependency as in rockspecs, e.g. "inspect >= 3.1, < 4".
+func (d rockDependency) String() string {
+	constraints := make([]string, 0, len(d.constraints))
+	for _, c := range d.constraints {
+		constraints = append(constraints, c.op+" "+c.version.String())
+	}
+
+	if len(constraints) == 0 {
+		return d.name
+	}
+	return d.name + " " + strings.Join(constraints, ", ")
+}
+
+// matches reports whether the version satisfies all constraints.
+func (d rockDependency) matches(v rockVersion) bool {
+	for _, c := range d.constraints {
+		var ok bool
+		switch c.op {
+		case "==":
+			ok = v.compare(c.version) == 0
+		case "~=":
+			ok = v.compare(c.version) != 0
+		case ">":
+			ok = v.compare(c.version) > 0
+		case "<":
+			ok = v.compare(c.version) < 0
+		case ">=":
+			ok = v.compare(c.version) >= 0
+		case "<=":
+			ok = v.compare(c.version) <= 0
+		case "~>":
+			ok = v.hasPrefix(c.version)
+		}
+
+		if !ok {
+			return false
+		}
+	}
+
+	return true
+}
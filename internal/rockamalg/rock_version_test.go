@@ -0,0 +1,168 @@
+package rockamalg
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRockVersionCompare(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		a, b     string
+		expected int
+	}{
+		{a: "3.1.3-0", b: "3.1.3-0", expected: 0},
+		{a: "3.1", b: "3.1.0-1", expected: 0},
+		{a: "3.1.3-0", b: "3.1.3-1", expected: -1},
+		{a: "3.10-1", b: "3.9-1", expected: 1},
+		{a: "1.0rc1-1", b: "1.0-1", expected: -1},
+		{a: "scm-1", b: "100.0-1", expected: 1},
+		{a: "dev-1", b: "scm-1", expected: 1},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.a+" "+tc.b, func(t *testing.T) {
+			t.Parallel()
+
+			a, err := parseRockVersion(tc.a)
+			require.NoError(t, err)
+			b, err := parseRockVersion(tc.b)
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, a.compare(b))
+			require.Equal(t, -tc.expected, b.compare(a))
+		})
+	}
+}
+
+func TestRockDependencyMatches(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		dep      string
+		version  string
+		expected bool
+	}{
+		{dep: "inspect", version: "3.1.3-0", expected: true},
+		{dep: "inspect ~> 3.1", version: "3.1.3-0", expected: true},
+		{dep: "inspect ~> 3.1", version: "3.2-0", expected: false},
+		{dep: "inspect ~> 3.1.2", version: "3.1.3-0", expected: false},
+		{dep: "inspect >= 3.1, < 4", version: "3.9-1", expected: true},
+		{dep: "inspect >= 3.1, < 4", version: "4.0-1", expected: false},
+		{dep: "inspect 3.1.3", version: "3.1.3-0", expected: true},
+		{dep: "inspect == 3.1.3-1", version: "3.1.3-0", expected: false},
+		{dep: "inspect ~= 3.1.3", version: "3.1.3-0", expected: false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.dep+" "+tc.version, func(t *testing.T) {
+			t.Parallel()
+
+			d, err := parseRockDependency(tc.dep)
+			require.NoError(t, err)
+			v, err := parseRockVersion(tc.version)
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, d.matches(v))
+		})
+	}
+}
+
+func TestFindOutdatedRocks(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	deps := filepath.Join(dir, "deps")
+	require.NoError(t, os.WriteFile(deps, []byte("inspect ~> 3.1\nlua-lru\n"), 0o600))
+
+	lockPath := filepath.Join(dir, LockFile)
+	require.NoError(t, writeLockFile(lockPath, lockFile{LuaVersion: "5.3", Rocks: []lockedRock{
+		{Name: "argparse", Version: "0.7.1-1"},
+		{Name: "inspect", Version: "3.1.2-0"},
+		{Name: "lua-lru", Version: "1.0-1"},
+	}}))
+
+	search := map[string]string{
+		"argparse": "argparse\t0.7.1-1\trockspec\thttps://luarocks.org\n",
+		"inspect": "inspect\t3.1.3-0\trockspec\thttps://luarocks.org\n" +
+			"inspect\t3.1.3-0\tsrc\thttps://luarocks.org\n" +
+			"inspect\t3.2.0-1\trockspec\thttps://luarocks.org\n" +
+			"inspect-more\t9.0-1\trockspec\thttps://luarocks.org\n",
+		"lua-lru": "lua-lru\t1.1-1\trockspec\thttps://luarocks.org\n",
+	}
+
+	a := &amalg{
+		p:    AmalgParams{Dependencies: deps, LockFile: lockPath, LuaVersion: "5.3"},
+		tree: dir,
+		runCmd: func(cmd *exec.Cmd) (*bytes.Buffer, error) {
+			require.Contains(t, cmd.Args, "search")
+			return bytes.NewBufferString(search[cmd.Args[len(cmd.Args)-1]]), nil
+		},
+	}
+
+	outdated, err := a.findOutdatedRocks(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, []OutdatedRock{
+		{Rock: "inspect", Current: "3.1.2-0", Wanted: "3.1.3-0", Latest: "3.2.0-1"},
+		{Rock: "lua-lru", Current: "1.0-1", Wanted: "1.1-1", Latest: "1.1-1"},
+	}, outdated)
+}
+
+func TestFindOutdatedRocksWithoutLockFile(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	deps := filepath.Join(dir, "deps")
+	require.NoError(t, os.WriteFile(deps, []byte("inspect ~> 3.1\nlua-lru\n"), 0o600))
+
+	search := map[string]string{
+		"inspect": "inspect\t3.1.3-0\trockspec\thttps://luarocks.org\n" +
+			"inspect\t3.2.0-1\trockspec\thttps://luarocks.org\n",
+		"lua-lru": "lua-lru\t1.1-1\trockspec\thttps://luarocks.org\n",
+	}
+
+	a := &amalg{
+		p:    AmalgParams{Dependencies: deps, LuaVersion: "5.3"},
+		tree: dir,
+		runCmd: func(cmd *exec.Cmd) (*bytes.Buffer, error) {
+			return bytes.NewBufferString(search[cmd.Args[len(cmd.Args)-1]]), nil
+		},
+	}
+
+	// lua-lru is installed in the latest version, so it is not outdated
+	outdated, err := a.findOutdatedRocks(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, []OutdatedRock{
+		{Rock: "inspect", Wanted: "3.1.3-0", Latest: "3.2.0-1"},
+	}, outdated)
+}
+
+func TestReadRockspecDependencies(t *testing.T) {
+	t.Parallel()
+
+	rockspec := filepath.Join(t.TempDir(), "app-dev-1.rockspec")
+	require.NoError(t, os.WriteFile(rockspec, []byte(strings.Join([]string{
+		`package = "app"`,
+		`description = { summary = "} is not the end" }`,
+		`dependencies = {`,
+		`  "lua ~> 5.3",`,
+		`  -- "penlight >= 1.5", }`,
+		`  'inspect >= 3.1',`,
+		`  --[[ "argparse" ]]`,
+		`}`,
+		`test_dependencies = { "busted" }`,
+	}, "\n")), 0o600))
+
+	a := &amalg{p: AmalgParams{Rockspec: rockspec}}
+	deps, err := a.readDependencies()
+	require.NoError(t, err)
+	require.Len(t, deps, 1)
+	require.Equal(t, "inspect", deps["inspect"].name)
+	require.Len(t, deps["inspect"].constraints, 1)
+}
@@ -11,18 +11,22 @@ import (
 	"os/exec"
 	"path/filepath"
 	"strings"
-	"sync"
 	"text/template"
+	"time"
 
-	"github.com/enapter/rockamalg/internal/archive"
 	"github.com/enapter/rockamalg/internal/rockamalg/analyzer"
+	"github.com/enapter/rockamalg/internal/rockscache"
 )
 
+// Rockamalg is safe for concurrent use. Every amalgamation has its own rocks tree
+// and luarocks home directory, so commands of different amalgamations run in parallel.
 type Rockamalg struct {
-	rockspecTmpl  *template.Template
-	rocksServer   string
-	analyzer      *analyzer.Analyzer
-	commandExecMu sync.Mutex
+	rockspecTmpl *template.Template
+	version      string
+	rocksServer  string
+	luaVersion   string
+	analyzer     *analyzer.Analyzer
+	cache        rockscache.Params
 }
 
 type AmalgParams struct {
@@ -34,11 +38,88 @@ type AmalgParams struct {
 	Isolate      bool
 	DisableDebug bool
 	AllowDevDeps bool
-	Writer       io.Writer
+	// Strict fails the amalgamation if required modules could not be found.
+	// Lua standard library modules and modules from AllowUnresolved are allowed.
+	// AllowUnresolved entries are module names or prefixes like "enapter.*".
+	Strict          bool
+	AllowUnresolved []string
+	// LuaVersion overrides the Lua version from Params for this amalgamation.
+	LuaVersion string
+	// AllowNativeModules reports native modules of rocks instead of failing with NativeModulesError.
+	// Native modules are not included into the result.
+	AllowNativeModules bool
+	// SearchPath are package.path-style templates to search modules in the Lua directory,
+	// e.g. "src/?.lua;src/?/init.lua". It overrides the search path from the project config.
+	// Default is DefaultSearchPath.
+	SearchPath string
+	// Backend is BackendNative (default) or BackendAmalgLua.
+	Backend string
+	// Minify strips comments and redundant whitespace of every module, MinifyLocals
+	// renames local variables too. Line numbers are kept unless debug is disabled.
+	// Minification is supported by the native backend only.
+	Minify       bool
+	MinifyLocals bool
+	// BytecodeOutput is a file to write the result compiled to stripped bytecode with luac -s.
+	// It could be the same as Output to write bytecode instead of the source.
+	BytecodeOutput string
+	// SourceMap is a file to write the JSON source map of the result to.
+	// It is supported by the native backend only.
+	SourceMap string
+	// LockFile is a file to record exact versions of installed rocks to.
+	// It is written only if it is set.
+	LockFile string
+	// Locked installs rocks of the lock file and fails if dependencies require other rocks.
+	Locked bool
+	// BuildInfo writes the header comment with the build info and includes BuildInfoModule
+	// with the same data, BuildVersion and git describe of the Lua directory.
+	// The build time is taken from SOURCE_DATE_EPOCH if it is set.
+	// It is supported by the native backend only.
+	BuildInfo    bool
+	BuildVersion string
+	// Offline skips luarocks install and builds from the vendor archive only.
+	// It fails if the vendor does not satisfy the dependencies.
+	Offline bool
+	// PruneVendor builds the vendor archive after the amalgamation with rocks which modules
+	// are included into the result only. Vendor should be a zip archive.
+	PruneVendor bool
+	// AllowLegacyVendor extracts vendor archives without manifest built by previous versions
+	// with a warning. Such archives are not verified, so they are rejected by default.
+	AllowLegacyVendor bool
+	Writer            io.Writer
+}
+
+// AmalgResult holds diagnostics of a successful amalgamation.
+type AmalgResult struct {
+	// DynamicRequires are requires which module names could not be resolved statically.
+	// Such modules are not included into the result unless isolate mode is used.
+	DynamicRequires []analyzer.DynamicRequire
+	// NativeModules are allowed native modules of rocks, which are not included into the result.
+	NativeModules []NativeModule
+	// OutputSHA256 is the hex encoded SHA-256 of the output file.
+	OutputSHA256 string
+	// BytecodeSHA256 is the hex encoded SHA-256 of the bytecode output
+	// if it is written to a separate file.
+	BytecodeSHA256 string
+	// PrunedRocks are rocks dropped from the vendor archive.
+	PrunedRocks []PrunedRock
 }
 
+// DefaultLuaVersion is the Lua version used when no version is set.
+const DefaultLuaVersion = "5.3"
+
 type Params struct {
+	// Version of rockamalg shown in the build info.
+	Version     string
 	RocksServer string
+	// LuaVersion is the target Lua version: 5.1, 5.2, 5.3 or 5.4. Default is DefaultLuaVersion.
+	LuaVersion string
+	// CacheDir enables the cache of installed rocks trees shared by amalgamations and processes.
+	// Trees are installed once for the same rockspec, rocks server and dev dependencies flag.
+	CacheDir string
+	// CacheMaxSize is the total size of cached trees in bytes, CacheTTL is the time since the last
+	// use of a tree. Trees above the limits are evicted. Zero means no limit.
+	CacheMaxSize int64
+	CacheTTL     time.Duration
 }
 
 func New(p Params) *Rockamalg {
@@ -50,127 +131,352 @@ source = {
 	url = 'generated'
 }
 dependencies = {
-	'lua ~> 5.3',
+	'lua ~> {{.LuaVersion}}',
 {{- range .Deps -}}
 	'{{printf "%s" .}}',
 {{- end -}}
 }
 `))
 
+	luaVersion := p.LuaVersion
+	if luaVersion == "" {
+		luaVersion = DefaultLuaVersion
+	}
+
+	version := p.Version
+	if version == "" {
+		version = "dev"
+	}
+
 	return &Rockamalg{
 		rockspecTmpl: tmpl,
+		version:      version,
 		rocksServer:  p.RocksServer,
+		luaVersion:   luaVersion,
 		analyzer:     analyzer.New(),
+		cache: rockscache.Params{
+			Dir:     p.CacheDir,
+			MaxSize: p.CacheMaxSize,
+			TTL:     p.CacheTTL,
+		},
 	}
 }
 
-func (r *Rockamalg) Amalg(ctx context.Context, p AmalgParams) error {
-	if p.Dependencies != "" && p.Rockspec != "" {
-		return errRockspecDepsSimultaneously
+func (r *Rockamalg) Amalg(ctx context.Context, p AmalgParams) (AmalgResult, error) {
+	a, err := r.newAmalg(p)
+	if err != nil {
+		return AmalgResult{}, err
 	}
+	defer a.cleanup()
 
-	if p.Lua == "" {
-		return errLuaMissed
+	if err := a.Do(ctx); err != nil {
+		return AmalgResult{}, err
 	}
 
-	runCmdSync := func(cmd *exec.Cmd) (*bytes.Buffer, error) {
-		r.commandExecMu.Lock()
-		defer r.commandExecMu.Unlock()
+	return a.result(), nil
+}
 
-		outBuf := &bytes.Buffer{}
-		cmd.Stdout = outBuf
-		errBuf := &bytes.Buffer{}
-		cmd.Stderr = errBuf
+func (a *amalg) result() AmalgResult {
+	return AmalgResult{
+		DynamicRequires: a.dynamicRequires,
+		NativeModules:   a.nativeModules,
+		OutputSHA256:    a.outputSHA256,
+		BytecodeSHA256:  a.bytecodeSHA256,
+		PrunedRocks:     a.prunedRocksResult(),
+	}
+}
+
+func (r *Rockamalg) newAmalg(p AmalgParams) (*amalg, error) {
+	if p.Lua == "" {
+		return nil, errLuaMissed
+	}
 
-		if err := cmd.Run(); err != nil {
-			return nil, fmt.Errorf("%w (%s)", err, errBuf.Bytes())
+	if p.SearchPath != "" {
+		if _, err := ParseSearchPath(p.SearchPath); err != nil {
+			return nil, err
 		}
+	}
+
+	if p.Backend == "" {
+		p.Backend = BackendNative
+	}
+
+	if !IsSupportedBackend(p.Backend) {
+		return nil, fmt.Errorf("%w: %s", errUnsupportedBackend, p.Backend)
+	}
+
+	p.Minify = p.Minify || p.MinifyLocals
+	if p.Minify && p.Backend != BackendNative {
+		return nil, errMinifyBackend
+	}
+
+	if p.SourceMap != "" && p.Backend != BackendNative {
+		return nil, errSourceMapBackend
+	}
+
+	if p.Locked && p.LockFile == "" {
+		return nil, errLockFileMissed
+	}
 
-		return outBuf, nil
+	if p.PruneVendor && (p.Vendor == "" || inputVendorFormat(p.Vendor) != VendorFormatZip) {
+		return nil, errPruneVendorMissed
 	}
 
-	a := amalg{
+	p.BuildInfo = p.BuildInfo || p.BuildVersion != ""
+	if p.BuildInfo && p.Backend != BackendNative {
+		return nil, errBuildInfoBackend
+	}
+
+	return r.newRocksAmalg(p)
+}
+
+// newRocksAmalg checks only params needed to install dependencies into the rocks tree.
+func (r *Rockamalg) newRocksAmalg(p AmalgParams) (*amalg, error) {
+	if p.Dependencies != "" && p.Rockspec != "" {
+		return nil, errRockspecDepsSimultaneously
+	}
+
+	if p.LuaVersion == "" {
+		p.LuaVersion = r.luaVersion
+	}
+
+	if !IsSupportedLuaVersion(p.LuaVersion) {
+		return nil, fmt.Errorf("%w: %s", errUnsupportedLuaVersion, p.LuaVersion)
+	}
+
+	var cache *rockscache.Cache
+	if r.cache.Dir != "" {
+		var err error
+		if cache, err = rockscache.New(r.cache); err != nil {
+			return nil, err
+		}
+	}
+
+	return &amalg{
 		p:            p,
+		version:      r.version,
 		rockspecTmpl: r.rockspecTmpl,
 		rocksServer:  r.rocksServer,
-		runCmd:       runCmdSync,
+		runCmd:       runCmd,
 		analyzer:     r.analyzer,
+		cache:        cache,
+	}, nil
+}
+
+func runCmd(cmd *exec.Cmd) (*bytes.Buffer, error) {
+	outBuf := &bytes.Buffer{}
+	cmd.Stdout = outBuf
+	errBuf := &bytes.Buffer{}
+	cmd.Stderr = errBuf
+
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("%w (%s)", err, errBuf.Bytes())
 	}
-	defer a.cleanup()
 
-	return a.Do(ctx)
+	return outBuf, nil
 }
 
 type amalg struct {
-	p            AmalgParams
-	luaDir       string
-	luaMain      string
-	singleFile   bool
-	tree         string
-	modules      []string
-	rockspecTmpl *template.Template
-	rocksServer  string
-	cleanupFns   []func()
-	analyzer     *analyzer.Analyzer
-	runCmd       func(cmd *exec.Cmd) (*bytes.Buffer, error)
+	p                AmalgParams
+	luaDir           string
+	luaMain          string
+	singleFile       bool
+	tree             string
+	home             string
+	modules          []string
+	modulePaths      map[string]string
+	dynamicRequires  []analyzer.DynamicRequire
+	unresolved       []string
+	nativeModules    []NativeModule
+	searchPath       []string
+	outputSHA256     string
+	bytecodeSHA256   string
+	lockedRocks      []lockedRock
+	vendorUnverified bool
+	vendorPruned     []lockedRock
+	prunedRocks      []lockedRock
+	version          string
+	buildInfo        *buildInfo
+	rockspecTmpl     *template.Template
+	rocksServer      string
+	cleanupFns       []func()
+	analyzer         *analyzer.Analyzer
+	cache            *rockscache.Cache
+	runCmd           func(cmd *exec.Cmd) (*bytes.Buffer, error)
 }
 
 func (a *amalg) Do(ctx context.Context) error {
+	if err := a.prepareTree(ctx); err != nil {
+		return err
+	}
+
+	return a.amalgamateTree(ctx)
+}
+
+// amalgamateTree analyses and amalgamates the Lua sources against the prepared rocks tree.
+func (a *amalg) amalgamateTree(ctx context.Context) error {
+	// directories and tar.gz archives are written by the vendor command only,
+	// pruned archives are built after the amalgamation
+	if a.p.Rockspec != "" && a.p.Vendor != "" && inputVendorFormat(a.p.Vendor) == VendorFormatZip &&
+		!a.p.PruneVendor {
+		if err := a.wrapWithMsg(a.buildVendorArchive, "Building vendor archive")(ctx); err != nil {
+			return fmt.Errorf("build vendor archive: %w", err)
+		}
+	}
+
+	if err := a.wrapWithMsg(a.checkNativeModules, "Checking native modules")(ctx); err != nil {
+		return fmt.Errorf("check native modules: %w", err)
+	}
+
+	a.reportNativeModules()
+
+	if err := a.wrapWithMsg(a.calculateRequires, "Calculating requires")(ctx); err != nil {
+		return fmt.Errorf("calculate requires: %w", err)
+	}
+
+	a.reportDynamicRequires()
+
+	if a.p.BuildInfo {
+		if err := a.wrapWithMsg(a.collectBuildInfo, "Collecting build info")(ctx); err != nil {
+			return fmt.Errorf("collect build info: %w", err)
+		}
+	}
+
+	if a.p.Backend == BackendNative {
+		if err := a.wrapWithMsg(a.writeAmalgamation, "Amalgamating")(ctx); err != nil {
+			return fmt.Errorf("amalgamate: %w", err)
+		}
+	} else {
+		if err := a.wrapWithMsg(a.amalgamate, "Amalgamating")(ctx); err != nil {
+			return fmt.Errorf("amalgamate: %w", err)
+		}
+
+		if err := a.wrapWithMsg(a.cleanupResult, "Cleaning up result")(ctx); err != nil {
+			return fmt.Errorf("clean up result: %w", err)
+		}
+	}
+
+	if a.p.BytecodeOutput != "" {
+		if err := a.wrapWithMsg(a.compileBytecode, "Compiling bytecode")(ctx); err != nil {
+			return fmt.Errorf("compile bytecode: %w", err)
+		}
+	}
+
+	if a.p.Rockspec != "" && a.p.PruneVendor {
+		if err := a.wrapWithMsg(a.pruneVendorArchive, "Building pruned vendor archive")(ctx); err != nil {
+			return fmt.Errorf("build pruned vendor archive: %w", err)
+		}
+
+		a.reportPrunedRocks()
+	}
+
+	if err := a.hashOutputs(); err != nil {
+		return fmt.Errorf("hash outputs: %w", err)
+	}
+
+	a.reportHashes()
+
+	return nil
+}
+
+// prepareTree sets up the configuration and fills the rocks tree with dependencies.
+func (a *amalg) prepareTree(ctx context.Context) error {
 	if err := a.wrapWithMsg(a.setupConfig, "Setting up configuration")(ctx); err != nil {
 		return fmt.Errorf("set up configuration: %w", err)
 	}
 
+	return a.installTree(ctx)
+}
+
+// installTree fills the rocks tree with dependencies and the vendor archive.
+func (a *amalg) installTree(ctx context.Context) error {
 	if a.p.Dependencies != "" {
 		if err := a.wrapWithMsg(a.generateRockspec, "Generating rockspec")(ctx); err != nil {
 			return fmt.Errorf("generate rockspec: %w", err)
 		}
 	}
 
+	vendored := false
 	if a.p.Vendor != "" {
-		if empty, err := isFileEmpty(a.p.Vendor); err != nil {
+		if empty, err := isVendorEmpty(a.p.Vendor, inputVendorFormat(a.p.Vendor)); err != nil {
 			return fmt.Errorf("check vendor file is empty: %w", err)
 		} else if !empty {
 			if err := a.wrapWithMsg(a.extractVendorArchive, "Extracting vendor archive")(ctx); err != nil {
 				return fmt.Errorf("extract vendor archive: %w", err)
 			}
+			a.reportUnverifiedVendor()
+			vendored = true
 		}
 	}
 
-	if a.p.Rockspec != "" {
-		if err := a.wrapWithMsg(a.installDependencies, "Installing dependencies")(ctx); err != nil {
-			return fmt.Errorf("install dependencies: %w", err)
+	if a.p.Rockspec == "" {
+		return nil
+	}
+
+	switch {
+	case a.p.Offline:
+		if err := a.installOfflineRocks(ctx); err != nil {
+			return err
+		}
+	// the vendor archive is a cache of its own, trees installed over it are not cached
+	case a.cache != nil && !vendored:
+		if err := a.installCachedRocks(ctx); err != nil {
+			return err
+		}
+	default:
+		if err := a.installRocksTree(ctx); err != nil {
+			return err
 		}
+	}
 
-		if a.p.Vendor != "" {
-			if err := a.wrapWithMsg(a.buildVendorArchive, "Building vendor archive")(ctx); err != nil {
-				return fmt.Errorf("build vendor archive: %w", err)
-			}
+	return a.lockTree(ctx)
+}
+
+// installRocksTree installs locked rocks and dependencies of the rockspec into the tree.
+func (a *amalg) installRocksTree(ctx context.Context) error {
+	if a.p.Locked {
+		if err := a.wrapWithMsg(a.installLockedDependencies, "Installing locked dependencies")(ctx); err != nil {
+			return fmt.Errorf("install locked dependencies: %w", err)
 		}
 	}
 
-	if err := a.wrapWithMsg(a.calculateRequires, "Calculating requires")(ctx); err != nil {
-		return fmt.Errorf("calculate requires: %w", err)
+	if err := a.wrapWithMsg(a.installDependencies, "Installing dependencies")(ctx); err != nil {
+		return fmt.Errorf("install dependencies: %w", err)
 	}
 
-	if err := a.wrapWithMsg(a.amalgamate, "Amalgamating")(ctx); err != nil {
-		return fmt.Errorf("amalgamate: %w", err)
+	return nil
+}
+
+// lockTree writes installed rocks to the lockfile if it is set or checks them in locked mode.
+func (a *amalg) lockTree(ctx context.Context) error {
+	if a.p.Locked {
+		if err := a.wrapWithMsg(a.checkLockFile, "Checking lockfile")(ctx); err != nil {
+			return fmt.Errorf("check lockfile: %w", err)
+		}
+		return nil
+	}
+
+	if a.p.LockFile == "" {
+		return nil
 	}
 
-	if err := a.wrapWithMsg(a.cleanupResult, "Cleaning up result")(ctx); err != nil {
-		return fmt.Errorf("clean up result: %w", err)
+	if err := a.wrapWithMsg(a.writeLockFile, "Writing lockfile")(ctx); err != nil {
+		return fmt.Errorf("write lockfile: %w", err)
 	}
 
 	return nil
 }
 
-func (a *amalg) setupConfig(_ context.Context) error {
-	tmpDir, err := os.MkdirTemp("/tmp", "luarocks_deps_")
-	if err != nil {
-		return fmt.Errorf("mkdir temp: %w", err)
+func (a *amalg) setupConfig(ctx context.Context) error {
+	if err := a.setupTree(ctx); err != nil {
+		return err
 	}
-	a.cleanupFns = append(a.cleanupFns, func() { os.RemoveAll(tmpDir) })
-	a.tree = tmpDir
 
+	return a.setupLuaConfig(ctx)
+}
+
+// setupLuaConfig sets up the Lua directory, the output and the search path.
+func (a *amalg) setupLuaConfig(context.Context) error {
 	if !filepath.IsAbs(a.p.Output) {
 		curDir, err := os.Getwd()
 		if err != nil {
@@ -193,6 +499,57 @@ func (a *amalg) setupConfig(_ context.Context) error {
 		a.singleFile = true
 	}
 
+	cfg, err := loadProjectConfig(a.luaDir)
+	if err != nil {
+		return fmt.Errorf("load project config: %w", err)
+	}
+
+	searchPath := DefaultSearchPath
+	if a.p.SearchPath != "" {
+		searchPath = a.p.SearchPath
+	} else if cfg.SearchPath != "" {
+		searchPath = cfg.SearchPath
+	}
+
+	if a.searchPath, err = ParseSearchPath(searchPath); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// setupTree creates the temporary rocks tree removed on clean up.
+func (a *amalg) setupTree(context.Context) error {
+	tmpDir, err := os.MkdirTemp("/tmp", "luarocks_deps_")
+	if err != nil {
+		return fmt.Errorf("mkdir temp: %w", err)
+	}
+	a.cleanupFns = append(a.cleanupFns, func() { os.RemoveAll(tmpDir) })
+	a.tree = tmpDir
+
+	return a.setupHome()
+}
+
+// setupHome creates the temporary home directory for luarocks. Luarocks keeps the download
+// cache there, so concurrent amalgamations do not share it. The user config is linked as is.
+func (a *amalg) setupHome() error {
+	home, err := os.MkdirTemp("/tmp", "luarocks_home_")
+	if err != nil {
+		return fmt.Errorf("mkdir temp: %w", err)
+	}
+	a.cleanupFns = append(a.cleanupFns, func() { os.RemoveAll(home) })
+	a.home = home
+
+	userHome, _ := os.UserHomeDir()
+	userConfig := filepath.Join(userHome, ".luarocks")
+	if isDir, _ := isDirectory(userConfig); !isDir || userHome == "" {
+		return nil
+	}
+
+	if err := os.Symlink(userConfig, filepath.Join(home, ".luarocks")); err != nil {
+		return fmt.Errorf("link luarocks config: %w", err)
+	}
+
 	return nil
 }
 
@@ -204,7 +561,10 @@ func (a *amalg) generateRockspec(context.Context) error {
 
 	deps := bytes.Split(depsBytes, []byte{'\n'})
 
-	args := struct{ Deps [][]byte }{}
+	args := struct {
+		LuaVersion string
+		Deps       [][]byte
+	}{LuaVersion: a.p.LuaVersion}
 	for _, d := range deps {
 		if len(d) != 0 {
 			args.Deps = append(args.Deps, d)
@@ -258,12 +618,45 @@ func (a *amalg) installDependencies(ctx context.Context) error {
 	return nil
 }
 
+// extractVendorArchive verifies the vendor archive against its manifest before extraction.
+// Archives built before manifests were introduced are extracted without verification.
 func (a *amalg) extractVendorArchive(_ context.Context) error {
-	return archive.UnzipFileToDir(a.p.Vendor, a.tree)
+	format := inputVendorFormat(a.p.Vendor)
+	files, err := readVendorFiles(a.p.Vendor, format)
+	if err != nil {
+		return err
+	}
+
+	if err := verifyVendorFiles(files); err != nil {
+		if !IsVendorManifestMissed(err) || !a.p.AllowLegacyVendor {
+			return err
+		}
+		a.vendorUnverified = true
+	}
+
+	if !a.vendorUnverified {
+		m, err := parseVendorManifest(files)
+		if err != nil {
+			return err
+		}
+		a.vendorPruned = m.Pruned
+	}
+
+	return extractVendor(a.p.Vendor, format, a.tree)
+}
+
+func (a *amalg) reportUnverifiedVendor() {
+	if a.p.Writer == nil || !a.vendorUnverified {
+		return
+	}
+
+	fmt.Fprintln(a.p.Writer, "Warning: vendor archive has no manifest and is not verified, rebuild it")
 }
 
 func (a *amalg) buildVendorArchive(_ context.Context) error {
-	return archive.ZipDirToFile(a.tree, a.p.Vendor)
+	// rocks pruned earlier stay pruned until they are installed again
+	pruned := append(append([]lockedRock{}, a.vendorPruned...), a.prunedRocks...)
+	return writeVendor(a.tree, a.p.Vendor, VendorFormatZip, a.p.LuaVersion, pruned)
 }
 
 func (a *amalg) calculateRequires(ctx context.Context) error {
@@ -274,7 +667,36 @@ func (a *amalg) calculateRequires(ctx context.Context) error {
 		err = a.analyzeRequires(ctx)
 	}
 
-	return err
+	if err != nil || !a.p.Strict {
+		return err
+	}
+
+	return a.checkUnresolvedRequires()
+}
+
+func (a *amalg) checkUnresolvedRequires() error {
+	if a.p.Isolate {
+		// isolate mode includes modules without analysis
+		res, err := a.analyzer.AnalyzeRequires(a.luaMain, a.luaDir, a.tree, a.p.LuaVersion, a.searchPath)
+		if err != nil {
+			return fmt.Errorf("analyze requires: %w", err)
+		}
+		a.unresolved = res.Unresolved
+	}
+
+	var unresolved []string
+	for _, m := range a.unresolved {
+		// allowed native modules are expected to be provided by the runtime
+		if !isAllowedUnresolved(m, a.p.AllowUnresolved) && !a.isNativeModule(m) {
+			unresolved = append(unresolved, m)
+		}
+	}
+
+	if len(unresolved) != 0 {
+		return fmt.Errorf("%w: %s", errUnresolvedModules, strings.Join(unresolved, ", "))
+	}
+
+	return nil
 }
 
 func (a *amalg) amalgamate(ctx context.Context) error {
@@ -282,7 +704,7 @@ func (a *amalg) amalgamate(ctx context.Context) error {
 	if !a.p.DisableDebug {
 		args = append(args, "--debug")
 	}
-	args = append(args, a.modules...)
+	args = append(args, a.moduleNames()...)
 	cmd := exec.CommandContext(ctx, "amalg.lua", args...)
 	cmd.Dir = a.luaDir
 
@@ -291,7 +713,7 @@ func (a *amalg) amalgamate(ctx context.Context) error {
 	if err != nil {
 		return fmt.Errorf("run luarocks path: %w", err)
 	}
-	cmd.Env = append(cmd.Env, a.extractLuaPathEnv(output.String()))
+	cmd.Env = append(cmd.Env, a.luaPathEnv(output.String()))
 
 	if _, err := a.runCmd(cmd); err != nil {
 		return fmt.Errorf("amalg.lua: %w", err)
@@ -299,6 +721,16 @@ func (a *amalg) amalgamate(ctx context.Context) error {
 	return nil
 }
 
+// compileBytecode compiles the result with luac of the target Lua version.
+// Luac loads the input before writing the output, so they could be the same file.
+func (a *amalg) compileBytecode(ctx context.Context) error {
+	cmd := exec.CommandContext(ctx, "luac"+a.p.LuaVersion, "-s", "-o", a.p.BytecodeOutput, a.p.Output)
+	if _, err := a.runCmd(cmd); err != nil {
+		return fmt.Errorf("run luac: %w", err)
+	}
+	return nil
+}
+
 func (a *amalg) cleanupResult(_ context.Context) error {
 	f, err := os.OpenFile(a.p.Output, os.O_RDWR, 0)
 	if err != nil {
@@ -342,44 +774,116 @@ func (a *amalg) calculateIsolatedRequires(ctx context.Context) error {
 }
 
 func (a *amalg) analyzeRequires(context.Context) error {
-	reqs, err := a.analyzer.AnalyzeRequires(a.luaMain, a.luaDir, a.tree)
+	res, err := a.analyzer.AnalyzeRequires(a.luaMain, a.luaDir, a.tree, a.p.LuaVersion, a.searchPath)
 	if err != nil {
 		return fmt.Errorf("analyze requires: %w", err)
 	}
 
-	a.modules = append(a.modules, reqs...)
+	for _, m := range res.Modules {
+		if m.Kind != analyzer.ModuleUnresolved && m.Path != filepath.Join(a.luaDir, a.luaMain) {
+			a.addModule(m.Name, m.Path)
+		}
+	}
+	a.dynamicRequires = res.DynamicRequires
+	a.unresolved = res.Unresolved
 
 	return nil
 }
 
+func (a *amalg) reportDynamicRequires() {
+	if a.p.Writer == nil {
+		return
+	}
+
+	for _, r := range a.dynamicRequires {
+		fmt.Fprintln(a.p.Writer, r)
+	}
+}
+
 func (a *amalg) calculateLuaRocksRequires(ctx context.Context) error {
-	rocksListCmd := a.buildLuaRocksCommand(ctx, "list", "--porcelain")
-	rocksListBuf, err := a.runCmd(rocksListCmd)
+	rockModules, err := a.listRockModules(ctx)
 	if err != nil {
-		return fmt.Errorf("run luarocks list: %w", err)
+		return err
 	}
 
-	rocksScan := bufio.NewScanner(rocksListBuf)
-	for rocksScan.Scan() {
-		rock := strings.Fields(rocksScan.Text())[0]
-		if rock == "amalg" {
+	for _, m := range rockModules {
+		if a.isNativeModule(m.module) {
 			continue
 		}
 
-		rockModulesCmd := a.buildLuaRocksCommand(ctx, "show", "--modules", rock)
+		path, err := a.findRockModuleFile(m.module)
+		if err != nil {
+			return fmt.Errorf("module=%s, find file: %w", m.module, err)
+		}
+		a.addModule(m.module, path)
+	}
+
+	return nil
+}
+
+// rockModule is a module provided by an installed rock.
+type rockModule struct {
+	module  string
+	rock    string
+	version string
+}
+
+func (a *amalg) listRockModules(ctx context.Context) ([]rockModule, error) {
+	rocks, err := a.listRocks(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var modules []rockModule
+	for _, r := range rocks {
+		rockModulesCmd := a.buildLuaRocksCommand(ctx, "show", "--modules", r.name)
 		rocksModulesBuf, err := a.runCmd(rockModulesCmd)
 		if err != nil {
-			return fmt.Errorf("run luarocks show modules: %w", err)
+			return nil, fmt.Errorf("run luarocks show modules: %w", err)
 		}
 
 		rockModulesScan := bufio.NewScanner(rocksModulesBuf)
 		for rockModulesScan.Scan() {
 			mod := strings.TrimSuffix(rockModulesScan.Text(), ".init")
-			a.modules = append(a.modules, mod)
+			modules = append(modules, rockModule{module: mod, rock: r.name, version: r.version})
 		}
 	}
 
-	return nil
+	return modules, nil
+}
+
+// installedRock is a rock installed into the rocks tree.
+type installedRock struct {
+	name    string
+	version string
+}
+
+// listRocks returns rocks of the tree except amalg, which is used to amalgamate only.
+func (a *amalg) listRocks(ctx context.Context) ([]installedRock, error) {
+	rocksListCmd := a.buildLuaRocksCommand(ctx, "list", "--porcelain")
+	rocksListBuf, err := a.runCmd(rocksListCmd)
+	if err != nil {
+		return nil, fmt.Errorf("run luarocks list: %w", err)
+	}
+
+	var rocks []installedRock
+	rocksScan := bufio.NewScanner(rocksListBuf)
+	for rocksScan.Scan() {
+		// name, version, status and tree are separated by tabs
+		fields := strings.Fields(rocksScan.Text())
+		if len(fields) == 0 || fields[0] == "amalg" {
+			continue
+		}
+
+		var version string
+		if len(fields) > 1 {
+			version = fields[1]
+		}
+
+		rocks = append(rocks, installedRock{name: fields[0], version: version})
+	}
+
+	return rocks, nil
 }
 
 func (a *amalg) gatherLuaDirectory(context.Context) error {
@@ -392,17 +896,14 @@ func (a *amalg) gatherLuaDirectory(context.Context) error {
 			return nil
 		}
 
-		if filepath.Ext(path) != ".lua" {
-			return nil
+		rel, err := filepath.Rel(a.luaDir, path)
+		if err != nil {
+			return err
 		}
 
-		mod := strings.TrimPrefix(path, a.luaDir+string(os.PathSeparator))
-		mod = strings.ReplaceAll(mod, "/", ".")
-		mod = strings.TrimSuffix(mod, ".lua")
-		mod = strings.TrimSuffix(mod, ".init")
-
-		if mod != "main" {
-			a.modules = append(a.modules, mod)
+		mod, ok := templateModuleName(a.searchPath, rel)
+		if ok && mod != "main" && rel != a.luaMain {
+			a.addModule(mod, path)
 		}
 
 		return nil
@@ -415,17 +916,26 @@ func (a *amalg) gatherLuaDirectory(context.Context) error {
 }
 
 func (a *amalg) buildLuaRocksCommand(ctx context.Context, args ...string) *exec.Cmd {
-	args = append([]string{"--tree", a.tree}, args...)
-	return exec.CommandContext(ctx, "luarocks", args...)
+	args = append([]string{"--tree", a.tree, "--lua-version", a.p.LuaVersion}, args...)
+	cmd := exec.CommandContext(ctx, "luarocks", args...)
+	if a.home != "" {
+		cmd.Env = append(os.Environ(), "HOME="+a.home)
+	}
+	return cmd
 }
 
-func (*amalg) extractLuaPathEnv(data string) string {
+// luaPathEnv extends LUA_PATH of the rocks tree with the search path of the Lua directory.
+func (a *amalg) luaPathEnv(data string) string {
+	luaPath := ""
 	for _, s := range strings.Fields(data) {
 		if strings.HasPrefix(s, "LUA_PATH='") {
-			return strings.Replace(strings.TrimSuffix(s, "'"), "LUA_PATH='", "LUA_PATH=", 1)
+			luaPath = strings.TrimPrefix(strings.TrimSuffix(s, "'"), "LUA_PATH='")
+			break
 		}
 	}
-	return ""
+
+	// amalg.lua runs in the Lua directory, so relative templates work as is
+	return "LUA_PATH=" + strings.Join(append([]string{luaPath}, a.searchPath...), ";")
 }
 
 func (a *amalg) wrapWithMsg(fn func(context.Context) error, msg string) func(context.Context) error {
@@ -450,6 +960,41 @@ func (a *amalg) cleanup() {
 	}
 }
 
+// IsSupportedLuaVersion reports whether the Lua version could be targeted.
+func IsSupportedLuaVersion(v string) bool {
+	switch v {
+	case "5.1", "5.2", "5.3", "5.4":
+		return true
+	}
+	return false
+}
+
+// luaStdlibModules are modules provided by the Lua standard library of any supported version.
+//
+//nolint:gochecknoglobals // read-only lookup table
+var luaStdlibModules = map[string]struct{}{
+	"_G": {}, "coroutine": {}, "debug": {}, "io": {}, "math": {},
+	"os": {}, "package": {}, "string": {}, "table": {}, "utf8": {}, "bit32": {},
+}
+
+func isAllowedUnresolved(module string, allowed []string) bool {
+	if _, ok := luaStdlibModules[module]; ok {
+		return true
+	}
+
+	for _, a := range allowed {
+		if prefix, ok := strings.CutSuffix(a, ".*"); ok {
+			if module == prefix || strings.HasPrefix(module, prefix+".") {
+				return true
+			}
+		} else if module == a {
+			return true
+		}
+	}
+
+	return false
+}
+
 func isDirectory(path string) (bool, error) {
 	fileInfo, err := os.Stat(path)
 	if err != nil {
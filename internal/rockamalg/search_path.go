@@ -0,0 +1,88 @@
+package rockamalg
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// DefaultSearchPath is used to search modules in the Lua directory if no search path is set.
+const DefaultSearchPath = "?.lua;?/init.lua"
+
+// ProjectConfigFile is a name of the optional project config in the Lua directory.
+const ProjectConfigFile = "rockamalg.json"
+
+type projectConfig struct {
+	// SearchPath is the same as AmalgParams.SearchPath, the params take precedence.
+	SearchPath string `json:"search_path"`
+}
+
+func loadProjectConfig(luaDir string) (projectConfig, error) {
+	data, err := os.ReadFile(filepath.Join(luaDir, ProjectConfigFile))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return projectConfig{}, nil
+		}
+		return projectConfig{}, fmt.Errorf("read: %w", err)
+	}
+
+	var cfg projectConfig
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return projectConfig{}, fmt.Errorf("parse: %w", err)
+	}
+
+	return cfg, nil
+}
+
+// ParseSearchPath splits package.path-style templates separated by semicolons.
+// Templates are relative to the Lua directory and contain exactly one question mark.
+func ParseSearchPath(s string) ([]string, error) {
+	var templates []string
+	for _, t := range strings.Split(s, ";") {
+		if t == "" {
+			continue
+		}
+
+		if strings.Count(t, "?") != 1 || filepath.IsAbs(t) || !filepath.IsLocal(strings.ReplaceAll(t, "?", "m")) {
+			return nil, fmt.Errorf("%w: %s", errInvalidSearchTemplate, t)
+		}
+
+		templates = append(templates, t)
+	}
+
+	if len(templates) == 0 {
+		return nil, fmt.Errorf("%w: %q", errInvalidSearchPath, s)
+	}
+
+	return templates, nil
+}
+
+// templateModuleName returns a name of the module found at the path relative to the Lua directory.
+// More specific templates are tried first, so x/init.lua is the module x for ?.lua;?/init.lua.
+func templateModuleName(templates []string, path string) (string, bool) {
+	sorted := append([]string(nil), templates...)
+	sort.SliceStable(sorted, func(i, j int) bool { return len(sorted[i]) > len(sorted[j]) })
+
+	path = filepath.ToSlash(path)
+	for _, t := range sorted {
+		prefix, suffix, _ := strings.Cut(t, "?")
+		if len(path) <= len(prefix)+len(suffix) ||
+			!strings.HasPrefix(path, prefix) || !strings.HasSuffix(path, suffix) {
+			continue
+		}
+
+		name := strings.TrimSuffix(strings.TrimPrefix(path, prefix), suffix)
+		if strings.Contains(name, ".") {
+			// dots are separators of module names and could not be a part of file names
+			continue
+		}
+
+		return strings.ReplaceAll(name, "/", "."), true
+	}
+
+	return "", false
+}
@@ -0,0 +1,129 @@
+package rockamalg
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const sourceMapVersion = 1
+
+// SourceMap maps lines of the amalgamated file to lines of the original files.
+type SourceMap struct {
+	Version int `json:"version"`
+	// File is the name of the amalgamated file.
+	File    string          `json:"file"`
+	Sources []SourceMapping `json:"sources"`
+}
+
+// SourceMapping maps the output lines from Start to End to the original file starting from its first line.
+// Module is empty for the main script.
+type SourceMapping struct {
+	Module string `json:"module,omitempty"`
+	File   string `json:"file"`
+	Start  int    `json:"start"`
+	End    int    `json:"end"`
+}
+
+func (m *SourceMap) add(module, file string, start int, src []byte) {
+	m.Sources = append(m.Sources, SourceMapping{
+		Module: module,
+		File:   file,
+		Start:  start,
+		End:    start + bytes.Count(src, []byte("\n")),
+	})
+}
+
+// WriteFile writes the source map in JSON format.
+func (m SourceMap) WriteFile(path string) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), outputFilePerm)
+}
+
+// ReadSourceMap reads the source map written with AmalgParams.SourceMap.
+func ReadSourceMap(path string) (SourceMap, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return SourceMap{}, fmt.Errorf("read: %w", err)
+	}
+
+	var m SourceMap
+	if err := json.Unmarshal(data, &m); err != nil {
+		return SourceMap{}, fmt.Errorf("parse: %w", err)
+	}
+
+	if m.Version != sourceMapVersion {
+		return SourceMap{}, fmt.Errorf("%w: %d", errUnsupportedSourceMap, m.Version)
+	}
+
+	return m, nil
+}
+
+// Lookup returns the original file and line of the output line.
+func (m SourceMap) Lookup(line int) (string, int, bool) {
+	for _, s := range m.Sources {
+		if line >= s.Start && line <= s.End {
+			return s.File, line - s.Start + 1, true
+		}
+	}
+	return "", 0, false
+}
+
+// traceLocationRe matches locations like main.lua:12 or [string "main.lua"]:12 in tracebacks.
+//
+//nolint:gochecknoglobals // compiled once
+var traceLocationRe = regexp.MustCompile(`(\[string "[^"]*"\]|[^\s:<>'"]+):(\d+)`)
+
+// TranslateTrace rewrites locations of the amalgamated file in the Lua traceback to locations
+// of the original files. The amalgamated file is recognized by the file name from the source map
+// or by the chunk name, if it is set.
+func (m SourceMap) TranslateTrace(r io.Reader, w io.Writer, chunkName string) error {
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		line := traceLocationRe.ReplaceAllStringFunc(sc.Text(), func(loc string) string {
+			sub := traceLocationRe.FindStringSubmatch(loc)
+			if !m.isOutputChunk(sub[1], chunkName) {
+				return loc
+			}
+
+			n, err := strconv.Atoi(sub[2])
+			if err != nil {
+				return loc
+			}
+
+			file, srcLine, ok := m.Lookup(n)
+			if !ok {
+				return loc
+			}
+			return file + ":" + strconv.Itoa(srcLine)
+		})
+
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+
+	return sc.Err()
+}
+
+func (m SourceMap) isOutputChunk(name, chunkName string) bool {
+	if s, ok := strings.CutPrefix(name, `[string "`); ok {
+		name = strings.TrimSuffix(s, `"]`)
+	}
+
+	if chunkName != "" {
+		return name == chunkName
+	}
+
+	return filepath.Base(name) == m.File
+}
@@ -0,0 +1,579 @@
+package rockamalg
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/enapter/rockamalg/internal/archive"
+	"github.com/enapter/rockamalg/internal/rockamalg/analyzer"
+)
+
+// VendorManifest is a name of the vendor manifest file in the root of the vendor archive.
+const VendorManifest = "rockamalg-vendor.json"
+
+// maxReportedVendorFiles limits files listed in the verification error.
+const maxReportedVendorFiles = 10
+
+// Vendor formats: a directory, which could be committed as is, or an archive.
+const (
+	VendorFormatDir   = "dir"
+	VendorFormatZip   = "zip"
+	VendorFormatTarGz = "tar.gz"
+)
+
+// VendorFormat detects the format of the vendor: an existing directory or an archive
+// by its extension. Existing files without known extension are zip archives.
+// It is empty for unknown formats.
+func VendorFormat(vendor string) string {
+	if isDir, _ := isDirectory(vendor); isDir {
+		return VendorFormatDir
+	}
+
+	switch {
+	case strings.HasSuffix(vendor, ".tar.gz") || strings.HasSuffix(vendor, ".tgz"):
+		return VendorFormatTarGz
+	case strings.HasSuffix(vendor, ".zip"):
+		return VendorFormatZip
+	}
+
+	if _, err := os.Stat(vendor); err == nil {
+		return VendorFormatZip
+	}
+
+	return ""
+}
+
+// IsSupportedVendorFormat reports whether the vendor could be written in the format.
+func IsSupportedVendorFormat(f string) bool {
+	switch f {
+	case VendorFormatDir, VendorFormatZip, VendorFormatTarGz:
+		return true
+	default:
+		return false
+	}
+}
+
+// vendorManifest lists rocks of the vendor archive and SHA-256 of every file,
+// so tampered or partial archives are detected before they are used.
+type vendorManifest struct {
+	LuaVersion string       `json:"lua_version"`
+	Rocks      []vendorRock `json:"rocks"`
+	// Files belong to no rock, e.g. the manifest of the rocks tree.
+	Files []vendorFile `json:"files"`
+	// Pruned rocks are dependencies dropped from the vendor as unused by the amalgamation.
+	// They are recorded as locked rocks, so lockfiles of offline builds keep them.
+	Pruned []lockedRock `json:"pruned,omitempty"`
+}
+
+type vendorRock struct {
+	Name    string       `json:"name"`
+	Version string       `json:"version"`
+	Files   []vendorFile `json:"files"`
+}
+
+type vendorFile struct {
+	Path   string `json:"path"`
+	SHA256 string `json:"sha256"`
+}
+
+type VendorParams struct {
+	Dependencies string
+	Rockspec     string
+	// Output is the vendor directory or archive. An existing directory is replaced
+	// if it is a vendor directory or empty.
+	Output string
+	// Format is VendorFormatDir, VendorFormatZip or VendorFormatTarGz.
+	// Default is VendorFormat of Output or VendorFormatDir if it is unknown.
+	Format string
+	// LockFile is written if it is set. Locked installs rocks of the lockfile
+	// and fails if dependencies require other rocks.
+	LockFile     string
+	Locked       bool
+	AllowDevDeps bool
+	LuaVersion   string
+	Writer       io.Writer
+}
+
+// Vendor installs dependencies and writes the rocks tree with its manifest,
+// so the vendor could be committed and used by Amalg instead of the rocks server.
+func (r *Rockamalg) Vendor(ctx context.Context, p VendorParams) error {
+	if p.Dependencies == "" && p.Rockspec == "" {
+		return errDependenciesMissed
+	}
+
+	if p.Output == "" {
+		return errVendorOutputMissed
+	}
+
+	if p.Locked && p.LockFile == "" {
+		return errLockFileMissed
+	}
+
+	format := p.Format
+	if format == "" {
+		if format = VendorFormat(p.Output); format == "" {
+			format = VendorFormatDir
+		}
+	}
+
+	if !IsSupportedVendorFormat(format) {
+		return fmt.Errorf("%w: %s", errUnsupportedVendorFormat, format)
+	}
+
+	a, err := r.newRocksAmalg(AmalgParams{
+		Dependencies: p.Dependencies,
+		Rockspec:     p.Rockspec,
+		LockFile:     p.LockFile,
+		Locked:       p.Locked,
+		AllowDevDeps: p.AllowDevDeps,
+		LuaVersion:   p.LuaVersion,
+		Writer:       p.Writer,
+	})
+	if err != nil {
+		return err
+	}
+	defer a.cleanup()
+
+	if err := a.wrapWithMsg(a.setupTree, "Setting up configuration")(ctx); err != nil {
+		return fmt.Errorf("set up configuration: %w", err)
+	}
+
+	if a.p.Dependencies != "" {
+		if err := a.wrapWithMsg(a.generateRockspec, "Generating rockspec")(ctx); err != nil {
+			return fmt.Errorf("generate rockspec: %w", err)
+		}
+	}
+
+	if a.cache != nil {
+		err = a.installCachedRocks(ctx)
+	} else {
+		err = a.installRocksTree(ctx)
+	}
+	if err != nil {
+		return err
+	}
+
+	if p.LockFile != "" {
+		if err := a.lockTree(ctx); err != nil {
+			return err
+		}
+	}
+
+	write := func(context.Context) error { return writeVendor(a.tree, p.Output, format, a.p.LuaVersion, nil) }
+	if err := a.wrapWithMsg(write, "Writing vendor")(ctx); err != nil {
+		return fmt.Errorf("write vendor: %w", err)
+	}
+
+	return nil
+}
+
+// VerifyVendor checks files of the vendor directory or archive against its manifest.
+func VerifyVendor(vendor string) error {
+	files, err := readVendorFiles(vendor, inputVendorFormat(vendor))
+	if err != nil {
+		return err
+	}
+
+	return verifyVendorFiles(files)
+}
+
+// inputVendorFormat is the format of the existing vendor. Vendors of unknown formats are zip archives.
+func inputVendorFormat(vendor string) string {
+	if f := VendorFormat(vendor); f != "" {
+		return f
+	}
+	return VendorFormatZip
+}
+
+func readVendorFiles(vendor, format string) (map[string][]byte, error) {
+	var files map[string][]byte
+	var err error
+	switch format {
+	case VendorFormatDir:
+		files, err = archive.DirToFilesMap(vendor)
+	case VendorFormatTarGz:
+		files, err = archive.UntarGzFileToFilesMap(vendor)
+	default:
+		files, err = archive.UnzipFileToFilesMap(vendor)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read vendor: %w", err)
+	}
+
+	return files, nil
+}
+
+func extractVendor(vendor, format, tree string) error {
+	switch format {
+	case VendorFormatDir:
+		return archive.CopyDir(vendor, tree)
+	case VendorFormatTarGz:
+		return archive.UntarGzFileToDir(vendor, tree)
+	default:
+		return archive.UnzipFileToDir(vendor, tree)
+	}
+}
+
+// isVendorEmpty reports whether there is nothing to extract: the vendor does not exist,
+// the archive is an empty file or the directory has no entries.
+func isVendorEmpty(vendor, format string) (bool, error) {
+	if format != VendorFormatDir {
+		return isFileEmpty(vendor)
+	}
+
+	entries, err := os.ReadDir(vendor)
+	if err != nil {
+		return false, fmt.Errorf("read vendor: %w", err)
+	}
+	return len(entries) == 0, nil
+}
+
+// writeVendor writes the rocks tree with its manifest in the format. The existing directory
+// is replaced only if it is a vendor directory or empty, so other files are not removed by mistake.
+func writeVendor(tree, vendor, format, luaVersion string, pruned []lockedRock) error {
+	if err := writeVendorManifest(tree, luaVersion, pruned); err != nil {
+		return fmt.Errorf("write manifest: %w", err)
+	}
+
+	switch format {
+	case VendorFormatZip:
+		return archive.ZipDirToFile(tree, vendor)
+	case VendorFormatTarGz:
+		return archive.TarGzDirToFile(tree, vendor)
+	}
+
+	if entries, err := os.ReadDir(vendor); err == nil && len(entries) != 0 {
+		if _, err := os.Stat(filepath.Join(vendor, VendorManifest)); err != nil {
+			return fmt.Errorf("%w: %s", errVendorDirNotEmpty, vendor)
+		}
+	}
+
+	if err := os.RemoveAll(vendor); err != nil {
+		return fmt.Errorf("remove vendor: %w", err)
+	}
+
+	return archive.CopyDir(tree, vendor)
+}
+
+// IsVendorManifestMissed reports whether the error is caused by the vendor archive without manifest.
+func IsVendorManifestMissed(err error) bool {
+	return errors.Is(err, errVendorManifestMissed)
+}
+
+// IsInvalidVendor reports whether the error is caused by the vendor archive which does not match its manifest
+// or has no manifest.
+func IsInvalidVendor(err error) bool {
+	return errors.Is(err, errVendorManifestMismatch) || errors.Is(err, errInvalidVendorManifest) ||
+		errors.Is(err, errVendorManifestMissed)
+}
+
+// verifyVendorFiles checks that files are exactly the files of the manifest.
+func verifyVendorFiles(files map[string][]byte) error {
+	m, err := parseVendorManifest(files)
+	if err != nil {
+		return err
+	}
+
+	expected := make(map[string]string)
+	for _, f := range m.allFiles() {
+		if _, ok := expected[f.Path]; ok {
+			return fmt.Errorf("%w: duplicated file %s", errInvalidVendorManifest, f.Path)
+		}
+		expected[f.Path] = f.SHA256
+	}
+
+	var problems []string
+	for _, p := range sortedKeys(expected) {
+		data, ok := files[p]
+		switch {
+		case !ok:
+			problems = append(problems, p+" is missed")
+		case sha256Hex(data) != expected[p]:
+			problems = append(problems, p+" is modified")
+		}
+	}
+
+	for _, p := range sortedKeys(files) {
+		if _, ok := expected[p]; !ok && p != VendorManifest {
+			problems = append(problems, p+" is not in manifest")
+		}
+	}
+
+	if len(problems) > maxReportedVendorFiles {
+		more := len(problems) - maxReportedVendorFiles
+		problems = append(problems[:maxReportedVendorFiles], fmt.Sprintf("and %d more", more))
+	}
+
+	if len(problems) != 0 {
+		return fmt.Errorf("%w: %s", errVendorManifestMismatch, strings.Join(problems, ", "))
+	}
+
+	return nil
+}
+
+func parseVendorManifest(files map[string][]byte) (vendorManifest, error) {
+	data, ok := files[VendorManifest]
+	if !ok {
+		return vendorManifest{}, errVendorManifestMissed
+	}
+
+	var m vendorManifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return vendorManifest{}, fmt.Errorf("%w: %w", errInvalidVendorManifest, err)
+	}
+
+	return m, nil
+}
+
+func (m vendorManifest) allFiles() []vendorFile {
+	files := append([]vendorFile{}, m.Files...)
+	for _, r := range m.Rocks {
+		files = append(files, r.Files...)
+	}
+	return files
+}
+
+// writeVendorManifest writes the manifest of the rocks tree into its root.
+func writeVendorManifest(tree, luaVersion string, pruned []lockedRock) error {
+	m, err := buildVendorManifest(tree, luaVersion, pruned)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal manifest: %w", err)
+	}
+
+	return os.WriteFile(filepath.Join(tree, VendorManifest), append(data, '\n'), outputFilePerm)
+}
+
+// buildVendorManifest hashes files of the rocks tree and assigns them to rocks:
+// files of the rock directory and files listed in its rock_manifest. Pruned rocks
+// are listed unless they are installed into the tree.
+func buildVendorManifest(tree, luaVersion string, pruned []lockedRock) (vendorManifest, error) {
+	hashes, err := hashTreeFiles(tree)
+	if err != nil {
+		return vendorManifest{}, err
+	}
+
+	m := vendorManifest{LuaVersion: luaVersion, Rocks: []vendorRock{}, Files: []vendorFile{}}
+
+	rocksDir := path.Join("lib", "luarocks", "rocks-"+luaVersion)
+	rocks, err := listTreeRocks(filepath.Join(tree, filepath.FromSlash(rocksDir)))
+	if err != nil {
+		return vendorManifest{}, err
+	}
+
+	owned := make(map[string]struct{})
+	for _, r := range rocks {
+		rockDir := path.Join(rocksDir, r.name, r.version)
+
+		rockFiles, err := readRockManifest(filepath.Join(tree, filepath.FromSlash(rockDir), "rock_manifest"))
+		if err != nil {
+			return vendorManifest{}, fmt.Errorf("rock=%s: %w", r.name, err)
+		}
+
+		vr := vendorRock{Name: r.name, Version: r.version, Files: []vendorFile{}}
+		for _, p := range sortedKeys(hashes) {
+			if _, ok := owned[p]; ok {
+				continue
+			}
+			if !strings.HasPrefix(p, rockDir+"/") && !rockFiles.installs(p, luaVersion) {
+				continue
+			}
+			owned[p] = struct{}{}
+			vr.Files = append(vr.Files, vendorFile{Path: p, SHA256: hashes[p]})
+		}
+		m.Rocks = append(m.Rocks, vr)
+	}
+
+	for _, p := range sortedKeys(hashes) {
+		if _, ok := owned[p]; !ok {
+			m.Files = append(m.Files, vendorFile{Path: p, SHA256: hashes[p]})
+		}
+	}
+
+	m.Pruned = vendorPrunedRocks(rocks, pruned)
+
+	return m, nil
+}
+
+// vendorPrunedRocks sorts pruned rocks by names and drops installed and duplicated ones.
+func vendorPrunedRocks(installed []installedRock, pruned []lockedRock) []lockedRock {
+	skip := make(map[string]struct{}, len(installed)+len(pruned))
+	for _, r := range installed {
+		skip[r.name] = struct{}{}
+	}
+
+	var rocks []lockedRock
+	for _, r := range pruned {
+		if _, ok := skip[r.Name]; ok {
+			continue
+		}
+		skip[r.Name] = struct{}{}
+		rocks = append(rocks, r)
+	}
+
+	sort.Slice(rocks, func(i, j int) bool { return rocks[i].Name < rocks[j].Name })
+
+	return rocks
+}
+
+// hashTreeFiles returns SHA-256 of files by slash separated paths. The vendor manifest is skipped.
+func hashTreeFiles(tree string) (map[string]string, error) {
+	hashes := make(map[string]string)
+	err := filepath.WalkDir(tree, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(tree, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if rel == VendorManifest {
+			return nil
+		}
+
+		hash, err := fileSHA256(p)
+		if err != nil {
+			return err
+		}
+		hashes[rel] = hash
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("hash tree: %w", err)
+	}
+
+	return hashes, nil
+}
+
+// listTreeRocks returns rocks of the rocks directory sorted by names.
+func listTreeRocks(rocksDir string) ([]installedRock, error) {
+	names, err := os.ReadDir(rocksDir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read rocks: %w", err)
+	}
+
+	var rocks []installedRock
+	for _, name := range names {
+		if !name.IsDir() {
+			continue
+		}
+
+		versions, err := os.ReadDir(filepath.Join(rocksDir, name.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("read rock versions: %w", err)
+		}
+
+		for _, v := range versions {
+			if v.IsDir() {
+				rocks = append(rocks, installedRock{name: name.Name(), version: v.Name()})
+			}
+		}
+	}
+
+	sort.Slice(rocks, func(i, j int) bool {
+		if rocks[i].name != rocks[j].name {
+			return rocks[i].name < rocks[j].name
+		}
+		return rocks[i].version < rocks[j].version
+	})
+
+	return rocks, nil
+}
+
+// rockManifestFiles are slash separated paths of rock_manifest by sections, e.g. "lua": "inspect.lua".
+type rockManifestFiles map[string][]string
+
+// installs reports whether the tree file is installed by the rock.
+func (f rockManifestFiles) installs(p, luaVersion string) bool {
+	for section, dir := range map[string]string{
+		"lua": path.Join("share", "lua", luaVersion),
+		"lib": path.Join("lib", "lua", luaVersion),
+		"bin": "bin",
+	} {
+		rel, ok := strings.CutPrefix(p, dir+"/")
+		if !ok {
+			continue
+		}
+		for _, file := range f[section] {
+			if file == rel {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// readRockManifest reads rock_manifest written by luarocks. It is a Lua table of sections,
+// where nested tables are directories and strings are MD5 of files.
+func readRockManifest(p string) (rockManifestFiles, error) {
+	data, err := os.ReadFile(p)
+	if errors.Is(err, os.ErrNotExist) {
+		return rockManifestFiles{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read rock manifest: %w", err)
+	}
+
+	manifest, err := analyzer.ReadTable(data, "rock_manifest")
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errInvalidRockManifest, err)
+	}
+
+	files := make(rockManifestFiles)
+	for _, section := range sortedKeys(manifest) {
+		// top level strings are files of the rock directory, e.g. the rockspec
+		if dir, ok := manifest[section].(map[string]any); ok {
+			addRockManifestFiles(files, section, "", dir)
+		}
+	}
+
+	return files, nil
+}
+
+// addRockManifestFiles adds files of the rock_manifest directory to the section.
+func addRockManifestFiles(files rockManifestFiles, section, dir string, entries map[string]any) {
+	for _, name := range sortedKeys(entries) {
+		if nested, ok := entries[name].(map[string]any); ok {
+			addRockManifestFiles(files, section, path.Join(dir, name), nested)
+			continue
+		}
+		files[section] = append(files[section], path.Join(dir, name))
+	}
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,177 @@
+package rockamalg
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/enapter/rockamalg/internal/archive"
+)
+
+func TestVendorManifest(t *testing.T) {
+	t.Parallel()
+
+	tree := t.TempDir()
+	writeTreeFile(t, tree, "share/lua/5.3/lua-string/init.lua", "return {}")
+	writeTreeFile(t, tree, "share/lua/5.3/inspect.lua", "return {}")
+	writeTreeFile(t, tree, "lib/luarocks/rocks-5.3/manifest", "manifest = {}")
+	writeTreeFile(t, tree, "lib/luarocks/rocks-5.3/lua-string/1.2.0-1/rock_manifest", `rock_manifest = {
+   doc = {
+      ["README.md"] = "4531899c522ab276618eb2ffd6e964af"
+   },
+   lua = {
+      ["lua-string"] = {
+         ["init.lua"] = "e9920ca802c3f0a56c00e837ce166653"
+      }
+   },
+   ["lua-string-1.2.0-1.rockspec"] = "6bf2731cc78a94d27239f155ce6fa227"
+}
+`)
+	writeTreeFile(t, tree, "lib/luarocks/rocks-5.3/lua-string/1.2.0-1/doc/README.md", "# lua-string")
+
+	m, err := buildVendorManifest(tree, "5.3", nil)
+	require.NoError(t, err)
+	require.Len(t, m.Rocks, 1)
+	require.Equal(t, "lua-string", m.Rocks[0].Name)
+	require.Equal(t, "1.2.0-1", m.Rocks[0].Version)
+
+	paths := func(files []vendorFile) []string {
+		var paths []string
+		for _, f := range files {
+			paths = append(paths, f.Path)
+		}
+		return paths
+	}
+	require.Equal(t, []string{
+		"lib/luarocks/rocks-5.3/lua-string/1.2.0-1/doc/README.md",
+		"lib/luarocks/rocks-5.3/lua-string/1.2.0-1/rock_manifest",
+		"share/lua/5.3/lua-string/init.lua",
+	}, paths(m.Rocks[0].Files))
+	require.Equal(t, []string{
+		"lib/luarocks/rocks-5.3/manifest",
+		"share/lua/5.3/inspect.lua",
+	}, paths(m.Files))
+
+	require.NoError(t, writeVendorManifest(tree, "5.3", nil))
+	data, err := archive.ZipDirToBytes(tree)
+	require.NoError(t, err)
+	files, err := archive.UnzipBytesToFilesMap(data)
+	require.NoError(t, err)
+	require.NoError(t, verifyVendorFiles(files))
+
+	files["share/lua/5.3/inspect.lua"] = []byte("return nil")
+	delete(files, "lib/luarocks/rocks-5.3/manifest")
+	files["share/lua/5.3/evil.lua"] = []byte("return {}")
+	err = verifyVendorFiles(files)
+	require.True(t, IsInvalidVendor(err))
+	require.EqualError(t, err, "vendor does not match its manifest: lib/luarocks/rocks-5.3/manifest is missed, "+
+		"share/lua/5.3/inspect.lua is modified, share/lua/5.3/evil.lua is not in manifest")
+
+	delete(files, VendorManifest)
+	require.True(t, IsVendorManifestMissed(verifyVendorFiles(files)))
+}
+
+func TestReadRockManifest(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	writeTreeFile(t, dir, "rock_manifest", `rock_manifest = {
+   bin = {
+      app = "f5d5f2b8ad1bd07b5b4dc8e1d7bd1b27"
+   },
+   lua = {
+      ["lua-string"] = {
+         ["init.lua"] = "e9920ca802c3f0a56c00e837ce166653",
+         util = {
+            ["str.lua"] = "4531899c522ab276618eb2ffd6e964af"
+         }
+      }
+   },
+   ["lua-string-1.2.0-1.rockspec"] = "6bf2731cc78a94d27239f155ce6fa227"
+}
+`)
+	files, err := readRockManifest(filepath.Join(dir, "rock_manifest"))
+	require.NoError(t, err)
+	require.Equal(t, rockManifestFiles{
+		"bin": {"app"},
+		"lua": {"lua-string/init.lua", "lua-string/util/str.lua"},
+	}, files)
+	require.True(t, files.installs("share/lua/5.3/lua-string/util/str.lua", "5.3"))
+	require.False(t, files.installs("share/lua/5.3/lua-string/util.lua", "5.3"))
+
+	writeTreeFile(t, dir, "rock_manifest", `rock_manifest = { lua = { x = 1 } }`)
+	_, err = readRockManifest(filepath.Join(dir, "rock_manifest"))
+	require.ErrorIs(t, err, errInvalidRockManifest)
+}
+
+func writeTreeFile(t *testing.T, tree, path, data string) {
+	t.Helper()
+
+	path = filepath.Join(tree, filepath.FromSlash(path))
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+	require.NoError(t, os.WriteFile(path, []byte(data), 0o600))
+}
+
+func TestExtractLegacyVendor(t *testing.T) {
+	t.Parallel()
+
+	tree := t.TempDir()
+	writeTreeFile(t, tree, "share/lua/5.3/inspect.lua", "return {}")
+
+	// archives of previous versions have no manifest
+	vendor := filepath.Join(t.TempDir(), "vendor.zip")
+	data, err := archive.ZipDirToBytes(tree)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(vendor, data, 0o600))
+
+	a := &amalg{p: AmalgParams{Vendor: vendor}, tree: t.TempDir()}
+	err = a.extractVendorArchive(context.Background())
+	require.True(t, IsVendorManifestMissed(err))
+	require.True(t, IsInvalidVendor(err))
+	require.NoFileExists(t, filepath.Join(a.tree, "share/lua/5.3/inspect.lua"))
+
+	a.p.AllowLegacyVendor = true
+	require.NoError(t, a.extractVendorArchive(context.Background()))
+	require.True(t, a.vendorUnverified)
+	require.FileExists(t, filepath.Join(a.tree, "share/lua/5.3/inspect.lua"))
+}
+
+func TestWriteVendor(t *testing.T) {
+	t.Parallel()
+
+	tree := t.TempDir()
+	writeTreeFile(t, tree, "share/lua/5.3/inspect.lua", "return {}")
+	writeTreeFile(t, tree, "lib/luarocks/rocks-5.3/manifest", "manifest = {}")
+
+	out := t.TempDir()
+	for _, tc := range []struct {
+		vendor string
+		format string
+	}{
+		{vendor: "vendor", format: VendorFormatDir},
+		{vendor: "vendor.zip", format: VendorFormatZip},
+		{vendor: "vendor.tar.gz", format: VendorFormatTarGz},
+	} {
+		vendor := filepath.Join(out, tc.vendor)
+		require.NoError(t, writeVendor(tree, vendor, tc.format, "5.3", nil))
+		// rewriting of the vendor replaces it
+		require.NoError(t, writeVendor(tree, vendor, tc.format, "5.3", nil))
+		require.Equal(t, tc.format, VendorFormat(vendor))
+		require.NoError(t, VerifyVendor(vendor))
+
+		dst := t.TempDir()
+		require.NoError(t, extractVendor(vendor, tc.format, dst))
+		data, err := os.ReadFile(filepath.Join(dst, "share/lua/5.3/inspect.lua"))
+		require.NoError(t, err)
+		require.Equal(t, "return {}", string(data))
+	}
+
+	notVendor := t.TempDir()
+	writeTreeFile(t, notVendor, "main.lua", "return {}")
+	err := writeVendor(tree, notVendor, VendorFormatDir, "5.3", nil)
+	require.ErrorIs(t, err, errVendorDirNotEmpty)
+	require.FileExists(t, filepath.Join(notVendor, "main.lua"))
+}
@@ -0,0 +1,260 @@
+package rockamalg
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/enapter/rockamalg/internal/rockamalg/analyzer"
+)
+
+// Amalgamation backends.
+const (
+	// BackendNative writes the result without external tools.
+	BackendNative = "native"
+	// BackendAmalgLua runs amalg.lua installed with luarocks.
+	BackendAmalgLua = "amalg.lua"
+)
+
+const outputFilePerm = 0o644
+
+// IsSupportedBackend reports whether the amalgamation backend is known.
+func IsSupportedBackend(b string) bool {
+	return b == BackendNative || b == BackendAmalgLua
+}
+
+// amalgSource is a Lua file included into the result.
+type amalgSource struct {
+	// module is empty for the main script
+	module string
+	path   string
+	// src is set for virtual modules without files
+	src []byte
+	// chunkName is shown in tracebacks in debug mode
+	chunkName string
+}
+
+// writeAmalgamation writes modules and the main script in the amalg.lua 0.8 format.
+// Modules are registered in package.preload. In debug mode sources are loaded as strings
+// with the original chunk names, so tracebacks point to the original files and lines.
+func (a *amalg) writeAmalgamation(context.Context) error {
+	sources, err := a.amalgSources()
+	if err != nil {
+		return err
+	}
+
+	mainSrc, err := os.ReadFile(filepath.Join(a.luaDir, a.luaMain))
+	if err != nil {
+		return fmt.Errorf("read lua main: %w", err)
+	}
+
+	out := &lineBuffer{}
+	shebang, mainSrc := cutShebang(mainSrc)
+	out.Write(shebang)
+	if a.buildInfo != nil {
+		out.Write(a.buildInfo.header())
+	}
+
+	if mainSrc, err = a.minify(mainSrc); err != nil {
+		return fmt.Errorf("lua main: %w", err)
+	}
+
+	sourceMap := SourceMap{Version: sourceMapVersion, File: filepath.Base(a.p.Output)}
+	for _, s := range sources {
+		src := s.src
+		if src == nil {
+			if src, err = os.ReadFile(s.path); err != nil {
+				return fmt.Errorf("module=%s, read: %w", s.module, err)
+			}
+		}
+		_, src = cutShebang(src)
+
+		if src, err = a.minify(src); err != nil {
+			return fmt.Errorf("module=%s: %w", s.module, err)
+		}
+
+		// trailing spaces are trimmed like amalg.lua does
+		trimmed := bytes.TrimRight(src, " \t\r\n\v\f")
+		if a.p.DisableDebug {
+			out.WriteString("do\nlocal _ENV = _ENV\n")
+			fmt.Fprintf(out, "package.preload[ %s ] = function( ... ) local arg = _G.arg;\n",
+				quoteLua([]byte(s.module)))
+			sourceMap.add(s.module, s.chunkName, out.Line(), trimmed)
+			out.Write(trimmed)
+			out.WriteString("\nend\nend\n\n")
+		} else {
+			sourceMap.add(s.module, s.chunkName, out.Line(), trimmed)
+			fmt.Fprintf(out, "package.preload[ %s ] = assert( (loadstring or load)( %s, '@'..%s ) )\n\n",
+				quoteLua([]byte(s.module)), quoteLua(src), quoteLua([]byte(s.chunkName)))
+		}
+	}
+
+	sourceMap.add("", a.luaMain, out.Line(), bytes.TrimRight(mainSrc, " \t\r\n\v\f"))
+	if a.p.DisableDebug {
+		out.Write(mainSrc)
+	} else {
+		fmt.Fprintf(out, "assert( (loadstring or load)( %s, '@'..%s ) )( ... )\n\n",
+			quoteLua(mainSrc), quoteLua([]byte(a.luaMain)))
+	}
+
+	if err := os.WriteFile(a.p.Output, out.Bytes(), outputFilePerm); err != nil {
+		return fmt.Errorf("write output: %w", err)
+	}
+
+	if a.p.SourceMap != "" {
+		if err := sourceMap.WriteFile(a.p.SourceMap); err != nil {
+			return fmt.Errorf("write source map: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// lineBuffer is a buffer which knows the line number of its end.
+type lineBuffer struct {
+	bytes.Buffer
+	counted int
+	lines   int
+}
+
+// Line returns the number of the line being written.
+func (b *lineBuffer) Line() int {
+	b.lines += bytes.Count(b.Bytes()[b.counted:], []byte("\n"))
+	b.counted = b.Len()
+	return b.lines + 1
+}
+
+func (a *amalg) minify(src []byte) ([]byte, error) {
+	if !a.p.Minify {
+		return src, nil
+	}
+
+	minified, err := analyzer.Minify(src, a.p.LuaVersion, analyzer.MinifyOptions{
+		RenameLocals: a.p.MinifyLocals,
+		// lines are needed for tracebacks in debug mode and for the source map
+		KeepLines: !a.p.DisableDebug || a.p.SourceMap != "",
+	})
+	if err != nil {
+		return nil, fmt.Errorf("minify: %w", err)
+	}
+
+	return minified, nil
+}
+
+// moduleNames returns modules to be included sorted and without duplicates,
+// so the result does not depend on the order modules were found in.
+func (a *amalg) moduleNames() []string {
+	names := make([]string, 0, len(a.modules))
+	seen := make(map[string]struct{}, len(a.modules))
+	for _, m := range a.modules {
+		if _, ok := seen[m]; !ok {
+			seen[m] = struct{}{}
+			names = append(names, m)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// amalgSources returns files of modules to be included sorted by module names.
+// The build info module is included if it is requested.
+func (a *amalg) amalgSources() ([]amalgSource, error) {
+	names := a.moduleNames()
+	if a.buildInfo != nil {
+		names = append(names, BuildInfoModule)
+		sort.Strings(names)
+	}
+
+	sources := make([]amalgSource, 0, len(names))
+	for _, m := range names {
+		if m == BuildInfoModule && a.buildInfo != nil {
+			sources = append(sources, amalgSource{module: m, src: a.buildInfo.module(), chunkName: m})
+			continue
+		}
+
+		path := a.modulePaths[m]
+		if path == "" {
+			return nil, fmt.Errorf("%w: %s", errModuleFileNotFound, m)
+		}
+		sources = append(sources, amalgSource{module: m, path: path, chunkName: a.chunkName(path)})
+	}
+
+	return sources, nil
+}
+
+// chunkName returns the path the same way as amalg.lua shows it after the clean up.
+func (a *amalg) chunkName(path string) string {
+	if rel, err := filepath.Rel(a.tree, path); err == nil && filepath.IsLocal(rel) {
+		return filepath.ToSlash(filepath.Join("vendor", rel))
+	}
+	if rel, err := filepath.Rel(a.luaDir, path); err == nil && filepath.IsLocal(rel) {
+		return "./" + filepath.ToSlash(rel)
+	}
+	return path
+}
+
+// addModule keeps the module with its file. The first found file wins
+// the same way as for package.path.
+func (a *amalg) addModule(module, path string) {
+	if a.modulePaths == nil {
+		a.modulePaths = make(map[string]string)
+	}
+	if _, ok := a.modulePaths[module]; !ok && path != "" {
+		a.modulePaths[module] = path
+	}
+	a.modules = append(a.modules, module)
+}
+
+// findRockModuleFile searches the module in the rocks tree like package.searchpath.
+func (a *amalg) findRockModuleFile(module string) (string, error) {
+	dir := filepath.Join(a.tree, "share", "lua", a.p.LuaVersion)
+	name := strings.ReplaceAll(module, ".", string(os.PathSeparator))
+	for _, p := range []string{name + ".lua", filepath.Join(name, "init.lua")} {
+		p = filepath.Join(dir, p)
+		if _, err := os.Stat(p); err == nil {
+			return p, nil
+		} else if !os.IsNotExist(err) {
+			return "", err
+		}
+	}
+	return "", nil
+}
+
+// cutShebang replaces the first line starting with # by an empty line to keep line numbers,
+// because load does not skip it unlike the standalone interpreter.
+func cutShebang(src []byte) (shebang, rest []byte) {
+	if !bytes.HasPrefix(src, []byte("#")) {
+		return nil, src
+	}
+
+	i := bytes.IndexByte(src, '\n')
+	if i < 0 {
+		return append(src, '\n'), nil
+	}
+	return src[:i+1], src[i:]
+}
+
+// quoteLua quotes the string the same way as string.format("%q") of Lua 5.3 does.
+func quoteLua(s []byte) []byte {
+	out := make([]byte, 0, len(s)+len(s)/8+2)
+	out = append(out, '"')
+	for i, c := range s {
+		switch {
+		case c == '"' || c == '\\' || c == '\n':
+			out = append(out, '\\', c)
+		case c < ' ' || c == 0x7f:
+			format := "\\%d"
+			if i+1 < len(s) && s[i+1] >= '0' && s[i+1] <= '9' {
+				format = "\\%03d"
+			}
+			out = fmt.Appendf(out, format, c)
+		default:
+			out = append(out, c)
+		}
+	}
+	return append(out, '"')
+}
@@ -0,0 +1,173 @@
+package rockamalg
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/enapter/rockamalg/internal/rockamalg/analyzer"
+)
+
+func TestQuoteLua(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		in       string
+		expected string
+	}{
+		{in: `say("hi")`, expected: `"say(\"hi\")"`},
+		{in: "a\\b\nc", expected: "\"a\\\\b\\\nc\""},
+		{in: "\tx\r\n", expected: "\"\\9x\\13\\\n\""},
+		{in: "\x001", expected: `"\0001"`},
+		{in: "\x7f", expected: `"\127"`},
+	}
+
+	for _, tc := range tests {
+		require.Equal(t, tc.expected, string(quoteLua([]byte(tc.in))))
+	}
+}
+
+// TestWriteAmalgamation checks the output is the same as amalg.lua writes.
+func TestWriteAmalgamation(t *testing.T) {
+	t.Parallel()
+
+	const testdata = "../../tests/integration/testdata/amalg/multi_files_with_deps"
+
+	for _, golden := range []string{"out.lua", "nodebug.out.lua"} {
+		t.Run(golden, func(t *testing.T) {
+			t.Parallel()
+
+			a := &amalg{
+				p: AmalgParams{
+					Output:       filepath.Join(t.TempDir(), "out.lua"),
+					DisableDebug: golden == "nodebug.out.lua",
+					LuaVersion:   DefaultLuaVersion,
+				},
+				luaDir:   filepath.Join(testdata, "fw_dir"),
+				luaMain:  "main.lua",
+				tree:     filepath.Join(testdata, "vendor"),
+				analyzer: analyzer.New(),
+			}
+
+			var err error
+			a.searchPath, err = ParseSearchPath(DefaultSearchPath)
+			require.NoError(t, err)
+			require.NoError(t, a.analyzeRequires(context.Background()))
+			require.NoError(t, a.writeAmalgamation(context.Background()))
+
+			expected, err := os.ReadFile(filepath.Join(testdata, golden))
+			require.NoError(t, err)
+			actual, err := os.ReadFile(a.p.Output)
+			require.NoError(t, err)
+			require.Equal(t, string(expected), string(actual))
+
+			require.NoError(t, a.hashOutputs())
+			require.Equal(t, fmt.Sprintf("%x", sha256.Sum256(expected)), a.outputSHA256)
+		})
+	}
+}
+
+func TestSourceMap(t *testing.T) {
+	t.Parallel()
+
+	const testdata = "../../tests/integration/testdata/amalg/multi_files_no_deps"
+
+	dir := t.TempDir()
+	a := &amalg{
+		p: AmalgParams{
+			Output:       filepath.Join(dir, "out.lua"),
+			SourceMap:    filepath.Join(dir, "out.lua.map"),
+			DisableDebug: true,
+			LuaVersion:   DefaultLuaVersion,
+		},
+		luaDir:   filepath.Join(testdata, "fw_dir"),
+		luaMain:  "main.lua",
+		tree:     filepath.Join(dir, "tree"),
+		analyzer: analyzer.New(),
+	}
+
+	var err error
+	a.searchPath, err = ParseSearchPath(DefaultSearchPath)
+	require.NoError(t, err)
+	require.NoError(t, a.analyzeRequires(context.Background()))
+	require.NoError(t, a.writeAmalgamation(context.Background()))
+
+	m, err := ReadSourceMap(a.p.SourceMap)
+	require.NoError(t, err)
+
+	trace := "lua: out.lua:9: boom\n" +
+		"stack traceback:\n" +
+		"\t[C]: in function 'error'\n" +
+		"\t[string \"out.lua\"]:87: in function <out.lua:84>\n" +
+		"\tother.lua:9: in main chunk\n"
+
+	var out bytes.Buffer
+	require.NoError(t, m.TranslateTrace(strings.NewReader(trace), &out, ""))
+	require.Equal(t, "lua: ./goodbye.lua:6: boom\n"+
+		"stack traceback:\n"+
+		"\t[C]: in function 'error'\n"+
+		"\tmain.lua:12: in function <main.lua:9>\n"+
+		"\tother.lua:9: in main chunk\n", out.String())
+}
+
+func TestBuildInfo(t *testing.T) {
+	t.Parallel()
+
+	const testdata = "../../tests/integration/testdata/amalg/multi_files_no_deps"
+
+	dir := t.TempDir()
+	a := &amalg{
+		p: AmalgParams{
+			Output:       filepath.Join(dir, "out.lua"),
+			LuaVersion:   DefaultLuaVersion,
+			DisableDebug: true,
+			Minify:       true,
+		},
+		luaDir:   filepath.Join(testdata, "fw_dir"),
+		luaMain:  "main.lua",
+		tree:     filepath.Join(dir, "tree"),
+		analyzer: analyzer.New(),
+		buildInfo: &buildInfo{
+			rockamalg:  "v1.2.0",
+			time:       "2024-01-02T03:04:05Z",
+			version:    "1.0.0",
+			luaVersion: DefaultLuaVersion,
+			modules:    []string{"goodbye", "hello"},
+			rocks:      []installedRock{{name: "inspect", version: "3.1.3-0"}},
+		},
+	}
+
+	var err error
+	a.searchPath, err = ParseSearchPath(DefaultSearchPath)
+	require.NoError(t, err)
+	require.NoError(t, a.analyzeRequires(context.Background()))
+	// the build info module is minified too, so it is checked to be valid Lua
+	require.NoError(t, a.writeAmalgamation(context.Background()))
+
+	actual, err := os.ReadFile(a.p.Output)
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(string(actual),
+		"-- Amalgamated by rockamalg v1.2.0 at 2024-01-02T03:04:05Z for Lua 5.3\n"+
+			"-- Version: 1.0.0\n"+
+			"-- Modules: goodbye, hello\n"+
+			"-- Rocks: inspect 3.1.3-0\n"+
+			"do\n"), string(actual))
+	require.Contains(t, string(actual), `package.preload[ "rockamalg.buildinfo" ]`)
+	require.Contains(t, string(actual), `rocks={["inspect"]="3.1.3-0",}`)
+}
+
+func TestBuildTime(t *testing.T) {
+	t.Setenv("SOURCE_DATE_EPOCH", "1700000000")
+
+	bt, err := buildTime()
+	require.NoError(t, err)
+	require.Equal(t, "2023-11-14T22:13:20Z", bt.Format(time.RFC3339))
+}
@@ -0,0 +1,56 @@
+package rockamalgcli
+
+import (
+	"time"
+
+	"github.com/urfave/cli/v2"
+)
+
+const (
+	defaultCacheMaxSize = 1024
+	defaultCacheTTL     = 7 * 24 * time.Hour
+	bytesInMegabyte     = 1 << 20
+)
+
+// cacheFlags configure the cache of installed rocks trees shared by commands.
+type cacheFlags struct {
+	dir     string
+	maxSize int64
+	ttl     time.Duration
+}
+
+func (f *cacheFlags) flags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:        "cache-dir",
+			Usage:       "Cache installed dependencies in the directory",
+			EnvVars:     []string{"ROCKAMALG_CACHE_DIR"},
+			Destination: &f.dir,
+		},
+		&cli.Int64Flag{
+			Name:        "cache-max-size",
+			Usage:       "Maximum size of the cache in megabytes, 0 means no limit",
+			EnvVars:     []string{"ROCKAMALG_CACHE_MAX_SIZE"},
+			Value:       defaultCacheMaxSize,
+			Destination: &f.maxSize,
+		},
+		&cli.DurationFlag{
+			Name:        "cache-ttl",
+			Usage:       "Evict dependencies unused for the duration from the cache, 0 means no limit",
+			EnvVars:     []string{"ROCKAMALG_CACHE_TTL"},
+			Value:       defaultCacheTTL,
+			Destination: &f.ttl,
+		},
+	}
+}
+
+func (f *cacheFlags) validate() error {
+	if f.maxSize < 0 || f.ttl < 0 {
+		return errNegativeCacheLimit
+	}
+	return nil
+}
+
+func (f *cacheFlags) maxSizeBytes() int64 {
+	return f.maxSize * bytesInMegabyte
+}
@@ -9,7 +9,13 @@ func NewApp() *cli.App {
 
 	app.Commands = []*cli.Command{
 		buildCmdAmalg(),
+		buildCmdBatch(),
+		buildCmdGraph(),
+		buildCmdOutdated(),
 		buildCmdServer(),
+		buildCmdTrace(),
+		buildCmdUpdate(),
+		buildCmdVendor(),
 	}
 
 	return app
@@ -1,6 +1,7 @@
 package rockamalgcli
 
 import (
+	"fmt"
 	"path/filepath"
 
 	"github.com/urfave/cli/v2"
@@ -9,15 +10,34 @@ import (
 )
 
 type cmdAmalg struct {
-	deps         string
-	rockspec     string
-	output       string
-	vendor       string
-	lua          string
-	isolate      bool
-	disableDebug bool
-	allowDevDeps bool
-	rocksServer  string
+	deps               string
+	rockspec           string
+	output             string
+	vendor             string
+	prune              bool
+	allowLegacyVendor  bool
+	lua                string
+	isolate            bool
+	disableDebug       bool
+	allowDevDeps       bool
+	strict             bool
+	allowUnresolved    cli.StringSlice
+	allowNativeModules bool
+	rocksServer        string
+	luaVersion         string
+	searchPath         string
+	backend            string
+	minify             bool
+	minifyLocals       bool
+	bytecode           bool
+	bytecodeOutput     string
+	sourceMap          string
+	lockFile           string
+	locked             bool
+	offline            bool
+	buildInfo          bool
+	buildVersion       string
+	cache              cacheFlags
 }
 
 //nolint:funlen // large number of flags
@@ -35,7 +55,7 @@ The dependencies file should be in the Luarocks format.
 
 See the tutorial https://developers.enapter.com/docs/tutorial/lua-complex/introduction to learn more.
 `,
-		Flags: []cli.Flag{
+		Flags: append([]cli.Flag{
 			&cli.StringFlag{
 				Name:        "deps",
 				Aliases:     []string{"d"},
@@ -58,9 +78,19 @@ See the tutorial https://developers.enapter.com/docs/tutorial/lua-complex/introd
 			&cli.StringFlag{
 				Name:        "vendor",
 				Aliases:     []string{"v"},
-				Usage:       "Vendor zip archive file name",
+				Usage:       "Vendor zip archive, directory or tar.gz archive, only zip is updated",
 				Destination: &cmd.vendor,
 			},
+			&cli.BoolFlag{
+				Name:        "prune",
+				Usage:       "Keep only rocks which modules are included into the result in the vendor zip archive",
+				Destination: &cmd.prune,
+			},
+			&cli.BoolFlag{
+				Name:        "allow-legacy-vendor",
+				Usage:       "Extract vendor archives without manifest built by previous versions with a warning",
+				Destination: &cmd.allowLegacyVendor,
+			},
 			&cli.BoolFlag{
 				Name:        "isolate",
 				Aliases:     []string{"i"},
@@ -77,13 +107,96 @@ See the tutorial https://developers.enapter.com/docs/tutorial/lua-complex/introd
 				Usage:       "Allow to use dev dependencies",
 				Destination: &cmd.allowDevDeps,
 			},
+			&cli.BoolFlag{
+				Name:        "strict",
+				Usage:       "Fail if required modules are not found",
+				Destination: &cmd.strict,
+			},
+			&cli.StringSliceFlag{
+				Name:        "allow-unresolved",
+				Usage:       "Allow module to be not found in strict mode, e.g. enapter.* for the whole namespace",
+				Destination: &cmd.allowUnresolved,
+			},
+			&cli.BoolFlag{
+				Name:        "allow-native-modules",
+				Usage:       "Warn about native (C) modules of rocks instead of failing, they are not included",
+				Destination: &cmd.allowNativeModules,
+			},
 			&cli.StringFlag{
 				Name:        "rocks-server",
 				Aliases:     []string{"s"},
 				Usage:       "Use custom rocks server",
 				Destination: &cmd.rocksServer,
 			},
-		},
+			&cli.StringFlag{
+				Name:        "lua-version",
+				Usage:       "Target Lua version: 5.1, 5.2, 5.3 or 5.4",
+				Value:       rockamalg.DefaultLuaVersion,
+				Destination: &cmd.luaVersion,
+			},
+			&cli.StringFlag{
+				Name:        "search-path",
+				Usage:       "Templates to search modules in the Lua directory, e.g. src/?.lua;src/?/init.lua",
+				DefaultText: rockamalg.DefaultSearchPath,
+				Destination: &cmd.searchPath,
+			},
+			&cli.StringFlag{
+				Name:        "backend",
+				Usage:       "Amalgamation backend: native or amalg.lua",
+				Value:       rockamalg.BackendNative,
+				Destination: &cmd.backend,
+			},
+			&cli.BoolFlag{
+				Name:        "minify",
+				Usage:       "Strip comments and redundant whitespace, line numbers are kept unless debug is disabled",
+				Destination: &cmd.minify,
+			},
+			&cli.BoolFlag{
+				Name:        "minify-locals",
+				Usage:       "Minify and rename local variables",
+				Destination: &cmd.minifyLocals,
+			},
+			&cli.BoolFlag{
+				Name:        "bytecode",
+				Usage:       "Write the result compiled to stripped Lua bytecode instead of the source",
+				Destination: &cmd.bytecode,
+			},
+			&cli.StringFlag{
+				Name:        "bytecode-output",
+				Usage:       "Also write the result compiled to stripped Lua bytecode to the file",
+				Destination: &cmd.bytecodeOutput,
+			},
+			&cli.StringFlag{
+				Name:        "source-map",
+				Usage:       "Write JSON source map of the result to the file, see trace command",
+				Destination: &cmd.sourceMap,
+			},
+			&cli.StringFlag{
+				Name:        "lockfile",
+				Usage:       "Record exact versions of installed rocks to the file",
+				Destination: &cmd.lockFile,
+			},
+			&cli.BoolFlag{
+				Name:        "locked",
+				Usage:       "Install rocks of the lockfile and fail if dependencies require other rocks",
+				Destination: &cmd.locked,
+			},
+			&cli.BoolFlag{
+				Name:        "offline",
+				Usage:       "Build from the vendor without installing rocks, fail if it misses dependencies",
+				Destination: &cmd.offline,
+			},
+			&cli.BoolFlag{
+				Name:        "build-info",
+				Usage:       "Add build info header and " + rockamalg.BuildInfoModule + " module to the result",
+				Destination: &cmd.buildInfo,
+			},
+			&cli.StringFlag{
+				Name:        "build-version",
+				Usage:       "Version of the result shown in the build info, enables build info",
+				Destination: &cmd.buildVersion,
+			},
+		}, cmd.cache.flags()...),
 		Before: func(cliCtx *cli.Context) error {
 			if filepath.IsAbs(cmd.output) {
 				return errOutputIsAbsolutePath
@@ -91,22 +204,72 @@ See the tutorial https://developers.enapter.com/docs/tutorial/lua-complex/introd
 
 			cmd.lua = cliCtx.Args().First()
 
+			if cmd.searchPath != "" {
+				if _, err := rockamalg.ParseSearchPath(cmd.searchPath); err != nil {
+					return err
+				}
+			}
+
+			if !rockamalg.IsSupportedLuaVersion(cmd.luaVersion) {
+				return fmt.Errorf("%w: %s", errUnsupportedLuaVersion, cmd.luaVersion)
+			}
+
+			if !rockamalg.IsSupportedBackend(cmd.backend) {
+				return fmt.Errorf("%w: %s", errUnsupportedBackend, cmd.backend)
+			}
+
+			if cmd.bytecode && cmd.bytecodeOutput != "" {
+				return errBytecodeFlagsSimultaneously
+			}
+
+			if cmd.bytecode {
+				cmd.bytecodeOutput = cmd.output
+			}
+
+			if err := cmd.cache.validate(); err != nil {
+				return err
+			}
+
 			return nil
 		},
 		Action: func(cliCtx *cli.Context) error {
-			return rockamalg.New(rockamalg.Params{RocksServer: cmd.rocksServer}).
+			_, err := rockamalg.New(rockamalg.Params{
+				Version:      cliCtx.App.Version,
+				RocksServer:  cmd.rocksServer,
+				LuaVersion:   cmd.luaVersion,
+				CacheDir:     cmd.cache.dir,
+				CacheMaxSize: cmd.cache.maxSizeBytes(),
+				CacheTTL:     cmd.cache.ttl,
+			}).
 				Amalg(cliCtx.Context,
 					rockamalg.AmalgParams{
-						Dependencies: cmd.deps,
-						Rockspec:     cmd.rockspec,
-						Lua:          cmd.lua,
-						Output:       cmd.output,
-						Vendor:       cmd.vendor,
-						Writer:       cliCtx.App.Writer,
-						Isolate:      cmd.isolate,
-						DisableDebug: cmd.disableDebug,
-						AllowDevDeps: cmd.allowDevDeps,
+						Dependencies:       cmd.deps,
+						Rockspec:           cmd.rockspec,
+						Lua:                cmd.lua,
+						Output:             cmd.output,
+						Vendor:             cmd.vendor,
+						PruneVendor:        cmd.prune,
+						AllowLegacyVendor:  cmd.allowLegacyVendor,
+						Writer:             cliCtx.App.Writer,
+						Isolate:            cmd.isolate,
+						DisableDebug:       cmd.disableDebug,
+						AllowDevDeps:       cmd.allowDevDeps,
+						Strict:             cmd.strict,
+						AllowUnresolved:    cmd.allowUnresolved.Value(),
+						AllowNativeModules: cmd.allowNativeModules,
+						SearchPath:         cmd.searchPath,
+						Backend:            cmd.backend,
+						Minify:             cmd.minify,
+						MinifyLocals:       cmd.minifyLocals,
+						BytecodeOutput:     cmd.bytecodeOutput,
+						SourceMap:          cmd.sourceMap,
+						LockFile:           cmd.lockFile,
+						Locked:             cmd.locked,
+						Offline:            cmd.offline,
+						BuildInfo:          cmd.buildInfo,
+						BuildVersion:       cmd.buildVersion,
 					})
+			return err
 		},
 	}
 }
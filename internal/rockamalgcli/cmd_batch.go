@@ -0,0 +1,316 @@
+package rockamalgcli
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/enapter/rockamalg/internal/rockamalg"
+)
+
+type cmdBatch struct {
+	deps               string
+	rockspec           string
+	outputDir          string
+	manifest           string
+	isolate            bool
+	disableDebug       bool
+	allowDevDeps       bool
+	strict             bool
+	allowNativeModules bool
+	rocksServer        string
+	luaVersion         string
+	backend            string
+	minify             bool
+	locked             bool
+	offline            bool
+	allowLegacyVendor  bool
+	cache              cacheFlags
+}
+
+// batchManifest lists targets of the batch. Paths are relative to the manifest directory.
+type batchManifest struct {
+	Targets []batchTarget `json:"targets"`
+}
+
+// batchTarget overrides flags of the batch command for the target.
+type batchTarget struct {
+	Lua          string `json:"lua"`
+	Output       string `json:"output"`
+	Deps         string `json:"deps"`
+	Rockspec     string `json:"rockspec"`
+	Vendor       string `json:"vendor"`
+	Prune        bool   `json:"prune"`
+	LockFile     string `json:"lockfile"`
+	SearchPath   string `json:"search_path"`
+	BuildVersion string `json:"build_version"`
+}
+
+//nolint:funlen // large number of flags
+func buildCmdBatch() *cli.Command {
+	var cmd cmdBatch
+
+	return &cli.Command{
+		Name:      "batch",
+		Usage:     "Amalgamates several Lua files or directories in one run.",
+		ArgsUsage: "[lua...]",
+		Description: `
+Every lua is amalgamated into the output directory with the same name, e.g. blueprints/ucm
+is written to the output directory as ucm.lua. Targets could be listed in the manifest too:
+
+{"targets": [{"lua": "ucm", "output": "out/ucm.lua", "deps": "ucm/deps"}]}
+
+Paths of the manifest are relative to its directory. Flags are used for fields
+missed in the manifest. Dependencies are installed once for targets with the same
+dependencies, vendor archive and lockfile.
+`,
+		Flags: append([]cli.Flag{
+			&cli.StringFlag{
+				Name:        "deps",
+				Aliases:     []string{"d"},
+				Usage:       "Use dependencies file",
+				Destination: &cmd.deps,
+			},
+			&cli.StringFlag{
+				Name:        "rockspec",
+				Aliases:     []string{"r"},
+				Usage:       "Use rockspec file for dependencies",
+				Destination: &cmd.rockspec,
+			},
+			&cli.StringFlag{
+				Name:        "output-dir",
+				Aliases:     []string{"o"},
+				Usage:       "Output directory for targets without output",
+				Destination: &cmd.outputDir,
+			},
+			&cli.StringFlag{
+				Name:        "manifest",
+				Aliases:     []string{"m"},
+				Usage:       "JSON manifest of targets",
+				Destination: &cmd.manifest,
+			},
+			&cli.BoolFlag{
+				Name:        "isolate",
+				Aliases:     []string{"i"},
+				Usage:       "Enable isolate mode",
+				Destination: &cmd.isolate,
+			},
+			&cli.BoolFlag{
+				Name:        "disable-debug",
+				Usage:       "Disable debug mode",
+				Destination: &cmd.disableDebug,
+			},
+			&cli.BoolFlag{
+				Name:        "allow-dev-dependencies",
+				Usage:       "Allow to use dev dependencies",
+				Destination: &cmd.allowDevDeps,
+			},
+			&cli.BoolFlag{
+				Name:        "strict",
+				Usage:       "Fail if required modules are not found",
+				Destination: &cmd.strict,
+			},
+			&cli.BoolFlag{
+				Name:        "allow-native-modules",
+				Usage:       "Warn about native (C) modules of rocks instead of failing, they are not included",
+				Destination: &cmd.allowNativeModules,
+			},
+			&cli.StringFlag{
+				Name:        "rocks-server",
+				Aliases:     []string{"s"},
+				Usage:       "Use custom rocks server",
+				Destination: &cmd.rocksServer,
+			},
+			&cli.StringFlag{
+				Name:        "lua-version",
+				Usage:       "Target Lua version: 5.1, 5.2, 5.3 or 5.4",
+				Value:       rockamalg.DefaultLuaVersion,
+				Destination: &cmd.luaVersion,
+			},
+			&cli.StringFlag{
+				Name:        "backend",
+				Usage:       "Amalgamation backend: native or amalg.lua",
+				Value:       rockamalg.BackendNative,
+				Destination: &cmd.backend,
+			},
+			&cli.BoolFlag{
+				Name:        "minify",
+				Usage:       "Strip comments and redundant whitespace, line numbers are kept unless debug is disabled",
+				Destination: &cmd.minify,
+			},
+			&cli.BoolFlag{
+				Name:        "locked",
+				Usage:       "Install rocks of the lockfile and fail if dependencies require other rocks",
+				Destination: &cmd.locked,
+			},
+			&cli.BoolFlag{
+				Name:        "offline",
+				Usage:       "Build from the vendor without installing rocks, fail if it misses dependencies",
+				Destination: &cmd.offline,
+			},
+			&cli.BoolFlag{
+				Name:        "allow-legacy-vendor",
+				Usage:       "Extract vendor archives without manifest built by previous versions with a warning",
+				Destination: &cmd.allowLegacyVendor,
+			},
+		}, cmd.cache.flags()...),
+		Before: func(*cli.Context) error {
+			if filepath.IsAbs(cmd.outputDir) {
+				return errOutputIsAbsolutePath
+			}
+
+			if !rockamalg.IsSupportedLuaVersion(cmd.luaVersion) {
+				return fmt.Errorf("%w: %s", errUnsupportedLuaVersion, cmd.luaVersion)
+			}
+
+			if !rockamalg.IsSupportedBackend(cmd.backend) {
+				return fmt.Errorf("%w: %s", errUnsupportedBackend, cmd.backend)
+			}
+
+			if err := cmd.cache.validate(); err != nil {
+				return err
+			}
+
+			return nil
+		},
+		Action: func(cliCtx *cli.Context) error {
+			targets, err := cmd.targets(cliCtx.Args().Slice())
+			if err != nil {
+				return err
+			}
+
+			results := rockamalg.New(rockamalg.Params{
+				Version:      cliCtx.App.Version,
+				RocksServer:  cmd.rocksServer,
+				LuaVersion:   cmd.luaVersion,
+				CacheDir:     cmd.cache.dir,
+				CacheMaxSize: cmd.cache.maxSizeBytes(),
+				CacheTTL:     cmd.cache.ttl,
+			}).AmalgBatch(cliCtx.Context, rockamalg.BatchParams{Targets: targets, Writer: cliCtx.App.Writer})
+
+			var failed []string
+			for i, res := range results {
+				if res.Err != nil {
+					failed = append(failed, targets[i].Lua)
+				}
+			}
+
+			if len(failed) != 0 {
+				return fmt.Errorf("%w: %d of %d: %s", errBatchTargetsFailed,
+					len(failed), len(targets), strings.Join(failed, ", "))
+			}
+
+			return nil
+		},
+	}
+}
+
+// targets returns targets of the manifest followed by targets of the arguments.
+func (c *cmdBatch) targets(args []string) ([]rockamalg.AmalgParams, error) {
+	var targets []batchTarget
+	var manifestDir string
+	if c.manifest != "" {
+		data, err := os.ReadFile(c.manifest)
+		if err != nil {
+			return nil, fmt.Errorf("read manifest: %w", err)
+		}
+
+		var m batchManifest
+		if err := json.Unmarshal(data, &m); err != nil {
+			return nil, fmt.Errorf("parse manifest: %w", err)
+		}
+
+		targets = m.Targets
+		manifestDir = filepath.Dir(c.manifest)
+	}
+
+	for _, lua := range args {
+		targets = append(targets, batchTarget{Lua: lua})
+	}
+
+	if len(targets) == 0 {
+		return nil, errBatchTargetsMissed
+	}
+
+	outputs := make(map[string]string, len(targets))
+	params := make([]rockamalg.AmalgParams, 0, len(targets))
+	for i, t := range targets {
+		// only manifest targets are relative to the manifest directory
+		dir := ""
+		if i < len(targets)-len(args) {
+			dir = manifestDir
+		}
+
+		p, err := c.targetParams(t, dir)
+		if err != nil {
+			return nil, err
+		}
+
+		if prev, ok := outputs[p.Output]; ok {
+			return nil, fmt.Errorf("%w: %s and %s", errBatchOutputConflict, prev, p.Lua)
+		}
+		outputs[p.Output] = p.Lua
+
+		params = append(params, p)
+	}
+
+	return params, nil
+}
+
+func (c *cmdBatch) targetParams(t batchTarget, dir string) (rockamalg.AmalgParams, error) {
+	if t.Lua == "" {
+		return rockamalg.AmalgParams{}, errBatchLuaMissed
+	}
+
+	output := t.Output
+	if output == "" {
+		name := strings.TrimSuffix(filepath.Base(t.Lua), filepath.Ext(t.Lua))
+		output = filepath.Join(c.outputDir, name+".lua")
+	} else {
+		output = inDir(dir, output)
+	}
+
+	if filepath.IsAbs(output) {
+		return rockamalg.AmalgParams{}, errOutputIsAbsolutePath
+	}
+
+	p := rockamalg.AmalgParams{
+		Dependencies:       c.deps,
+		Rockspec:           c.rockspec,
+		Lua:                inDir(dir, t.Lua),
+		Output:             output,
+		Vendor:             inDir(dir, t.Vendor),
+		PruneVendor:        t.Prune,
+		LockFile:           inDir(dir, t.LockFile),
+		SearchPath:         t.SearchPath,
+		BuildVersion:       t.BuildVersion,
+		Isolate:            c.isolate,
+		DisableDebug:       c.disableDebug,
+		AllowDevDeps:       c.allowDevDeps,
+		Strict:             c.strict,
+		AllowNativeModules: c.allowNativeModules,
+		Backend:            c.backend,
+		Minify:             c.minify,
+		Locked:             c.locked,
+		Offline:            c.offline,
+		AllowLegacyVendor:  c.allowLegacyVendor,
+	}
+
+	if t.Deps != "" || t.Rockspec != "" {
+		p.Dependencies, p.Rockspec = inDir(dir, t.Deps), inDir(dir, t.Rockspec)
+	}
+
+	return p, nil
+}
+
+// inDir joins the relative path with the directory. Empty paths stay empty.
+func inDir(dir, path string) string {
+	if path == "" || dir == "" || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(dir, path)
+}
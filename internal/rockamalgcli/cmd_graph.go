@@ -0,0 +1,170 @@
+package rockamalgcli
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/enapter/rockamalg/internal/rockamalg"
+)
+
+type cmdGraph struct {
+	deps              string
+	rockspec          string
+	output            string
+	vendor            string
+	lua               string
+	allowLegacyVendor bool
+	format            string
+	allowDevDeps      bool
+	rocksServer       string
+	luaVersion        string
+	searchPath        string
+	cache             cacheFlags
+}
+
+//nolint:funlen // large number of flags
+func buildCmdGraph() *cli.Command {
+	var cmd cmdGraph
+
+	return &cli.Command{
+		Name:      "graph",
+		Usage:     "Exports the graph of requires between Lua modules.",
+		ArgsUsage: "lua",
+		Description: `
+The lua should be a single Lua file or directory with main.lua and other Lua files.
+
+Modules are marked as local, rock (with the rock name and version) or unresolved.
+Optional requires (protected with pcall) are marked as well.
+`,
+		Flags: append([]cli.Flag{
+			&cli.StringFlag{
+				Name:        "deps",
+				Aliases:     []string{"d"},
+				Usage:       "Use dependencies file",
+				Destination: &cmd.deps,
+			},
+			&cli.StringFlag{
+				Name:        "rockspec",
+				Aliases:     []string{"r"},
+				Usage:       "Use rockspec file for dependencies",
+				Destination: &cmd.rockspec,
+			},
+			&cli.StringFlag{
+				Name:        "output",
+				Aliases:     []string{"o"},
+				Usage:       "Output file name, standard output is used by default",
+				Destination: &cmd.output,
+			},
+			&cli.StringFlag{
+				Name:        "vendor",
+				Aliases:     []string{"v"},
+				Usage:       "Vendor zip archive, directory or tar.gz archive",
+				Destination: &cmd.vendor,
+			},
+			&cli.BoolFlag{
+				Name:        "allow-legacy-vendor",
+				Usage:       "Extract vendor archives without manifest built by previous versions with a warning",
+				Destination: &cmd.allowLegacyVendor,
+			},
+			&cli.StringFlag{
+				Name:        "format",
+				Aliases:     []string{"f"},
+				Usage:       "Output format: dot or json",
+				Value:       "dot",
+				Destination: &cmd.format,
+			},
+			&cli.BoolFlag{
+				Name:        "allow-dev-dependencies",
+				Usage:       "Allow to use dev dependencies",
+				Destination: &cmd.allowDevDeps,
+			},
+			&cli.StringFlag{
+				Name:        "rocks-server",
+				Aliases:     []string{"s"},
+				Usage:       "Use custom rocks server",
+				Destination: &cmd.rocksServer,
+			},
+			&cli.StringFlag{
+				Name:        "lua-version",
+				Usage:       "Target Lua version: 5.1, 5.2, 5.3 or 5.4",
+				Value:       rockamalg.DefaultLuaVersion,
+				Destination: &cmd.luaVersion,
+			},
+			&cli.StringFlag{
+				Name:        "search-path",
+				Usage:       "Templates to search modules in the Lua directory, e.g. src/?.lua;src/?/init.lua",
+				DefaultText: rockamalg.DefaultSearchPath,
+				Destination: &cmd.searchPath,
+			},
+		}, cmd.cache.flags()...),
+		Before: func(cliCtx *cli.Context) error {
+			if cmd.format != "dot" && cmd.format != "json" {
+				return fmt.Errorf("%w: %s", errUnsupportedGraphFormat, cmd.format)
+			}
+
+			if !rockamalg.IsSupportedLuaVersion(cmd.luaVersion) {
+				return fmt.Errorf("%w: %s", errUnsupportedLuaVersion, cmd.luaVersion)
+			}
+
+			cmd.lua = cliCtx.Args().First()
+
+			if cmd.searchPath != "" {
+				if _, err := rockamalg.ParseSearchPath(cmd.searchPath); err != nil {
+					return err
+				}
+			}
+
+			if err := cmd.cache.validate(); err != nil {
+				return err
+			}
+
+			return nil
+		},
+		Action: func(cliCtx *cli.Context) error {
+			g, err := rockamalg.New(rockamalg.Params{
+				RocksServer:  cmd.rocksServer,
+				LuaVersion:   cmd.luaVersion,
+				CacheDir:     cmd.cache.dir,
+				CacheMaxSize: cmd.cache.maxSizeBytes(),
+				CacheTTL:     cmd.cache.ttl,
+			}).
+				Graph(cliCtx.Context,
+					rockamalg.GraphParams{
+						Dependencies:      cmd.deps,
+						Rockspec:          cmd.rockspec,
+						Lua:               cmd.lua,
+						Vendor:            cmd.vendor,
+						AllowLegacyVendor: cmd.allowLegacyVendor,
+						AllowDevDeps:      cmd.allowDevDeps,
+						SearchPath:        cmd.searchPath,
+						// progress goes to stderr to keep the graph clean on stdout
+						Writer: cliCtx.App.ErrWriter,
+					})
+			if err != nil {
+				return err
+			}
+
+			return cmd.writeGraph(cliCtx.App.Writer, g)
+		},
+	}
+}
+
+func (c *cmdGraph) writeGraph(stdout io.Writer, g rockamalg.Graph) error {
+	w := stdout
+	if c.output != "" {
+		f, err := os.Create(c.output)
+		if err != nil {
+			return fmt.Errorf("create output: %w", err)
+		}
+		defer f.Close()
+		w = f
+	}
+
+	if c.format == "json" {
+		return g.WriteJSON(w)
+	}
+	return g.WriteDOT(w)
+}
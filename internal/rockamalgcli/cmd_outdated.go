@@ -0,0 +1,103 @@
+package rockamalgcli
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/enapter/rockamalg/internal/rockamalg"
+)
+
+type cmdOutdated struct {
+	deps        string
+	rockspec    string
+	lockFile    string
+	rocksServer string
+	luaVersion  string
+}
+
+func buildCmdOutdated() *cli.Command {
+	var cmd cmdOutdated
+
+	return &cli.Command{
+		Name:  "outdated",
+		Usage: "Lists rocks which have newer versions on the rocks server.",
+		Description: `
+Current versions are taken from the lockfile. Wanted is the newest version satisfying
+constraints of the dependencies file or rockspec, rocks missed in them have no constraints.
+Latest is the newest version on the rocks server.
+`,
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:        "deps",
+				Aliases:     []string{"d"},
+				Usage:       "Use dependencies file",
+				Destination: &cmd.deps,
+			},
+			&cli.StringFlag{
+				Name:        "rockspec",
+				Aliases:     []string{"r"},
+				Usage:       "Use rockspec file for dependencies",
+				Destination: &cmd.rockspec,
+			},
+			&cli.StringFlag{
+				Name:        "lockfile",
+				Usage:       "Use lockfile for current versions",
+				Destination: &cmd.lockFile,
+			},
+			&cli.StringFlag{
+				Name:        "rocks-server",
+				Aliases:     []string{"s"},
+				Usage:       "Use custom rocks server",
+				Destination: &cmd.rocksServer,
+			},
+			&cli.StringFlag{
+				Name:        "lua-version",
+				Usage:       "Target Lua version: 5.1, 5.2, 5.3 or 5.4",
+				Value:       rockamalg.DefaultLuaVersion,
+				Destination: &cmd.luaVersion,
+			},
+		},
+		Before: func(*cli.Context) error {
+			if !rockamalg.IsSupportedLuaVersion(cmd.luaVersion) {
+				return fmt.Errorf("%w: %s", errUnsupportedLuaVersion, cmd.luaVersion)
+			}
+
+			return nil
+		},
+		Action: func(cliCtx *cli.Context) error {
+			outdated, err := rockamalg.New(rockamalg.Params{RocksServer: cmd.rocksServer, LuaVersion: cmd.luaVersion}).
+				Outdated(cliCtx.Context,
+					rockamalg.OutdatedParams{
+						Dependencies: cmd.deps,
+						Rockspec:     cmd.rockspec,
+						LockFile:     cmd.lockFile,
+						// progress goes to stderr to keep the list clean on stdout
+						Writer: cliCtx.App.ErrWriter,
+					})
+			if err != nil {
+				return err
+			}
+
+			return writeOutdated(cliCtx.App.Writer, outdated)
+		},
+	}
+}
+
+func writeOutdated(w io.Writer, outdated []rockamalg.OutdatedRock) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ROCK\tCURRENT\tWANTED\tLATEST")
+	for _, o := range outdated {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", o.Rock, orDash(o.Current), orDash(o.Wanted), o.Latest)
+	}
+	return tw.Flush()
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -16,6 +16,9 @@ type cmdServer struct {
 	listenAddress string
 	retryTimeout  time.Duration
 	rocksServer   string
+	luaVersion    string
+	maxConcurrent int
+	cache         cacheFlags
 }
 
 func buildCmdServer() *cli.Command {
@@ -24,7 +27,7 @@ func buildCmdServer() *cli.Command {
 	return &cli.Command{
 		Name:  "server",
 		Usage: "Run gRPC server to amalgamate files by request.",
-		Flags: []cli.Flag{
+		Flags: append([]cli.Flag{
 			&cli.StringFlag{
 				Name:        "listen-address",
 				Aliases:     []string{"l"},
@@ -47,6 +50,32 @@ func buildCmdServer() *cli.Command {
 				Usage:       "Use custom rocks server",
 				Destination: &cmd.rocksServer,
 			},
+			&cli.StringFlag{
+				Name:        "lua-version",
+				Usage:       "Default target Lua version: 5.1, 5.2, 5.3 or 5.4",
+				EnvVars:     []string{"LUA_VERSION"},
+				Value:       rockamalg.DefaultLuaVersion,
+				Destination: &cmd.luaVersion,
+			},
+			&cli.IntFlag{
+				Name:        "max-concurrent-requests",
+				Usage:       "Maximum number of requests processed at the same time",
+				DefaultText: "number of CPUs",
+				EnvVars:     []string{"MAX_CONCURRENT_REQUESTS"},
+				Destination: &cmd.maxConcurrent,
+			},
+		}, cmd.cache.flags()...),
+		Before: func(*cli.Context) error {
+			if !rockamalg.IsSupportedLuaVersion(cmd.luaVersion) {
+				return fmt.Errorf("%w: %s", errUnsupportedLuaVersion, cmd.luaVersion)
+			}
+			if cmd.maxConcurrent < 0 {
+				return fmt.Errorf("%w: %d", errInvalidMaxConcurrentRequests, cmd.maxConcurrent)
+			}
+			if err := cmd.cache.validate(); err != nil {
+				return err
+			}
+			return nil
 		},
 		Action: func(cliCtx *cli.Context) error {
 			gsrv := grpcserver.New(grpcserver.Params{
@@ -66,7 +95,17 @@ func buildCmdServer() *cli.Command {
 
 			fmt.Fprintf(cliCtx.App.Writer, "gRPC server starting at %s\n", cmd.listenAddress)
 
-			srv := server.New(rockamalg.Params{RocksServer: cmd.rocksServer})
+			srv := server.New(server.Params{
+				Rockamalg: rockamalg.Params{
+					Version:      cliCtx.App.Version,
+					RocksServer:  cmd.rocksServer,
+					LuaVersion:   cmd.luaVersion,
+					CacheDir:     cmd.cache.dir,
+					CacheMaxSize: cmd.cache.maxSizeBytes(),
+					CacheTTL:     cmd.cache.ttl,
+				},
+				MaxConcurrentRequests: cmd.maxConcurrent,
+			})
 			rockamalgrpc.RegisterRockamalgServer(gsrv, srv)
 			gsrv.Run(cliCtx.Context)
 
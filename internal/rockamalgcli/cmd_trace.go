@@ -0,0 +1,69 @@
+package rockamalgcli
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/enapter/rockamalg/internal/rockamalg"
+)
+
+type cmdTrace struct {
+	sourceMap string
+	chunkName string
+	traceback string
+}
+
+func buildCmdTrace() *cli.Command {
+	var cmd cmdTrace
+
+	return &cli.Command{
+		Name:      "trace",
+		Usage:     "Rewrites Lua traceback to point at the original files.",
+		ArgsUsage: "[traceback]",
+		Description: `
+The traceback is read from the file or from the standard input.
+Locations of the amalgamated file are replaced with locations of the original files
+according to the source map written by amalg command.
+`,
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:        "source-map",
+				Aliases:     []string{"m"},
+				Usage:       "Source map of the amalgamated file",
+				Required:    true,
+				Destination: &cmd.sourceMap,
+			},
+			&cli.StringFlag{
+				Name:        "chunk-name",
+				Usage:       "Chunk name of the amalgamated file in the traceback",
+				DefaultText: "file name from the source map",
+				Destination: &cmd.chunkName,
+			},
+		},
+		Before: func(cliCtx *cli.Context) error {
+			cmd.traceback = cliCtx.Args().First()
+			return nil
+		},
+		Action: func(cliCtx *cli.Context) error {
+			m, err := rockamalg.ReadSourceMap(cmd.sourceMap)
+			if err != nil {
+				return fmt.Errorf("read source map: %w", err)
+			}
+
+			var r io.Reader = cliCtx.App.Reader
+			if cmd.traceback != "" {
+				f, err := os.Open(cmd.traceback)
+				if err != nil {
+					return fmt.Errorf("open traceback: %w", err)
+				}
+				defer f.Close()
+				r = f
+			}
+
+			return m.TranslateTrace(r, cliCtx.App.Writer, cmd.chunkName)
+		},
+	}
+}
@@ -0,0 +1,88 @@
+package rockamalgcli
+
+import (
+	"fmt"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/enapter/rockamalg/internal/rockamalg"
+)
+
+type cmdUpdate struct {
+	deps         string
+	rockspec     string
+	lockFile     string
+	allowDevDeps bool
+	rocksServer  string
+	luaVersion   string
+}
+
+func buildCmdUpdate() *cli.Command {
+	var cmd cmdUpdate
+
+	return &cli.Command{
+		Name:      "update",
+		Usage:     "Updates rocks and rewrites the lockfile.",
+		ArgsUsage: "[rock...]",
+		Description: `
+The rocks are updated to the newest versions satisfying the dependencies file or rockspec,
+other rocks keep their locked versions. All rocks are updated if no rock is set.
+`,
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:        "deps",
+				Aliases:     []string{"d"},
+				Usage:       "Use dependencies file",
+				Destination: &cmd.deps,
+			},
+			&cli.StringFlag{
+				Name:        "rockspec",
+				Aliases:     []string{"r"},
+				Usage:       "Use rockspec file for dependencies",
+				Destination: &cmd.rockspec,
+			},
+			&cli.StringFlag{
+				Name:        "lockfile",
+				Usage:       "Lockfile to rewrite",
+				Required:    true,
+				Destination: &cmd.lockFile,
+			},
+			&cli.BoolFlag{
+				Name:        "allow-dev-dependencies",
+				Usage:       "Allow to use dev dependencies",
+				Destination: &cmd.allowDevDeps,
+			},
+			&cli.StringFlag{
+				Name:        "rocks-server",
+				Aliases:     []string{"s"},
+				Usage:       "Use custom rocks server",
+				Destination: &cmd.rocksServer,
+			},
+			&cli.StringFlag{
+				Name:        "lua-version",
+				Usage:       "Target Lua version: 5.1, 5.2, 5.3 or 5.4",
+				Value:       rockamalg.DefaultLuaVersion,
+				Destination: &cmd.luaVersion,
+			},
+		},
+		Before: func(*cli.Context) error {
+			if !rockamalg.IsSupportedLuaVersion(cmd.luaVersion) {
+				return fmt.Errorf("%w: %s", errUnsupportedLuaVersion, cmd.luaVersion)
+			}
+
+			return nil
+		},
+		Action: func(cliCtx *cli.Context) error {
+			return rockamalg.New(rockamalg.Params{RocksServer: cmd.rocksServer, LuaVersion: cmd.luaVersion}).
+				Update(cliCtx.Context,
+					rockamalg.UpdateParams{
+						Dependencies: cmd.deps,
+						Rockspec:     cmd.rockspec,
+						LockFile:     cmd.lockFile,
+						Rocks:        cliCtx.Args().Slice(),
+						AllowDevDeps: cmd.allowDevDeps,
+						Writer:       cliCtx.App.Writer,
+					})
+		},
+	}
+}
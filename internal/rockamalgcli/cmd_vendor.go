@@ -0,0 +1,151 @@
+package rockamalgcli
+
+import (
+	"fmt"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/enapter/rockamalg/internal/rockamalg"
+)
+
+type cmdVendor struct {
+	deps         string
+	rockspec     string
+	output       string
+	format       string
+	lockFile     string
+	locked       bool
+	allowDevDeps bool
+	rocksServer  string
+	luaVersion   string
+	cache        cacheFlags
+}
+
+//nolint:funlen // large number of flags
+func buildCmdVendor() *cli.Command {
+	var cmd cmdVendor
+
+	return &cli.Command{
+		Name:  "vendor",
+		Usage: "Installs dependencies into a vendor directory or archive.",
+		Description: `
+The vendor is written with ` + rockamalg.VendorManifest + ` and could be committed alongside the dependencies.
+Use it with amalg --vendor flag to build without the rocks server. The format is detected
+by the output: .zip and .tar.gz are archives, other paths are directories.
+`,
+		Subcommands: []*cli.Command{
+			buildCmdVendorVerify(),
+		},
+		Flags: append([]cli.Flag{
+			&cli.StringFlag{
+				Name:        "deps",
+				Aliases:     []string{"d"},
+				Usage:       "Use dependencies file",
+				Destination: &cmd.deps,
+			},
+			&cli.StringFlag{
+				Name:        "rockspec",
+				Aliases:     []string{"r"},
+				Usage:       "Use rockspec file for dependencies",
+				Destination: &cmd.rockspec,
+			},
+			&cli.StringFlag{
+				Name:        "output",
+				Aliases:     []string{"o"},
+				Usage:       "Output vendor directory or archive",
+				Required:    true,
+				Destination: &cmd.output,
+			},
+			&cli.StringFlag{
+				Name:        "format",
+				Usage:       "Vendor format: dir, zip or tar.gz",
+				DefaultText: "detected by the output",
+				Destination: &cmd.format,
+			},
+			&cli.StringFlag{
+				Name:        "lockfile",
+				Usage:       "Record exact versions of installed rocks to the file",
+				Destination: &cmd.lockFile,
+			},
+			&cli.BoolFlag{
+				Name:        "locked",
+				Usage:       "Install rocks of the lockfile and fail if dependencies require other rocks",
+				Destination: &cmd.locked,
+			},
+			&cli.BoolFlag{
+				Name:        "allow-dev-dependencies",
+				Usage:       "Allow to use dev dependencies",
+				Destination: &cmd.allowDevDeps,
+			},
+			&cli.StringFlag{
+				Name:        "rocks-server",
+				Aliases:     []string{"s"},
+				Usage:       "Use custom rocks server",
+				Destination: &cmd.rocksServer,
+			},
+			&cli.StringFlag{
+				Name:        "lua-version",
+				Usage:       "Target Lua version: 5.1, 5.2, 5.3 or 5.4",
+				Value:       rockamalg.DefaultLuaVersion,
+				Destination: &cmd.luaVersion,
+			},
+		}, cmd.cache.flags()...),
+		Before: func(*cli.Context) error {
+			if !rockamalg.IsSupportedLuaVersion(cmd.luaVersion) {
+				return fmt.Errorf("%w: %s", errUnsupportedLuaVersion, cmd.luaVersion)
+			}
+
+			if cmd.format != "" && !rockamalg.IsSupportedVendorFormat(cmd.format) {
+				return fmt.Errorf("%w: %s", errUnsupportedVendorFormat, cmd.format)
+			}
+
+			return cmd.cache.validate()
+		},
+		Action: func(cliCtx *cli.Context) error {
+			return rockamalg.New(rockamalg.Params{
+				RocksServer:  cmd.rocksServer,
+				LuaVersion:   cmd.luaVersion,
+				CacheDir:     cmd.cache.dir,
+				CacheMaxSize: cmd.cache.maxSizeBytes(),
+				CacheTTL:     cmd.cache.ttl,
+			}).Vendor(cliCtx.Context, rockamalg.VendorParams{
+				Dependencies: cmd.deps,
+				Rockspec:     cmd.rockspec,
+				Output:       cmd.output,
+				Format:       cmd.format,
+				LockFile:     cmd.lockFile,
+				Locked:       cmd.locked,
+				AllowDevDeps: cmd.allowDevDeps,
+				LuaVersion:   cmd.luaVersion,
+				Writer:       cliCtx.App.Writer,
+			})
+		},
+	}
+}
+
+func buildCmdVendorVerify() *cli.Command {
+	return &cli.Command{
+		Name:      "verify",
+		Usage:     "Verify files of vendors against their manifests.",
+		ArgsUsage: "vendor...",
+		Description: `
+Every file of the vendor archive should be listed in ` + rockamalg.VendorManifest + ` with the same
+SHA-256 and every listed file should be in the archive. Vendor directories and tar.gz
+archives are verified the same way. Vendors without manifest fail.
+`,
+		Action: func(cliCtx *cli.Context) error {
+			if cliCtx.NArg() == 0 {
+				return errVendorMissed
+			}
+
+			for _, vendor := range cliCtx.Args().Slice() {
+				if err := rockamalg.VerifyVendor(vendor); err != nil {
+					return fmt.Errorf("%s: %w", vendor, err)
+				}
+				fmt.Fprintf(cliCtx.App.Writer, "%s: OK\n", vendor)
+			}
+
+			return nil
+		},
+	}
+}
@@ -2,4 +2,18 @@ package rockamalgcli
 
 import "errors"
 
-var errOutputIsAbsolutePath = errors.New("output file name should not be absolute")
+var (
+	errOutputIsAbsolutePath         = errors.New("output file name should not be absolute")
+	errUnsupportedLuaVersion        = errors.New("unsupported lua version")
+	errUnsupportedGraphFormat       = errors.New("unsupported graph format")
+	errUnsupportedBackend           = errors.New("unsupported amalgamation backend")
+	errBytecodeFlagsSimultaneously  = errors.New("bytecode and bytecode output are not allowed simultaneously")
+	errBatchTargetsMissed           = errors.New("no batch targets, pass lua or manifest")
+	errBatchLuaMissed               = errors.New("batch target lua is missed")
+	errBatchOutputConflict          = errors.New("batch targets have the same output")
+	errBatchTargetsFailed           = errors.New("batch targets failed")
+	errInvalidMaxConcurrentRequests = errors.New("max concurrent requests should not be negative")
+	errNegativeCacheLimit           = errors.New("cache limits should not be negative")
+	errVendorMissed                 = errors.New("vendor is missed")
+	errUnsupportedVendorFormat      = errors.New("unsupported vendor format")
+)
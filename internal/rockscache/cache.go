@@ -0,0 +1,317 @@
+package rockscache
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"syscall"
+	"time"
+)
+
+const (
+	entryFilePerm = 0o444
+	entryExecPerm = 0o555
+	treeFilePerm  = 0o644
+	treeExecPerm  = 0o755
+	dirPerm       = 0o755
+)
+
+var errInvalidKey = errors.New("invalid cache key")
+
+// Cache stores installed rocks trees by keys. Entries are shared by processes using
+// the same directory: readers hold the shared lock while restoring an entry, writers
+// and eviction hold the exclusive one. Restored trees are copies, since luarocks rewrites
+// files of trees in place and read-only files of entries do not stop root.
+type Cache struct {
+	dir     string
+	maxSize int64
+	ttl     time.Duration
+	now     func() time.Time
+}
+
+type Params struct {
+	Dir string
+	// MaxSize is the total size of entries in bytes. Least recently used entries
+	// are evicted above it. Zero means no limit.
+	MaxSize int64
+	// TTL is the time since the last use after which an entry is evicted. Zero means no limit.
+	TTL time.Duration
+}
+
+func New(p Params) (*Cache, error) {
+	for _, dir := range []string{p.Dir, filepath.Join(p.Dir, "trees"), filepath.Join(p.Dir, "tmp")} {
+		if err := os.MkdirAll(dir, dirPerm); err != nil {
+			return nil, fmt.Errorf("create cache directory: %w", err)
+		}
+	}
+
+	return &Cache{
+		dir:     p.Dir,
+		maxSize: p.MaxSize,
+		ttl:     p.TTL,
+		now:     time.Now,
+	}, nil
+}
+
+// Restore fills dst with a writable copy of the tree of the key. Files are never shared with
+// the entry, so the tree could be modified. It reports false if the key is not cached.
+func (c *Cache) Restore(key, dst string) (bool, error) {
+	entry, err := c.entryPath(key)
+	if err != nil {
+		return false, err
+	}
+
+	unlock, err := c.lock(syscall.LOCK_SH)
+	if err != nil {
+		return false, err
+	}
+	defer unlock()
+
+	if _, err := os.Stat(entry); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return false, nil
+		}
+		return false, fmt.Errorf("stat entry: %w", err)
+	}
+
+	if err := restoreTree(entry, dst); err != nil {
+		return false, fmt.Errorf("restore entry: %w", err)
+	}
+
+	now := c.now()
+	if err := os.Chtimes(entry, now, now); err != nil {
+		return false, fmt.Errorf("touch entry: %w", err)
+	}
+
+	return true, nil
+}
+
+// Store copies the src tree as the entry of the key and evicts stale entries.
+// An existing entry of the key is kept.
+func (c *Cache) Store(key, src string) error {
+	entry, err := c.entryPath(key)
+	if err != nil {
+		return err
+	}
+
+	// the copy is made without the lock, only the rename into place needs it
+	tmp, err := os.MkdirTemp(filepath.Join(c.dir, "tmp"), key+"_")
+	if err != nil {
+		return fmt.Errorf("mkdir temp: %w", err)
+	}
+	defer os.RemoveAll(tmp)
+
+	tree := filepath.Join(tmp, "tree")
+	if err := copyTree(src, tree); err != nil {
+		return fmt.Errorf("copy tree: %w", err)
+	}
+
+	unlock, err := c.lock(syscall.LOCK_EX)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if _, err := os.Stat(entry); errors.Is(err, os.ErrNotExist) {
+		if err := os.Rename(tree, entry); err != nil {
+			return fmt.Errorf("rename entry: %w", err)
+		}
+		now := c.now()
+		if err := os.Chtimes(entry, now, now); err != nil {
+			return fmt.Errorf("touch entry: %w", err)
+		}
+	}
+
+	return c.evict()
+}
+
+// Evict removes entries unused for TTL and then the least recently used entries above MaxSize.
+func (c *Cache) Evict() error {
+	unlock, err := c.lock(syscall.LOCK_EX)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	return c.evict()
+}
+
+type cacheEntry struct {
+	path string
+	used time.Time
+	size int64
+}
+
+func (c *Cache) evict() error {
+	dirs, err := os.ReadDir(filepath.Join(c.dir, "trees"))
+	if err != nil {
+		return fmt.Errorf("read entries: %w", err)
+	}
+
+	entries := make([]cacheEntry, 0, len(dirs))
+	var total int64
+	for _, d := range dirs {
+		e := cacheEntry{path: filepath.Join(c.dir, "trees", d.Name())}
+
+		info, err := d.Info()
+		if err != nil {
+			return fmt.Errorf("stat entry: %w", err)
+		}
+		e.used = info.ModTime()
+
+		if c.ttl != 0 && c.now().Sub(e.used) > c.ttl {
+			if err := os.RemoveAll(e.path); err != nil {
+				return fmt.Errorf("remove entry: %w", err)
+			}
+			continue
+		}
+
+		if e.size, err = treeSize(e.path); err != nil {
+			return fmt.Errorf("entry size: %w", err)
+		}
+
+		total += e.size
+		entries = append(entries, e)
+	}
+
+	if c.maxSize == 0 {
+		return nil
+	}
+
+	slices.SortFunc(entries, func(a, b cacheEntry) int { return a.used.Compare(b.used) })
+	for _, e := range entries {
+		if total <= c.maxSize {
+			break
+		}
+		if err := os.RemoveAll(e.path); err != nil {
+			return fmt.Errorf("remove entry: %w", err)
+		}
+		total -= e.size
+	}
+
+	return nil
+}
+
+func (c *Cache) entryPath(key string) (string, error) {
+	if key == "" || key != filepath.Base(key) || key[0] == '.' {
+		return "", fmt.Errorf("%w: %q", errInvalidKey, key)
+	}
+	return filepath.Join(c.dir, "trees", key), nil
+}
+
+// lock takes the lock of the cache directory. The lock is released by the returned function.
+func (c *Cache) lock(how int) (func(), error) {
+	f, err := os.OpenFile(filepath.Join(c.dir, "lock"), os.O_CREATE|os.O_RDWR, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("open lock: %w", err)
+	}
+
+	if err := syscall.Flock(int(f.Fd()), how); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("lock: %w", err)
+	}
+
+	return func() {
+		_ = syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+		f.Close()
+	}, nil
+}
+
+// restoreTree copies files of the entry into dst and makes them writable.
+func restoreTree(entry, dst string) error {
+	return walkTree(entry, dst, func(srcPath, dstPath string, info fs.FileInfo) error {
+		return copyFile(srcPath, dstPath, filePerm(info, treeFilePerm, treeExecPerm))
+	})
+}
+
+// copyTree copies files of src into dst and makes them read-only.
+func copyTree(src, dst string) error {
+	return walkTree(src, dst, func(srcPath, dstPath string, info fs.FileInfo) error {
+		return copyFile(srcPath, dstPath, filePerm(info, entryFilePerm, entryExecPerm))
+	})
+}
+
+// filePerm keeps only the executable bit of the file.
+func filePerm(info fs.FileInfo, perm, execPerm os.FileMode) os.FileMode {
+	if info.Mode().Perm()&0o111 != 0 {
+		return execPerm
+	}
+	return perm
+}
+
+// walkTree creates directories of src in dst and calls fn for regular files. Symlinks are kept as is.
+func walkTree(src, dst string, fn func(srcPath, dstPath string, info fs.FileInfo) error) error {
+	return filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case d.IsDir():
+			return os.MkdirAll(target, dirPerm)
+		case info.Mode()&fs.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		case info.Mode().IsRegular():
+			return fn(path, target, info)
+		default:
+			return nil
+		}
+	})
+}
+
+func copyFile(src, dst string, perm os.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_EXCL|os.O_WRONLY, perm)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+
+	return out.Close()
+}
+
+func treeSize(path string) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(path, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type().IsRegular() {
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, err
+}
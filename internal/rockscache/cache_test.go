@@ -0,0 +1,120 @@
+package rockscache
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStoreRestore(t *testing.T) {
+	t.Parallel()
+
+	c, err := New(Params{Dir: t.TempDir()})
+	require.NoError(t, err)
+
+	src := t.TempDir()
+	writeFile(t, filepath.Join(src, "share/lua/5.3/inspect.lua"), "return {}")
+	require.NoError(t, os.Symlink("inspect.lua", filepath.Join(src, "share/lua/5.3/link.lua")))
+
+	ok, err := c.Restore("key", t.TempDir())
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	require.NoError(t, c.Store("key", src))
+	// the second store of the same key keeps the entry
+	require.NoError(t, c.Store("key", src))
+
+	dst := t.TempDir()
+	ok, err = c.Restore("key", dst)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	data, err := os.ReadFile(filepath.Join(dst, "share/lua/5.3/inspect.lua"))
+	require.NoError(t, err)
+	require.Equal(t, "return {}", string(data))
+
+	link, err := os.Readlink(filepath.Join(dst, "share/lua/5.3/link.lua"))
+	require.NoError(t, err)
+	require.Equal(t, "inspect.lua", link)
+
+	info, err := os.Stat(filepath.Join(dst, "share/lua/5.3/inspect.lua"))
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(treeFilePerm), info.Mode().Perm())
+
+	// restored files are copies, so writes do not reach the entry
+	writeFile(t, filepath.Join(dst, "share/lua/5.3/inspect.lua"), "return nil")
+
+	other := t.TempDir()
+	ok, err = c.Restore("key", other)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	data, err = os.ReadFile(filepath.Join(other, "share/lua/5.3/inspect.lua"))
+	require.NoError(t, err)
+	require.Equal(t, "return {}", string(data))
+
+	require.NoError(t, os.RemoveAll(dst))
+}
+
+func TestInvalidKey(t *testing.T) {
+	t.Parallel()
+
+	c, err := New(Params{Dir: t.TempDir()})
+	require.NoError(t, err)
+
+	for _, key := range []string{"", "../key", "a/b", ".key"} {
+		_, err := c.Restore(key, t.TempDir())
+		require.ErrorIs(t, err, errInvalidKey)
+	}
+}
+
+func TestEvict(t *testing.T) {
+	t.Parallel()
+
+	c, err := New(Params{Dir: t.TempDir(), MaxSize: 20, TTL: time.Hour})
+	require.NoError(t, err)
+
+	now := time.Now()
+	c.now = func() time.Time { return now }
+
+	src := t.TempDir()
+	writeFile(t, filepath.Join(src, "file"), strings.Repeat("x", 10))
+
+	require.NoError(t, c.Store("stale", src))
+
+	now = now.Add(2 * time.Hour)
+	require.NoError(t, c.Store("old", src))
+	require.False(t, cached(t, c, "stale"))
+
+	now = now.Add(time.Minute)
+	require.NoError(t, c.Store("new", src))
+
+	now = now.Add(time.Minute)
+	require.True(t, cached(t, c, "old"))
+
+	// old is used more recently than new, so new is evicted
+	now = now.Add(time.Minute)
+	require.NoError(t, c.Store("newest", src))
+	require.True(t, cached(t, c, "old"))
+	require.False(t, cached(t, c, "new"))
+	require.True(t, cached(t, c, "newest"))
+}
+
+func cached(t *testing.T, c *Cache, key string) bool {
+	t.Helper()
+
+	ok, err := c.Restore(key, t.TempDir())
+	require.NoError(t, err)
+	return ok
+}
+
+func writeFile(t *testing.T, path, data string) {
+	t.Helper()
+
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+	require.NoError(t, os.WriteFile(path, []byte(data), 0o600))
+}
@@ -8,6 +8,8 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"runtime"
+	"strconv"
 	"strings"
 
 	"google.golang.org/grpc/codes"
@@ -23,13 +25,45 @@ const newFilePerm = 0o600
 
 type Server struct {
 	rockamalgrpc.UnimplementedRockamalgServer
-	amalg *rockamalg.Rockamalg
+	amalg      *rockamalg.Rockamalg
+	luaVersion string
+	slots      chan struct{}
 }
 
-func New(rockamalgParams rockamalg.Params) *Server {
-	amalg := rockamalg.New(rockamalgParams)
+type Params struct {
+	Rockamalg rockamalg.Params
+	// MaxConcurrentRequests limits amalgamations and graphs running at the same time,
+	// other requests wait for a free slot. Default is the number of CPUs.
+	MaxConcurrentRequests int
+}
+
+func New(p Params) *Server {
+	amalg := rockamalg.New(p.Rockamalg)
+
+	luaVersion := p.Rockamalg.LuaVersion
+	if luaVersion == "" {
+		luaVersion = rockamalg.DefaultLuaVersion
+	}
+
+	maxConcurrentRequests := p.MaxConcurrentRequests
+	if maxConcurrentRequests <= 0 {
+		maxConcurrentRequests = runtime.NumCPU()
+	}
+
 	return &Server{
-		amalg: amalg,
+		amalg:      amalg,
+		luaVersion: luaVersion,
+		slots:      make(chan struct{}, maxConcurrentRequests),
+	}
+}
+
+// acquireSlot waits for a free slot of the concurrency limit. The returned function releases the slot.
+func (s *Server) acquireSlot(ctx context.Context) (func(), error) {
+	select {
+	case s.slots <- struct{}{}:
+		return func() { <-s.slots }, nil
+	case <-ctx.Done():
+		return nil, status.FromContextError(ctx.Err()).Err()
 	}
 }
 
@@ -44,6 +78,12 @@ func (s *Server) Amalg(
 		return nil, errSt.Err()
 	}
 
+	release, err := s.acquireSlot(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
 	amalgDir, err := os.MkdirTemp("/tmp", "amalg")
 	if err != nil {
 		return nil, status.Errorf(codes.Internal, "create temporary directory: %v", err)
@@ -55,26 +95,302 @@ func (s *Server) Amalg(
 		return nil, errSt.Err()
 	}
 
-	if err := s.amalg.Amalg(ctx, amalgParams); err != nil {
-		return nil, status.Errorf(codes.Internal, "amalgamation: %v", err)
+	res, err := s.amalg.Amalg(ctx, amalgParams)
+	if err != nil {
+		return nil, amalgError(err)
+	}
+
+	resp, errSt := amalgResponse(req, amalgParams, res)
+	if errSt != nil {
+		return nil, errSt.Err()
+	}
+
+	return resp, nil
+}
+
+func (s *Server) AmalgBatch(
+	ctx context.Context, req *rockamalgrpc.AmalgBatchRequest,
+) (*rockamalgrpc.AmalgBatchResponse, error) {
+	if len(req.GetTargets()) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "targets are missed")
+	}
+
+	// targets are amalgamated one by one, so the batch takes a single slot
+	release, err := s.acquireSlot(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	batchDir, err := os.MkdirTemp("/tmp", "amalg_batch")
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "create temporary directory: %v", err)
+	}
+	defer func() { os.RemoveAll(batchDir) }()
+
+	results := make([]*rockamalgrpc.AmalgBatchResult, len(req.GetTargets()))
+
+	// targets failed before the amalgamation are not passed to the batch
+	var targets []rockamalg.AmalgParams
+	var indexes []int
+	for i, target := range req.GetTargets() {
+		if errSt := s.validateAmalgRequest(target); errSt != nil {
+			results[i] = batchErrorResult(errSt)
+			continue
+		}
+
+		amalgDir := filepath.Join(batchDir, strconv.Itoa(i))
+		if err := os.Mkdir(amalgDir, os.ModePerm); err != nil {
+			return nil, status.Errorf(codes.Internal, "create temporary directory: %v", err)
+		}
+
+		amalgParams, errSt := s.prepareAmalgParams(ctx, target, amalgDir)
+		if errSt != nil {
+			results[i] = batchErrorResult(errSt)
+			continue
+		}
+
+		targets = append(targets, amalgParams)
+		indexes = append(indexes, i)
+	}
+
+	for j, res := range s.amalg.AmalgBatch(ctx, rockamalg.BatchParams{Targets: targets}) {
+		i := indexes[j]
+		if res.Err != nil {
+			results[i] = batchErrorResult(status.Convert(amalgError(res.Err)))
+			continue
+		}
+
+		resp, errSt := amalgResponse(req.GetTargets()[i], targets[j], res.AmalgResult)
+		if errSt != nil {
+			results[i] = batchErrorResult(errSt)
+			continue
+		}
+
+		results[i] = &rockamalgrpc.AmalgBatchResult{Response: resp}
+	}
+
+	return &rockamalgrpc.AmalgBatchResponse{Results: results}, nil
+}
+
+func batchErrorResult(st *status.Status) *rockamalgrpc.AmalgBatchResult {
+	return &rockamalgrpc.AmalgBatchResult{
+		ErrorCode: uint32(st.Code()),
+		Error:     st.Message(),
 	}
+}
 
+func (s *Server) validateAmalgRequest(req *rockamalgrpc.AmalgRequest) *status.Status {
+	if errSt := s.validateLuaSourceRequest(req); errSt != nil {
+		return errSt
+	}
+
+	if b := req.GetBackend(); b != "" && !rockamalg.IsSupportedBackend(b) {
+		return status.Newf(codes.InvalidArgument, "unsupported amalgamation backend: %s", b)
+	}
+
+	if b := req.GetBackend(); b != "" && b != rockamalg.BackendNative {
+		if req.GetMinify() || req.GetMinifyLocals() {
+			return status.New(codes.InvalidArgument, "minification is supported by native backend only")
+		}
+		if req.GetSourceMap() {
+			return status.New(codes.InvalidArgument, "source map is supported by native backend only")
+		}
+		if req.GetBuildInfo() || req.GetBuildVersion() != "" {
+			return status.New(codes.InvalidArgument, "build info is supported by native backend only")
+		}
+	}
+
+	if req.GetLocked() && len(req.GetLockfile()) == 0 {
+		return status.New(codes.InvalidArgument, "lockfile is required in locked mode")
+	}
+
+	return nil
+}
+
+// amalgResponse reads files written by the amalgamation.
+func amalgResponse(
+	req *rockamalgrpc.AmalgRequest, amalgParams rockamalg.AmalgParams, res rockamalg.AmalgResult,
+) (*rockamalgrpc.AmalgResponse, *status.Status) {
 	out, err := os.ReadFile(amalgParams.Output)
 	if err != nil {
-		return nil, status.Errorf(codes.Internal, "reading result output: %v", err)
+		return nil, status.Newf(codes.Internal, "reading result output: %v", err)
+	}
+
+	var bytecode []byte
+	if amalgParams.BytecodeOutput != "" {
+		if bytecode, err = os.ReadFile(amalgParams.BytecodeOutput); err != nil {
+			return nil, status.Newf(codes.Internal, "reading result bytecode: %v", err)
+		}
+	}
+
+	var sourceMap []byte
+	if amalgParams.SourceMap != "" {
+		if sourceMap, err = os.ReadFile(amalgParams.SourceMap); err != nil {
+			return nil, status.Newf(codes.Internal, "reading result source map: %v", err)
+		}
+	}
+
+	lockFile, err := os.ReadFile(amalgParams.LockFile)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, status.Newf(codes.Internal, "reading result lockfile: %v", err)
+	}
+
+	luaSHA256 := res.OutputSHA256
+	if req.GetBytecode() == rockamalgrpc.BytecodeMode_BYTECODE_MODE_ONLY {
+		out, luaSHA256 = nil, ""
 	}
 
 	vendor, err := os.ReadFile(amalgParams.Vendor)
 	if err != nil {
 		if !errors.Is(err, os.ErrNotExist) {
-			return nil, status.Errorf(codes.Internal, "reading result vendor: %v", err)
+			return nil, status.Newf(codes.Internal, "reading result vendor: %v", err)
 		}
 	}
 
-	return &rockamalgrpc.AmalgResponse{Lua: out, Vendor: vendor}, nil
+	dynamicRequires := make([]string, 0, len(res.DynamicRequires))
+	for _, r := range res.DynamicRequires {
+		dynamicRequires = append(dynamicRequires, r.String())
+	}
+
+	return &rockamalgrpc.AmalgResponse{
+		Lua:             out,
+		Vendor:          vendor,
+		DynamicRequires: dynamicRequires,
+		NativeModules:   nativeModulesToRPC(res.NativeModules),
+		Bytecode:        bytecode,
+		SourceMap:       sourceMap,
+		LuaSha256:       luaSHA256,
+		BytecodeSha256:  res.BytecodeSHA256,
+		Lockfile:        lockFile,
+		PrunedRocks:     prunedRocksToRPC(res.PrunedRocks),
+	}, nil
 }
 
-func (s *Server) validateAmalgRequest(req *rockamalgrpc.AmalgRequest) *status.Status {
+// amalgError converts amalgamation error to status. Native modules error
+// has its own code and carries the modules in details.
+func amalgError(err error) error {
+	if rockamalg.IsLockFileDrift(err) || rockamalg.IsVendorUnsatisfied(err) {
+		return status.Errorf(codes.FailedPrecondition, "amalgamation: %v", err)
+	}
+
+	if rockamalg.IsInvalidVendor(err) {
+		return status.Errorf(codes.InvalidArgument, "amalgamation: %v", err)
+	}
+
+	var nativeErr *rockamalg.NativeModulesError
+	if !errors.As(err, &nativeErr) {
+		return status.Errorf(codes.Internal, "amalgamation: %v", err)
+	}
+
+	st := status.Newf(codes.FailedPrecondition, "amalgamation: %v", err)
+	if withDetails, detailsErr := st.WithDetails(&rockamalgrpc.NativeModulesError{
+		Modules: nativeModulesToRPC(nativeErr.Modules),
+	}); detailsErr == nil {
+		st = withDetails
+	}
+
+	return st.Err()
+}
+
+func prunedRocksToRPC(rocks []rockamalg.PrunedRock) []*rockamalgrpc.PrunedRock {
+	rpcRocks := make([]*rockamalgrpc.PrunedRock, 0, len(rocks))
+	for _, r := range rocks {
+		rpcRocks = append(rpcRocks, &rockamalgrpc.PrunedRock{Rock: r.Rock, Version: r.Version})
+	}
+	return rpcRocks
+}
+
+func nativeModulesToRPC(modules []rockamalg.NativeModule) []*rockamalgrpc.NativeModule {
+	rpcModules := make([]*rockamalgrpc.NativeModule, 0, len(modules))
+	for _, m := range modules {
+		rpcModules = append(rpcModules, &rockamalgrpc.NativeModule{
+			Module:  m.Module,
+			Rock:    m.Rock,
+			Version: m.Version,
+		})
+	}
+	return rpcModules
+}
+
+func (s *Server) Graph(
+	ctx context.Context, req *rockamalgrpc.GraphRequest,
+) (*rockamalgrpc.GraphResponse, error) {
+	if errSt := s.validateLuaSourceRequest(req); errSt != nil {
+		return nil, errSt.Err()
+	}
+
+	release, err := s.acquireSlot(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	graphDir, err := os.MkdirTemp("/tmp", "graph")
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "create temporary directory: %v", err)
+	}
+	defer func() { os.RemoveAll(graphDir) }()
+
+	src, errSt := s.writeLuaSources(ctx, req, graphDir)
+	if errSt != nil {
+		return nil, errSt.Err()
+	}
+
+	if len(req.GetVendor()) == 0 {
+		src.vendor = ""
+	}
+
+	g, err := s.amalg.Graph(ctx, rockamalg.GraphParams{
+		Dependencies:      src.dependencies,
+		Rockspec:          src.rockspec,
+		Lua:               src.lua,
+		Vendor:            src.vendor,
+		AllowLegacyVendor: req.GetAllowLegacyVendor(),
+		AllowDevDeps:      req.GetAllowDevDependencies(),
+		LuaVersion:        req.GetLuaVersion(),
+		SearchPath:        req.GetSearchPath(),
+	})
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "build graph: %v", err)
+	}
+
+	var buf bytes.Buffer
+	switch req.GetFormat() {
+	case rockamalgrpc.GraphFormat_GRAPH_FORMAT_DOT:
+		err = g.WriteDOT(&buf)
+	case rockamalgrpc.GraphFormat_GRAPH_FORMAT_JSON:
+		err = g.WriteJSON(&buf)
+	default:
+		return nil, status.Errorf(codes.InvalidArgument, "unsupported graph format: %v", req.GetFormat())
+	}
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "write graph: %v", err)
+	}
+
+	return &rockamalgrpc.GraphResponse{Graph: buf.Bytes()}, nil
+}
+
+// luaSourceRequest is implemented by requests carrying Lua sources with dependencies.
+type luaSourceRequest interface {
+	GetLuaFile() []byte
+	GetLuaDir() []byte
+	GetDependencies() []string
+	GetRockspec() []byte
+	GetVendor() []byte
+	GetLuaVersion() string
+	GetSearchPath() string
+}
+
+// luaSources are paths of request files written into the temporary directory.
+type luaSources struct {
+	lua          string
+	vendor       string
+	dependencies string
+	rockspec     string
+}
+
+func (s *Server) validateLuaSourceRequest(req luaSourceRequest) *status.Status {
 	if len(req.GetLuaDir()) != 0 && len(req.GetLuaFile()) != 0 {
 		return status.New(codes.InvalidArgument,
 			"lua file and lua directory are not allowed simultaneously")
@@ -84,54 +400,117 @@ func (s *Server) validateAmalgRequest(req *rockamalgrpc.AmalgRequest) *status.St
 		return status.New(codes.InvalidArgument,
 			"lua file or lua directory are not provided")
 	}
+
+	if v := req.GetLuaVersion(); v != "" && !rockamalg.IsSupportedLuaVersion(v) {
+		return status.Newf(codes.InvalidArgument, "unsupported lua version: %s", v)
+	}
+
+	if sp := req.GetSearchPath(); sp != "" {
+		if _, err := rockamalg.ParseSearchPath(sp); err != nil {
+			return status.New(codes.InvalidArgument, err.Error())
+		}
+	}
 	return nil
 }
 
 func (s *Server) prepareAmalgParams(
 	ctx context.Context, req *rockamalgrpc.AmalgRequest, amalgDir string,
 ) (rockamalg.AmalgParams, *status.Status) {
-	zero := rockamalg.AmalgParams{}
+	src, errSt := s.writeLuaSources(ctx, req, amalgDir)
+	if errSt != nil {
+		return rockamalg.AmalgParams{}, errSt
+	}
+
+	var bytecodeOutput string
+	if req.GetBytecode() != rockamalgrpc.BytecodeMode_BYTECODE_MODE_NONE {
+		bytecodeOutput = filepath.Join(amalgDir, "out.luac")
+	}
 
-	amalgParams := rockamalg.AmalgParams{
-		Output:       filepath.Join(amalgDir, "out.lua"),
-		Vendor:       filepath.Join(amalgDir, "vendor.zip"),
-		Isolate:      req.GetIsolate(),
-		DisableDebug: req.GetDisableDebug(),
-		AllowDevDeps: req.GetAllowDevDependencies(),
+	var sourceMap string
+	if req.GetSourceMap() {
+		sourceMap = filepath.Join(amalgDir, "out.lua.map")
+	}
+
+	lockFile := filepath.Join(amalgDir, rockamalg.LockFile)
+	if len(req.GetLockfile()) != 0 {
+		if err := os.WriteFile(lockFile, req.GetLockfile(), newFilePerm); err != nil {
+			return rockamalg.AmalgParams{}, status.Newf(codes.Internal, "create lockfile: %v", err)
+		}
+	}
+
+	return rockamalg.AmalgParams{
+		Dependencies:       src.dependencies,
+		Rockspec:           src.rockspec,
+		Lua:                src.lua,
+		Output:             filepath.Join(amalgDir, "out.lua"),
+		Vendor:             src.vendor,
+		Isolate:            req.GetIsolate(),
+		DisableDebug:       req.GetDisableDebug(),
+		AllowDevDeps:       req.GetAllowDevDependencies(),
+		Strict:             req.GetStrict(),
+		AllowUnresolved:    req.GetAllowUnresolved(),
+		LuaVersion:         req.GetLuaVersion(),
+		AllowNativeModules: req.GetAllowNativeModules(),
+		SearchPath:         req.GetSearchPath(),
+		Backend:            req.GetBackend(),
+		Minify:             req.GetMinify(),
+		MinifyLocals:       req.GetMinifyLocals(),
+		BytecodeOutput:     bytecodeOutput,
+		SourceMap:          sourceMap,
+		LockFile:           lockFile,
+		Locked:             req.GetLocked(),
+		Offline:            req.GetOffline(),
+		PruneVendor:        req.GetPruneVendor(),
+		AllowLegacyVendor:  req.GetAllowLegacyVendor(),
+		BuildInfo:          req.GetBuildInfo(),
+		BuildVersion:       req.GetBuildVersion(),
+	}, nil
+}
+
+func (s *Server) writeLuaSources(
+	ctx context.Context, req luaSourceRequest, dir string,
+) (luaSources, *status.Status) {
+	src := luaSources{
+		vendor: filepath.Join(dir, "vendor.zip"),
 	}
 
 	if len(req.GetVendor()) != 0 {
-		if err := os.WriteFile(amalgParams.Vendor, req.GetVendor(), newFilePerm); err != nil {
-			return zero, status.Newf(codes.Internal, "create vendor.zip file: %v", err)
+		if err := os.WriteFile(src.vendor, req.GetVendor(), newFilePerm); err != nil {
+			return luaSources{}, status.Newf(codes.Internal, "create vendor.zip file: %v", err)
 		}
 	}
 
 	if len(req.GetDependencies()) != 0 {
-		amalgParams.Dependencies = filepath.Join(amalgDir, "deps")
-		if err := s.writeDependenciesFile(req.GetDependencies(), amalgParams.Dependencies); err != nil {
-			return zero, status.Newf(codes.Internal, "create dependencies file: %v", err)
+		src.dependencies = filepath.Join(dir, "deps")
+		if err := s.writeDependenciesFile(req.GetDependencies(), src.dependencies); err != nil {
+			return luaSources{}, status.Newf(codes.Internal, "create dependencies file: %v", err)
 		}
 	}
 
 	var err error
-	amalgParams.Rockspec, err = s.writeRockspec(ctx, req.GetRockspec(), amalgDir)
+	luaVersion := req.GetLuaVersion()
+	if luaVersion == "" {
+		luaVersion = s.luaVersion
+	}
+
+	src.rockspec, err = s.writeRockspec(ctx, req.GetRockspec(), dir, luaVersion)
 	if err != nil {
-		return zero, status.Newf(codes.Internal, "create rockspec file: %v", err)
+		return luaSources{}, status.Newf(codes.Internal, "create rockspec file: %v", err)
 	}
 
 	if len(req.GetLuaFile()) != 0 {
-		amalgParams.Lua = filepath.Join(amalgDir, "fw.lua")
-		if err := os.WriteFile(amalgParams.Lua, req.GetLuaFile(), newFilePerm); err != nil {
-			return zero, status.Newf(codes.Internal, "create lua file: %v", err)
+		src.lua = filepath.Join(dir, "fw.lua")
+		if err := os.WriteFile(src.lua, req.GetLuaFile(), newFilePerm); err != nil {
+			return luaSources{}, status.Newf(codes.Internal, "create lua file: %v", err)
 		}
 	} else {
-		amalgParams.Lua = filepath.Join(amalgDir, "fw")
-		if err := archive.UnzipBytesToDir(req.GetLuaDir(), amalgParams.Lua); err != nil {
-			return zero, status.Newf(codes.Internal, "create lua dir: %v", err)
+		src.lua = filepath.Join(dir, "fw")
+		if err := archive.UnzipBytesToDir(req.GetLuaDir(), src.lua); err != nil {
+			return luaSources{}, status.Newf(codes.Internal, "create lua dir: %v", err)
 		}
 	}
 
-	return amalgParams, nil
+	return src, nil
 }
 
 func (s *Server) writeDependenciesFile(deps []string, path string) error {
@@ -149,7 +528,7 @@ func (s *Server) writeDependenciesFile(deps []string, path string) error {
 	return nil
 }
 
-func (s *Server) writeRockspec(ctx context.Context, data []byte, path string) (string, error) {
+func (s *Server) writeRockspec(ctx context.Context, data []byte, path, luaVersion string) (string, error) {
 	if len(data) == 0 {
 		return "", nil
 	}
@@ -159,7 +538,7 @@ func (s *Server) writeRockspec(ctx context.Context, data []byte, path string) (s
 	stdinBuf.Write(data)
 	stdinBuf.WriteString("\nprint(package)\nprint(version)\n")
 
-	luacmd := exec.CommandContext(ctx, "lua5.3")
+	luacmd := exec.CommandContext(ctx, "lua"+luaVersion)
 	luacmd.Stdout = stdoutBuf
 	luacmd.Stdin = stdinBuf
 